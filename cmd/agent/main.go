@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"p2nova-vpn/internal/agent"
+	"p2nova-vpn/pkg/wireguard"
+)
+
+func main() {
+	addr := getEnv("AGENT_ADDR", ":7443")
+	iface := getEnv("WG_INTERFACE", "wg0")
+
+	tlsConfig, err := agent.ServerTLSConfig(
+		os.Getenv("AGENT_CERT_FILE"),
+		os.Getenv("AGENT_KEY_FILE"),
+		os.Getenv("AGENT_CLIENT_CA_FILE"),
+	)
+	if err != nil {
+		log.Fatal("Failed to load TLS config:", err)
+	}
+
+	// The fake backend keeps peers in memory, for running the agent
+	// locally without WireGuard installed.
+	var backend wireguard.Backend
+	switch getEnv("AGENT_BACKEND", "wg") {
+	case "fake":
+		backend = wireguard.NewFakeBackend()
+	default:
+		backend = wireguard.NewInterface(iface)
+	}
+
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      agent.NewServer(backend).Routes(),
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	go func() {
+		log.Printf("p2Nova VPN agent for %s starting on %s", iface, addr)
+		if err := srv.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			log.Fatal("Agent failed:", err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Println("Shutting down agent...")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Fatal("Agent forced to shutdown:", err)
+	}
+
+	log.Println("Agent exited")
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
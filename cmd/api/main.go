@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
@@ -19,40 +20,72 @@ import (
 )
 
 func main() {
-	cfg, err := config.Load()
+	opts := config.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	cfg, err := config.Load(opts)
 	if err != nil {
 		log.Fatal("Failed to load config:", err)
 	}
 
 	// Initialize repositories
 	sessionRepo := repository.NewSessionRepository()
+	linkRepo := repository.NewLinkRepository()
 	serverRepo := repository.NewServerRepository()
+	if cfg.ServerStoreFile != "" {
+		serverRepo, err = repository.NewFileServerRepository(cfg.ServerStoreFile)
+		if err != nil {
+			log.Fatal("Failed to load server store:", err)
+		}
+	}
 
 	// Initialize services
-	wgService := service.NewWireguardService(cfg)
-	vpnService := service.NewVPNService(sessionRepo, wgService, cfg)
-	serverService := service.NewServerService(serverRepo, cfg)
+	wgService, err := service.NewWireguardService(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize WireGuard service:", err)
+	}
+	serverService, err := service.NewServerService(serverRepo, sessionRepo, cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize servers:", err)
+	}
+	vpnService := service.NewVPNService(sessionRepo, serverService, wgService, cfg)
+	linkService, err := service.NewLinkService(linkRepo, vpnService, cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize download links:", err)
+	}
+	healthChecker := service.NewHealthChecker(serverService, wgService, cfg)
+
+	// Background workers stop when the server shuts down
+	workers, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go healthChecker.Run(workers)
+	go vpnService.Run(workers)
+	if cfg.GeoDB != nil {
+		go cfg.GeoDB.Watch(workers, cfg.GeoIPReloadInterval)
+	}
 
 	// Initialize handlers
-	h := handler.NewHandler(vpnService, serverService)
+	reloader := service.NewReloader(opts, cfg, serverService)
+	h := handler.NewHandler(vpnService, serverService, linkService, reloader)
 
 	// Setup router
 	r := mux.NewRouter()
 
 	// Middleware
-	r.Use(middleware.CORS)
+	r.Use(middleware.CORS(cfg.Live.CORSOrigins))
+	r.Use(middleware.ClientInfo(cfg.TrustedProxies, cfg.ForwardedHeader, cfg.Geo))
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recovery)
 
-	// Routes
-	api := r.PathPrefix("/api").Subrouter()
-	api.HandleFunc("/servers", h.GetServers).Methods("GET")
-	api.HandleFunc("/vpn/server", h.SelectServer).Methods("POST")
-	api.HandleFunc("/vpn/connect", h.Connect).Methods("POST")
-	api.HandleFunc("/vpn/disconnect", h.Disconnect).Methods("POST")
-	api.HandleFunc("/vpn/speed", h.GetSpeed).Methods("GET")
-	api.HandleFunc("/vpn/status", h.GetStatus).Methods("GET")
-	api.HandleFunc("/health", h.Health).Methods("GET")
+	// Routes. /api/v1 is current; the unversioned paths stay as
+	// deprecated aliases for clients built before it.
+	v1 := r.PathPrefix("/api/v1").Subrouter()
+	v1.HandleFunc("/openapi.json", h.OpenAPI).Methods("GET")
+	handler.Routes(v1, h, cfg.AdminToken)
+
+	legacy := r.PathPrefix("/api").Subrouter()
+	legacy.Use(middleware.Deprecated("/api", "/api/v1", apiV1Date))
+	handler.Routes(legacy, h, cfg.AdminToken)
 
 	// Server setup
 	srv := &http.Server{
@@ -62,6 +95,9 @@ func main() {
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	// Status streams outlive WriteTimeout by setting their own deadlines,
+	// and end on shutdown so it need not wait for them
+	srv.RegisterOnShutdown(h.CloseStreams)
 
 	// Start server
 	go func() {
@@ -71,18 +107,31 @@ func main() {
 		}
 	}()
 
-	// Graceful shutdown
+	// SIGHUP reloads the configuration, other signals shut down
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range quit {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		if _, err := reloader.Reload(); err != nil {
+			log.Printf("Config reload rejected: %v", err)
+		}
+	}
 
 	log.Println("Shutting down server...")
+	stopWorkers()
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
 	}
+	// Shutdown does not track WebSocket connections
+	h.CloseStreams()
 
 	log.Println("Server exited")
 }
+
+// apiV1Date is when /api/v1 replaced the unversioned paths.
+var apiV1Date = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
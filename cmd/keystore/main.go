@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"p2nova-vpn/pkg/keystore"
+)
+
+const usage = `usage: p2nova-keystore [-file path] <command>
+
+commands:
+  set NAME     store NAME with the value read from stdin
+  delete NAME  remove NAME
+  list         print the names of the stored secrets
+
+The passphrase is read from KEYSTORE_PASSPHRASE or the file named by
+KEYSTORE_PASSPHRASE_FILE.
+`
+
+func main() {
+	path := flag.String("file", os.Getenv("KEYSTORE_FILE"), "keystore file")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	args := flag.Args()
+	if *path == "" || len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	passphrase, err := readPassphrase()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	secrets, err := keystore.Open(*path, passphrase)
+	if errors.Is(err, os.ErrNotExist) {
+		secrets = make(map[string]string)
+	} else if err != nil {
+		log.Fatal(err)
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		names := make([]string, 0, len(secrets))
+		for name := range secrets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return
+	case args[0] == "set" && len(args) == 2:
+		value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if value = strings.TrimSpace(value); value == "" {
+			log.Fatal("No value on stdin: ", err)
+		}
+		secrets[args[1]] = value
+	case args[0] == "delete" && len(args) == 2:
+		delete(secrets, args[1])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := keystore.Save(*path, passphrase, secrets); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readPassphrase() (string, error) {
+	if passphrase := os.Getenv("KEYSTORE_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+	if file := os.Getenv("KEYSTORE_PASSPHRASE_FILE"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return "", errors.New("set KEYSTORE_PASSPHRASE or KEYSTORE_PASSPHRASE_FILE")
+}
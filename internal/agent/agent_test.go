@@ -0,0 +1,212 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"p2nova-vpn/pkg/wireguard"
+)
+
+// pki is a throwaway CA with certificates for an agent and for the control
+// plane, written to files as the binaries expect them.
+type pki struct {
+	dir                   string
+	caFile                string
+	agentCert, agentKey   string
+	clientCert, clientKey string
+}
+
+func newPKI(t *testing.T) *pki {
+	t.Helper()
+	p := &pki{dir: t.TempDir()}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.caFile = p.write(t, "ca.pem", "CERTIFICATE", caDER)
+
+	issue := func(name string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.write(t, name+".pem", "CERTIFICATE", der), p.write(t, name+".key", "EC PRIVATE KEY", keyDER)
+	}
+	p.agentCert, p.agentKey = issue("agent", 2, x509.ExtKeyUsageServerAuth)
+	p.clientCert, p.clientKey = issue("control-plane", 3, x509.ExtKeyUsageClientAuth)
+	return p
+}
+
+func (p *pki) write(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(p.dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// startAgent serves an agent for backend behind mutual TLS, as cmd/agent
+// does with AGENT_BACKEND=fake.
+func startAgent(t *testing.T, p *pki, backend wireguard.Backend) *httptest.Server {
+	t.Helper()
+	tlsConfig, err := ServerTLSConfig(p.agentCert, p.agentKey, p.caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(NewServer(backend).Routes())
+	srv.TLS = tlsConfig
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testKey(b byte) string {
+	key := make([]byte, wireguard.KeyLen)
+	for i := range key {
+		key[i] = b
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func TestAgentOverMutualTLS(t *testing.T) {
+	p := newPKI(t)
+	backend := wireguard.NewFakeBackend()
+	srv := startAgent(t, p, backend)
+
+	tlsConfig, err := ClientTLSConfig(p.clientCert, p.clientKey, p.caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(srv.URL, tlsConfig)
+
+	if err := client.Health(); err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+
+	first, second := testKey(1), testKey(2)
+	if err := client.AddPeer(first, "10.8.0.2"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := client.AddPeer(second, "10.8.0.3"); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+
+	peers, err := client.ListPeers()
+	if err != nil {
+		t.Fatalf("ListPeers: %v", err)
+	}
+	if len(peers) != 2 || peers[0].PublicKey != first || peers[0].AllowedIPs != "10.8.0.2/32" {
+		t.Errorf("ListPeers = %+v", peers)
+	}
+
+	stats, err := client.Stats()
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if stats.Peers != 2 {
+		t.Errorf("Stats.Peers = %d, want 2", stats.Peers)
+	}
+
+	if err := client.RemovePeer(first); err != nil {
+		t.Fatalf("RemovePeer: %v", err)
+	}
+	if peers, _ := backend.ListPeers(); len(peers) != 1 || peers[0].PublicKey != second {
+		t.Errorf("backend peers after removal = %+v", peers)
+	}
+}
+
+func TestAgentRejectsInvalidPeers(t *testing.T) {
+	p := newPKI(t)
+	srv := startAgent(t, p, wireguard.NewFakeBackend())
+
+	tlsConfig, err := ClientTLSConfig(p.clientCert, p.clientKey, p.caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(srv.URL, tlsConfig)
+
+	tests := []struct {
+		name, key, ip, want string
+	}{
+		{"short key", base64.StdEncoding.EncodeToString([]byte("short")), "10.8.0.2", "invalid public key"},
+		{"zero key", base64.StdEncoding.EncodeToString(make([]byte, 32)), "10.8.0.2", "invalid public key"},
+		{"bad IP", testKey(1), "10.8.0", "invalid allowed IP"},
+	}
+	for _, tt := range tests {
+		err := client.AddPeer(tt.key, tt.ip)
+		if err == nil || !strings.Contains(err.Error(), "400 "+tt.want) {
+			t.Errorf("%s: got %v, want 400 %s", tt.name, err, tt.want)
+		}
+	}
+	if err := client.RemovePeer("bogus"); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("RemovePeer with a bad key: got %v, want 400", err)
+	}
+}
+
+func TestAgentRequiresClientCertificate(t *testing.T) {
+	p := newPKI(t)
+	srv := startAgent(t, p, wireguard.NewFakeBackend())
+
+	pool, err := loadCertPool(p.caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+	resp, err := anonymous.Get(srv.URL + "/peers")
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("agent answered a caller without a client certificate")
+	}
+}
@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"p2nova-vpn/pkg/wireguard"
+)
+
+// Client talks to a node agent. It implements wireguard.Backend so the API
+// server can treat remote nodes like a local interface.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+func NewClient(baseURL string, tlsConfig *tls.Config) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}
+}
+
+func (c *Client) AddPeer(publicKey, allowedIP string) error {
+	body, err := json.Marshal(addPeerRequest{PublicKey: publicKey, AllowedIP: allowedIP})
+	if err != nil {
+		return err
+	}
+	return c.do("POST", "/peers", bytes.NewReader(body), nil)
+}
+
+func (c *Client) RemovePeer(publicKey string) error {
+	return c.do("DELETE", "/peers?publicKey="+url.QueryEscape(publicKey), nil, nil)
+}
+
+func (c *Client) ListPeers() ([]wireguard.Peer, error) {
+	var peers []wireguard.Peer
+	if err := c.do("GET", "/peers", nil, &peers); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
+func (c *Client) Stats() (*wireguard.Stats, error) {
+	var stats wireguard.Stats
+	if err := c.do("GET", "/stats", nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func (c *Client) Health() error {
+	return c.do("GET", "/health", nil, nil)
+}
+
+func (c *Client) do(method, path string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("agent %s unreachable: %w", c.baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var e errorBody
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("agent %s: %s %s: %d %s", c.baseURL, method, path, resp.StatusCode, e.Error)
+	}
+
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
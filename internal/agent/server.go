@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"p2nova-vpn/pkg/wireguard"
+
+	"github.com/gorilla/mux"
+)
+
+type addPeerRequest struct {
+	PublicKey string `json:"publicKey"`
+	AllowedIP string `json:"allowedIp"`
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// Server exposes a node's WireGuard backend over HTTP. It is meant to be
+// served behind mutual TLS, see ServerTLSConfig.
+type Server struct {
+	backend wireguard.Backend
+}
+
+func NewServer(backend wireguard.Backend) *Server {
+	return &Server{backend: backend}
+}
+
+func (s *Server) Routes() http.Handler {
+	r := mux.NewRouter()
+	r.HandleFunc("/health", s.health).Methods("GET")
+	r.HandleFunc("/peers", s.listPeers).Methods("GET")
+	r.HandleFunc("/peers", s.addPeer).Methods("POST")
+	r.HandleFunc("/peers", s.removePeer).Methods("DELETE")
+	r.HandleFunc("/stats", s.stats).Methods("GET")
+	return r
+}
+
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) listPeers(w http.ResponseWriter, r *http.Request) {
+	peers, err := s.backend.ListPeers()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorBody{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, peers)
+}
+
+func (s *Server) addPeer(w http.ResponseWriter, r *http.Request) {
+	var req addPeerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "invalid request"})
+		return
+	}
+
+	if _, err := wireguard.ParseKey(req.PublicKey); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "invalid public key"})
+		return
+	}
+	if ip := net.ParseIP(req.AllowedIP); ip == nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "invalid allowed IP"})
+		return
+	}
+
+	if err := s.backend.AddPeer(req.PublicKey, req.AllowedIP); err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorBody{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"status": "added"})
+}
+
+func (s *Server) removePeer(w http.ResponseWriter, r *http.Request) {
+	publicKey := r.URL.Query().Get("publicKey")
+	if _, err := wireguard.ParseKey(publicKey); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "invalid public key"})
+		return
+	}
+
+	if err := s.backend.RemovePeer(publicKey); err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorBody{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "removed"})
+}
+
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) {
+	peers, err := s.backend.ListPeers()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorBody{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, wireguard.Summarize(peers))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -1,82 +1,270 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
 
+	"p2nova-vpn/internal/domain"
 	"p2nova-vpn/internal/geo"
+	"p2nova-vpn/internal/logging"
+	"p2nova-vpn/pkg/country"
 )
 
-func Load() (*Config, error) {
+// Load builds the configuration from the file named in opts, the
+// environment and command-line flags, in increasing order of precedence.
+// A nil opts reads the environment only.
+func Load(opts *Options) (*Config, error) {
+	cfg, src, err := load(opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	printSummary(cfg, src)
+	return cfg, nil
+}
+
+// Reload loads the configuration again for a server running with current.
+// It prints nothing, and servers whose address is unchanged keep the
+// location found for them at startup instead of being looked up again, so
+// a different answer from a geo provider does not read as a change.
+func Reload(opts *Options, current *Config) (*Config, error) {
+	cfg, _, err := load(opts, current)
+	return cfg, err
+}
+
+func load(opts *Options, previous *Config) (*Config, *source, error) {
+	src, err := newSource(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	cfg := &Config{
-		Port:             getEnv("PORT", "8080"),
-		ServerPublicKey:  getEnv("SERVER_PUBLIC_KEY", ""),
-		ServerPrivateKey: getEnv("SERVER_PRIVATE_KEY", ""),
-		ServerEndpoint:   getEnv("SERVER_ENDPOINT", ""),
-		WGInterface:      getEnv("WG_INTERFACE", "wg0"),
-		WGPort:           getEnv("WG_PORT", "51820"),
-		VPNSubnet:        getEnv("VPN_SUBNET", "10.8.0.0/24"),
-		DNSServers:       getEnv("DNS_SERVERS", "1.1.1.1, 8.8.8.8"),
+		Port:             src.get("PORT", "8080"),
+		ServerPublicKey:  src.get("SERVER_PUBLIC_KEY", ""),
+		ServerPrivateKey: src.get("SERVER_PRIVATE_KEY", ""),
+		ServerEndpoint:   src.get("SERVER_ENDPOINT", ""),
+		WGInterface:      src.get("WG_INTERFACE", "wg0"),
+		WGPort:           src.get("WG_PORT", "51820"),
+		VPNSubnet:        src.get("VPN_SUBNET", "10.8.0.0/24"),
+		DNSServers:       src.get("DNS_SERVERS", "1.1.1.1, 8.8.8.8"),
+		FleetFile:        src.get("FLEET_FILE", ""),
+		ServerStoreFile:  src.get("SERVER_STORE_FILE", ""),
+		AdminToken:       src.get("ADMIN_TOKEN", ""),
+		AgentCAFile:      src.get("AGENT_CA_FILE", ""),
+		AgentCertFile:    src.get("AGENT_CERT_FILE", ""),
+		AgentKeyFile:     src.get("AGENT_KEY_FILE", ""),
+		GeoIPFile:        src.get("GEOIP_DB", ""),
+		GeoIPASNFile:     src.get("GEOIP_ASN_DB", ""),
+		GeoStaticFile:    src.get("GEO_STATIC_FILE", ""),
+		IPInfoURL:        src.get("IPINFO_URL", "https://ipinfo.io"),
+		IPInfoToken:      src.get("IPINFO_TOKEN", ""),
 	}
 
-	// Get geo info for server configuration
-	serverIP := os.Getenv("SERVER_IP")
-	if serverIP == "" {
-		serverIP = cfg.ServerEndpoint
+	// Problems are collected so they can all be fixed in one go
+	var errs []error
+
+	if cfg.HealthCheckInterval, err = src.duration("HEALTH_CHECK_INTERVAL", "30s"); err != nil {
+		errs = append(errs, err)
 	}
 
-	geoInfo, err := geo.GetServerGeo(serverIP)
-	if err != nil {
-		geoInfo = &geo.GeoInfo{
-			Country: "Unknown",
-			City:    "Unknown",
-			IP:      serverIP,
+	if err := loadGeo(cfg, src); err != nil {
+		errs = append(errs, err)
+		// Carry on without lookups to find any further problems
+		cfg.Geo = geo.NewChain(cfg.GeoTimeout)
+	}
+
+	if cfg.TrustedProxies, err = parseCIDRs(src.get("TRUSTED_PROXIES", "")); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %v", src.invalid("TRUSTED_PROXIES"), err))
+	}
+	switch cfg.ForwardedHeader = http.CanonicalHeaderKey(src.get("TRUSTED_PROXY_HEADER", "X-Forwarded-For")); cfg.ForwardedHeader {
+	case "X-Forwarded-For", "Forwarded":
+	default:
+		errs = append(errs, fmt.Errorf("%w: want X-Forwarded-For or Forwarded", src.invalid("TRUSTED_PROXY_HEADER")))
+	}
+
+	for _, origin := range strings.Split(src.get("CORS_ORIGINS", "*"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			cfg.CORSOrigins = append(cfg.CORSOrigins, origin)
 		}
 	}
 
-	cfg.Servers = []ServerConfig{
-		{
-			Code: geoInfo.Country,
-			Name: geoInfo.City + " VPN",
-			IP:   geoInfo.IP,
-			Flag: getCountryFlag(geoInfo.Country),
-		},
+	if cfg.LogLevel, err = logging.ParseLevel(src.get("LOG_LEVEL", "info")); err != nil {
+		errs = append(errs, src.invalid("LOG_LEVEL"))
 	}
 
-	// Validate critical fields
-	if cfg.ServerPublicKey == "" {
-		return nil, fmt.Errorf("SERVER_PUBLIC_KEY environment variable is required")
+	cfg.TemplatesDir = src.get("TEMPLATES_DIR", "")
+	if cfg.Templates, err = loadTemplates(cfg.TemplatesDir); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", src.origin("TEMPLATES_DIR"), err))
 	}
 
-	if cfg.ServerEndpoint == "" {
-		return nil, fmt.Errorf("SERVER_ENDPOINT environment variable is required")
+	if cfg.Keyring, err = loadKeyring(src); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Links are sealed with a random key unless one is configured; they do
+	// not outlive sessions, which end with the process anyway.
+	cfg.LinkSecret = src.get("LINK_SECRET", "")
+	if cfg.LinkTTL, err = src.duration("LINK_TTL", "15m"); err == nil && cfg.LinkTTL > domain.MaxLinkTTL {
+		err = fmt.Errorf("%w: at most %s", src.invalid("LINK_TTL"), domain.MaxLinkTTL)
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	cfg.Plans = src.file.plans
+	cfg.DefaultPlan = src.get("DEFAULT_PLAN", "")
+	lines := src.file.planLines
+	errs = append(errs, checkPlans(cfg, func(i int) string {
+		return fmt.Sprintf("%s:%d", src.fileName, lines[i])
+	})...)
+
+	single := cfg.FleetFile == "" && len(src.file.servers) == 0
+	if cfg.FleetFile != "" {
+		servers, err := loadFleet(cfg.FleetFile, cfg)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		cfg.Servers = servers
+	} else if len(src.file.servers) > 0 {
+		lines := src.file.serverLines
+		err := prepareServers(src.file.servers, cfg, func(i int) string {
+			return fmt.Sprintf("%s:%d", src.fileName, lines[i])
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+		cfg.Servers = src.file.servers
+	} else if err := checkSingleServer(cfg); err != nil {
+		errs = append(errs, err)
+	}
+
+	errs = append(errs, src.errs...)
+	errs = append(errs, validate(cfg, src)...)
+	if len(errs) > 0 {
+		return nil, nil, fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
 	}
 
-	// Log loaded configuration (for debugging)
+	if single {
+		cfg.Servers = []ServerConfig{*loadSingleServer(cfg, src, previous)}
+	} else {
+		locateServers(cfg, previous)
+	}
+
+	cfg.Live = newLive(cfg)
+	return cfg, src, nil
+}
+
+// printSummary logs the loaded configuration at startup.
+func printSummary(cfg *Config, src *source) {
 	fmt.Println("✓ VPN Configuration Loaded:")
-	fmt.Printf("  Server Public Key: %s\n", cfg.ServerPublicKey)
-	fmt.Printf("  Server Endpoint: %s:%s\n", cfg.ServerEndpoint, cfg.WGPort)
-	fmt.Printf("  WG Interface: %s\n", cfg.WGInterface)
-	fmt.Printf("  VPN Subnet: %s\n", cfg.VPNSubnet)
 	fmt.Printf("  DNS Servers: %s\n", cfg.DNSServers)
-
-	return cfg, nil
+	fmt.Printf("  Geo Providers: %s\n", strings.Join(cfg.GeoProviders, ", "))
+	if cfg.Keyring.Ephemeral() {
+		fmt.Println("  Encryption: temporary key (ENCRYPTION_KEYS not set)")
+	} else {
+		fmt.Printf("  Encryption: key version %d of %v\n", cfg.Keyring.Current(), cfg.Keyring.Versions())
+	}
+	if cfg.TemplatesDir != "" {
+		fmt.Printf("  Config Templates: %s\n", cfg.TemplatesDir)
+	}
+	if origins := src.secretOrigins(); len(origins) > 0 {
+		fmt.Printf("  Secrets: %s\n", strings.Join(origins, ", "))
+	}
+	for _, srv := range cfg.Servers {
+		fmt.Printf("  Server %s (%s):\n", srv.Code, srv.Name)
+		fmt.Printf("    Public Key: %s\n", srv.PublicKey)
+		fmt.Printf("    Endpoint: %s:%d\n", srv.Endpoint, srv.Port)
+		if srv.Agent != "" {
+			fmt.Printf("    Agent: %s\n", srv.Agent)
+		} else {
+			fmt.Printf("    WG Interface: %s\n", srv.Interface)
+		}
+		fmt.Printf("    VPN Subnet: %s\n", srv.Subnet)
+	}
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// checkSingleServer makes sure the settings of the single server are there.
+func checkSingleServer(cfg *Config) error {
+	var errs []error
+	if cfg.ServerPublicKey == "" {
+		errs = append(errs, fmt.Errorf("SERVER_PUBLIC_KEY (server.publicKey) is required"))
+	}
+	if cfg.ServerEndpoint == "" {
+		errs = append(errs, fmt.Errorf("SERVER_ENDPOINT (server.endpoint) is required"))
 	}
-	return defaultValue
+	return errors.Join(errs...)
 }
 
-func getCountryFlag(countryCode string) string {
-	flags := map[string]string{
-		"KE": "🇰🇪", "US": "🇺🇸", "GB": "🇬🇧", "UK": "🇬🇧",
-		"DE": "🇩🇪", "FR": "🇫🇷", "SG": "🇸🇬", "JP": "🇯🇵",
+// loadSingleServer builds the server entry for env-only deployments that run
+// the API and a single WireGuard node on the same host. The settings have
+// already been validated. The server's code comes from its location, so on
+// reload the previous location is kept while the address is the same.
+func loadSingleServer(cfg *Config, src *source, previous *Config) *ServerConfig {
+	port, _ := strconv.Atoi(cfg.WGPort)
+
+	srv := &ServerConfig{
+		Endpoint:  cfg.ServerEndpoint,
+		Port:      port,
+		PublicKey: cfg.ServerPublicKey,
+		Subnet:    cfg.VPNSubnet,
+		Interface: cfg.WGInterface,
+		Capacity:  SubnetCapacity(cfg.VPNSubnet),
+	}
+
+	// Get geo info for server configuration
+	serverIP := src.get("SERVER_IP", cfg.ServerEndpoint)
+	if previous != nil && len(previous.Servers) == 1 && previous.Servers[0].IP == serverIP {
+		prev := previous.Servers[0]
+		srv.Code, srv.Name, srv.IP, srv.Flag = prev.Code, prev.Name, prev.IP, prev.Flag
+		srv.Country, srv.City, srv.Latitude, srv.Longitude = prev.Country, prev.City, prev.Latitude, prev.Longitude
+		return srv
+	}
+
+	geoInfo, err := cfg.Geo.Lookup(context.Background(), serverIP)
+	if err != nil {
+		geoInfo = &geo.GeoInfo{
+			Country: "Unknown",
+			City:    "Unknown",
+			IP:      serverIP,
+		}
 	}
-	if flag, ok := flags[countryCode]; ok {
-		return flag
+
+	srv.Code = geoInfo.Country
+	srv.Name = geoInfo.City + " VPN"
+	srv.IP = geoInfo.IP
+	srv.Flag = country.Flag(geoInfo.Country)
+	srv.Country = country.Normalize(geoInfo.Country)
+	srv.City = geoInfo.City
+	srv.Latitude, srv.Longitude, _ = geoInfo.Coordinates()
+	return srv
+}
+
+// parseCIDRs parses a comma separated list of CIDRs or single addresses.
+func parseCIDRs(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
 	}
-	return "🌍"
+	return networks, nil
 }
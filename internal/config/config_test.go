@@ -0,0 +1,68 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"p2nova-vpn/internal/domain"
+)
+
+// singleServerEnv sets the minimum environment for a single-server load
+// that does not leave the machine.
+func singleServerEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("SERVER_PUBLIC_KEY", testKey(1))
+	t.Setenv("SERVER_ENDPOINT", "192.0.2.1")
+	t.Setenv("GEO_PROVIDERS", "static")
+}
+
+func TestForwardedHeader(t *testing.T) {
+	singleServerEnv(t)
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ForwardedHeader != "X-Forwarded-For" {
+		t.Errorf("default header = %q", cfg.ForwardedHeader)
+	}
+
+	t.Setenv("TRUSTED_PROXY_HEADER", "forwarded")
+	if cfg, err = Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ForwardedHeader != "Forwarded" {
+		t.Errorf("header = %q, want Forwarded", cfg.ForwardedHeader)
+	}
+
+	t.Setenv("TRUSTED_PROXY_HEADER", "X-Real-IP")
+	if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "TRUSTED_PROXY_HEADER") {
+		t.Errorf("X-Real-IP: got %v", err)
+	}
+}
+
+func TestLinkTTL(t *testing.T) {
+	singleServerEnv(t)
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LinkTTL != 15*time.Minute {
+		t.Errorf("default TTL = %s", cfg.LinkTTL)
+	}
+
+	t.Setenv("LINK_TTL", "24h")
+	if cfg, err = Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LinkTTL != domain.MaxLinkTTL {
+		t.Errorf("TTL = %s, want 24h", cfg.LinkTTL)
+	}
+
+	t.Setenv("LINK_TTL", "25h")
+	if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "LINK_TTL") {
+		t.Errorf("25h: got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"p2nova-vpn/pkg/envelope"
+)
+
+// loadKeyring builds the master keys that seal session key material at rest.
+// ENCRYPTION_KEYS lists VERSION:BASE64KEY pairs, e.g. "1:...,2:...", and new
+// values are sealed with ENCRYPTION_KEY_VERSION, by default the highest.
+// Without keys a temporary key is generated; sessions do not outlive the
+// process, so nothing is lost when it goes.
+func loadKeyring(src *source) (*envelope.Keyring, error) {
+	value := src.get("ENCRYPTION_KEYS", "")
+	if value == "" {
+		if src.get("ENCRYPTION_KEY_VERSION", "") != "" {
+			return nil, fmt.Errorf("%w: ENCRYPTION_KEYS is not set", src.invalid("ENCRYPTION_KEY_VERSION"))
+		}
+		return envelope.NewEphemeralKeyring()
+	}
+
+	keys := make(map[int][]byte)
+	current := 0
+	for i, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		// Details never quote the entry, which holds a key
+		v, encoded, ok := strings.Cut(entry, ":")
+		version, err := strconv.Atoi(v)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("%w: entry %d: expected VERSION:BASE64KEY with a positive version", src.invalid("ENCRYPTION_KEYS"), i+1)
+		}
+		if _, dup := keys[version]; dup {
+			return nil, fmt.Errorf("%w: version %d given twice", src.invalid("ENCRYPTION_KEYS"), version)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != envelope.KeyLen {
+			return nil, fmt.Errorf("%w: version %d: expected %d bytes of base64", src.invalid("ENCRYPTION_KEYS"), version, envelope.KeyLen)
+		}
+		keys[version] = key
+		if version > current {
+			current = version
+		}
+	}
+
+	if v := src.get("ENCRYPTION_KEY_VERSION", ""); v != "" {
+		version, err := strconv.Atoi(v)
+		if _, ok := keys[version]; err != nil || !ok {
+			return nil, fmt.Errorf("%w: not a version in ENCRYPTION_KEYS", src.invalid("ENCRYPTION_KEY_VERSION"))
+		}
+		current = version
+	}
+
+	return envelope.NewKeyring(keys, current)
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"p2nova-vpn/pkg/envelope"
+)
+
+func encodedKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, envelope.KeyLen))
+}
+
+func TestLoadKeyring(t *testing.T) {
+	singleServerEnv(t)
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Keyring.Ephemeral() {
+		t.Error("keyring without ENCRYPTION_KEYS is not temporary")
+	}
+
+	t.Setenv("ENCRYPTION_KEYS", "1:"+encodedKey(1)+", 3:"+encodedKey(3))
+	if cfg, err = Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	if k := cfg.Keyring; k.Ephemeral() || k.Current() != 3 || len(k.Versions()) != 2 {
+		t.Errorf("keyring: current %d, versions %v", k.Current(), k.Versions())
+	}
+
+	t.Setenv("ENCRYPTION_KEY_VERSION", "1")
+	if cfg, err = Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Keyring.Current() != 1 {
+		t.Errorf("current = %d, want ENCRYPTION_KEY_VERSION 1", cfg.Keyring.Current())
+	}
+}
+
+func TestLoadKeyringErrors(t *testing.T) {
+	key := encodedKey(1)
+	tests := []struct {
+		keys, version, want string
+	}{
+		{"", "1", "ENCRYPTION_KEYS is not set"},
+		{key, "", "entry 1: expected VERSION:BASE64KEY"},
+		{"0:" + key, "", "entry 1: expected VERSION:BASE64KEY with a positive version"},
+		{"1:" + key + ",1:" + key, "", "version 1 given twice"},
+		{"1:" + key[:20], "", "version 1: expected 32 bytes of base64"},
+		{"1:not base64!", "", "version 1: expected 32 bytes of base64"},
+		{"1:" + key, "2", "not a version in ENCRYPTION_KEYS"},
+		{"1:" + key, "one", "not a version in ENCRYPTION_KEYS"},
+	}
+	for _, tt := range tests {
+		singleServerEnv(t)
+		t.Setenv("ENCRYPTION_KEYS", tt.keys)
+		t.Setenv("ENCRYPTION_KEY_VERSION", tt.version)
+
+		_, err := Load(nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q, version %q: got %v, want %q", tt.keys, tt.version, err, tt.want)
+			continue
+		}
+		// Keys never show up in errors
+		if strings.Contains(err.Error(), key[:20]) {
+			t.Errorf("error reveals a key: %v", err)
+		}
+	}
+}
+
+func TestLiveKeyringKeepsOldKeys(t *testing.T) {
+	singleServerEnv(t)
+	t.Setenv("ENCRYPTION_KEYS", "1:"+encodedKey(1))
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := cfg.Live.Keyring().Seal([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A reload that drops version 1 still opens what it sealed
+	t.Setenv("ENCRYPTION_KEYS", "2:"+encodedKey(2))
+	next, err := Reload(nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Live.Apply(next)
+	if k := cfg.Live.Keyring(); k.Current() != 2 || len(k.Versions()) != 2 {
+		t.Fatalf("live keyring: current %d, versions %v", k.Current(), k.Versions())
+	}
+	if _, err := cfg.Live.Keyring().Open(sealed); err != nil {
+		t.Errorf("open after reload: %v", err)
+	}
+
+	// Without keys the reload keeps the configured ones
+	t.Setenv("ENCRYPTION_KEYS", "")
+	if next, err = Reload(nil, cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Live.Apply(next)
+	if k := cfg.Live.Keyring(); k.Ephemeral() || k.Current() != 2 {
+		t.Errorf("temporary key replaced the configured ones: current %d", k.Current())
+	}
+}
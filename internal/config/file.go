@@ -0,0 +1,281 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"p2nova-vpn/internal/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileKeys is the schema of the configuration file: each dotted path maps to
+// the environment variable it stands in for, so the file, the environment
+// and flags all feed the same settings.
+var fileKeys = map[string]string{
+	"port":                "PORT",
+	"adminToken":          "ADMIN_TOKEN",
+	"fleetFile":           "FLEET_FILE",
+	"serverStoreFile":     "SERVER_STORE_FILE",
+	"keystoreFile":        "KEYSTORE_FILE",
+	"trustedProxies":      "TRUSTED_PROXIES",
+	"trustedProxyHeader":  "TRUSTED_PROXY_HEADER",
+	"healthCheckInterval": "HEALTH_CHECK_INTERVAL",
+	"corsOrigins":         "CORS_ORIGINS",
+	"logLevel":            "LOG_LEVEL",
+	"templatesDir":        "TEMPLATES_DIR",
+	"defaultPlan":         "DEFAULT_PLAN",
+
+	"links.secret": "LINK_SECRET",
+	"links.ttl":    "LINK_TTL",
+
+	"encryption.keys":       "ENCRYPTION_KEYS",
+	"encryption.keyVersion": "ENCRYPTION_KEY_VERSION",
+
+	"server.publicKey":  "SERVER_PUBLIC_KEY",
+	"server.privateKey": "SERVER_PRIVATE_KEY",
+	"server.endpoint":   "SERVER_ENDPOINT",
+	"server.ip":         "SERVER_IP",
+
+	"wireguard.interface": "WG_INTERFACE",
+	"wireguard.port":      "WG_PORT",
+	"wireguard.subnet":    "VPN_SUBNET",
+	"wireguard.dns":       "DNS_SERVERS",
+
+	"agent.caFile":   "AGENT_CA_FILE",
+	"agent.certFile": "AGENT_CERT_FILE",
+	"agent.keyFile":  "AGENT_KEY_FILE",
+
+	"geo.providers":      "GEO_PROVIDERS",
+	"geo.timeout":        "GEO_TIMEOUT",
+	"geo.cacheSize":      "GEO_CACHE_SIZE",
+	"geo.cacheTTL":       "GEO_CACHE_TTL",
+	"geo.negativeTTL":    "GEO_NEGATIVE_TTL",
+	"geo.staticFile":     "GEO_STATIC_FILE",
+	"geo.geoipDB":        "GEOIP_DB",
+	"geo.geoipASNDB":     "GEOIP_ASN_DB",
+	"geo.reloadInterval": "GEOIP_RELOAD_INTERVAL",
+	"geo.ipinfoURL":      "IPINFO_URL",
+	"geo.ipinfoToken":    "IPINFO_TOKEN",
+}
+
+// fileLists are the settings that may be written as YAML sequences. They
+// are joined with commas, as in the environment.
+var fileLists = map[string]bool{
+	"trustedProxies":  true,
+	"corsOrigins":     true,
+	"encryption.keys": true,
+	"wireguard.dns":   true,
+	"geo.providers":   true,
+}
+
+// fileValue is a setting read from the configuration file, with the line it
+// was found on.
+type fileValue struct {
+	value string
+	line  int
+}
+
+// configFile is a parsed configuration file.
+type configFile struct {
+	values      map[string]fileValue
+	servers     []ServerConfig
+	serverLines []int
+	plans       []domain.Plan
+	planLines   []int
+}
+
+// fileError is a schema violation at a line of the configuration file.
+type fileError struct {
+	line int
+	msg  string
+}
+
+// readFile parses and validates a YAML configuration file. Every schema
+// violation is reported with its line number.
+func readFile(path string) (*configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	file := &configFile{values: make(map[string]fileValue)}
+	if len(root.Content) == 0 {
+		return file, nil
+	}
+
+	var errs []fileError
+	file.walk(root.Content[0], "", &errs)
+
+	if len(errs) > 0 {
+		msgs := make([]error, len(errs))
+		for i, e := range errs {
+			msgs[i] = fmt.Errorf("%s:%d: %s", path, e.line, e.msg)
+		}
+		return nil, fmt.Errorf("invalid config file %s:\n%w", path, errors.Join(msgs...))
+	}
+	return file, nil
+}
+
+func (f *configFile) walk(node *yaml.Node, prefix string, errs *[]fileError) {
+	if node.Kind != yaml.MappingNode {
+		*errs = append(*errs, fileError{node.Line, describe(prefix) + " must be a mapping"})
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, value := node.Content[i], node.Content[i+1]
+		path := keyNode.Value
+		if prefix != "" {
+			path = prefix + "." + keyNode.Value
+		}
+
+		switch key, ok := fileKeys[path]; {
+		case path == "servers":
+			f.readServers(value, errs)
+		case path == "plans":
+			f.readPlans(value, errs)
+		case ok:
+			f.readValue(path, key, value, errs)
+		case isSection(path):
+			f.walk(value, path, errs)
+		default:
+			*errs = append(*errs, fileError{keyNode.Line, fmt.Sprintf("unknown key %q", path)})
+		}
+	}
+}
+
+func (f *configFile) readValue(path, key string, node *yaml.Node, errs *[]fileError) {
+	switch {
+	case node.Kind == yaml.ScalarNode:
+		f.values[key] = fileValue{node.Value, node.Line}
+	case node.Kind == yaml.SequenceNode && fileLists[path]:
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				*errs = append(*errs, fileError{item.Line, path + " entries must be plain values"})
+				return
+			}
+			items = append(items, item.Value)
+		}
+		f.values[key] = fileValue{strings.Join(items, ","), node.Line}
+	case fileLists[path]:
+		*errs = append(*errs, fileError{node.Line, path + " must be a value or a list"})
+	default:
+		*errs = append(*errs, fileError{node.Line, path + " must be a value"})
+	}
+}
+
+// readServers decodes the fleet, rejecting fields ServerConfig does not
+// have.
+func (f *configFile) readServers(node *yaml.Node, errs *[]fileError) {
+	for _, item := range readList(node, "servers", reflect.TypeOf(ServerConfig{}), errs) {
+		var srv ServerConfig
+		if err := item.Decode(&srv); err != nil {
+			*errs = append(*errs, decodeErrors(item.Line, err)...)
+			continue
+		}
+		f.servers = append(f.servers, srv)
+		f.serverLines = append(f.serverLines, item.Line)
+	}
+}
+
+// readPlans decodes the plans, rejecting fields domain.Plan does not have.
+func (f *configFile) readPlans(node *yaml.Node, errs *[]fileError) {
+	for _, item := range readList(node, "plans", reflect.TypeOf(domain.Plan{}), errs) {
+		var plan domain.Plan
+		if err := item.Decode(&plan); err != nil {
+			*errs = append(*errs, decodeErrors(item.Line, err)...)
+			continue
+		}
+		f.plans = append(f.plans, plan)
+		f.planLines = append(f.planLines, item.Line)
+	}
+}
+
+// readList returns the entries of a list of mappings whose keys all match
+// the yaml fields of t.
+func readList(node *yaml.Node, name string, t reflect.Type, errs *[]fileError) []*yaml.Node {
+	if node.Kind != yaml.SequenceNode {
+		*errs = append(*errs, fileError{node.Line, name + " must be a list"})
+		return nil
+	}
+
+	var items []*yaml.Node
+	for _, item := range node.Content {
+		if item.Kind != yaml.MappingNode {
+			*errs = append(*errs, fileError{item.Line, name + " entries must be mappings"})
+			continue
+		}
+		if checkFields(item, t, name, errs) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// checkFields reports keys of a mapping that t has no yaml field for,
+// descending into nested structs.
+func checkFields(node *yaml.Node, t reflect.Type, name string, errs *[]fileError) bool {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		fields[tag] = t.Field(i).Type
+	}
+
+	valid := true
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		field, ok := fields[key.Value]
+		switch {
+		case !ok:
+			*errs = append(*errs, fileError{key.Line, fmt.Sprintf("unknown %s field %q", name, key.Value)})
+			valid = false
+		case field.Kind() == reflect.Struct && value.Kind == yaml.MappingNode:
+			valid = checkFields(value, field, name+"."+key.Value, errs) && valid
+		}
+	}
+	return valid
+}
+
+// decodeErrors splits a yaml decoding error into its per-line messages.
+func decodeErrors(line int, err error) []fileError {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return []fileError{{line, err.Error()}}
+	}
+
+	errs := make([]fileError, 0, len(typeErr.Errors))
+	for _, msg := range typeErr.Errors {
+		at := line
+		if n, _ := fmt.Sscanf(msg, "line %d:", &at); n == 1 {
+			_, msg, _ = strings.Cut(msg, ": ")
+		}
+		errs = append(errs, fileError{at, msg})
+	}
+	return errs
+}
+
+func isSection(path string) bool {
+	for key := range fileKeys {
+		if strings.HasPrefix(key, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func describe(path string) string {
+	if path == "" {
+		return "the document"
+	}
+	return path
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestReadFile(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+port: 9000
+trustedProxies: [127.0.0.1, 10.0.0.0/8]
+wireguard:
+  dns: 9.9.9.9
+  port: 51000
+servers:
+  - code: DE
+    endpoint: de.example.com
+    tunnel:
+      mtu: 1380
+plans:
+  - name: free
+    overrides: [mtu]
+`)
+
+	file, err := readFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"PORT":            "9000",
+		"TRUSTED_PROXIES": "127.0.0.1,10.0.0.0/8",
+		"DNS_SERVERS":     "9.9.9.9",
+		"WG_PORT":         "51000",
+	}
+	for key, value := range want {
+		if got := file.values[key].value; got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	if line := file.values["DNS_SERVERS"].line; line != 5 {
+		t.Errorf("wireguard.dns read from line %d, want 5", line)
+	}
+	if len(file.servers) != 1 || file.servers[0].Code != "DE" || file.servers[0].Tunnel.MTU != 1380 || file.serverLines[0] != 8 {
+		t.Errorf("servers = %+v at lines %v", file.servers, file.serverLines)
+	}
+	if len(file.plans) != 1 || file.plans[0].Name != "free" || !file.plans[0].Allows("mtu") {
+		t.Errorf("plans = %+v", file.plans)
+	}
+}
+
+func TestReadFileSchemaErrors(t *testing.T) {
+	path := writeFile(t, "config.yaml", `port: 9000
+prot: 9001
+wireguard:
+  dns: [1.1.1.1]
+  subnet: [10.8.0.0/24]
+geo: fast
+servers:
+  - code: DE
+    endpont: de.example.com
+    tunnel:
+      mtuu: 1380
+  - just-a-string
+plans:
+  - name: free
+    tunnel:
+      mtu: large
+`)
+
+	_, err := readFile(path)
+	if err == nil {
+		t.Fatal("invalid file accepted")
+	}
+	for _, want := range []string{
+		`:2: unknown key "prot"`,
+		`:5: wireguard.subnet must be a value`,
+		`:6: geo must be a mapping`,
+		`:9: unknown servers field "endpont"`,
+		`:11: unknown servers.tunnel field "mtuu"`,
+		`:12: servers entries must be mappings`,
+		`:16: cannot unmarshal`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not report %q:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), ":4:") {
+		t.Errorf("wireguard.dns is a list setting:\n%v", err)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+port: 9000
+corsOrigins: [https://file.example]
+logLevel: debug
+server:
+  publicKey: `+testKey(1)+`
+  endpoint: 192.0.2.1
+geo:
+  providers: [static]
+`)
+
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	opts := BindFlags(fs)
+	if err := fs.Parse([]string{"--config", path, "--port", "9200"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PORT", "9100")
+	t.Setenv("CORS_ORIGINS", "https://env.example")
+
+	cfg, err := Load(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != "9200" {
+		t.Errorf("port = %s, want the flag's 9200", cfg.Port)
+	}
+	if len(cfg.CORSOrigins) != 1 || cfg.CORSOrigins[0] != "https://env.example" {
+		t.Errorf("CORS origins = %v, want the environment's", cfg.CORSOrigins)
+	}
+	if cfg.LogLevel.String() != "debug" {
+		t.Errorf("log level = %s, want the file's debug", cfg.LogLevel)
+	}
+	if cfg.WGPort != "51820" {
+		t.Errorf("WireGuard port = %s, want the default", cfg.WGPort)
+	}
+}
+
+func TestLoadEnvOnly(t *testing.T) {
+	singleServerEnv(t)
+	t.Setenv("WG_PORT", "51999")
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Servers) != 1 {
+		t.Fatalf("got %d servers, want the single server", len(cfg.Servers))
+	}
+	if srv := cfg.Servers[0]; srv.Endpoint != "192.0.2.1" || srv.Port != 51999 || srv.PublicKey != testKey(1) {
+		t.Errorf("single server = %+v", srv)
+	}
+}
+
+func TestLoadReportsOrigin(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+server:
+  publicKey: `+testKey(1)+`
+  endpoint: 192.0.2.1
+healthCheckInterval: often
+`)
+	t.Setenv("GEO_PROVIDERS", "static")
+	t.Setenv("LOG_LEVEL", "loud")
+
+	_, err := Load(&Options{File: path})
+	if err == nil {
+		t.Fatal("invalid settings accepted")
+	}
+	for _, want := range []string{
+		`invalid HEALTH_CHECK_INTERVAL "often" (` + path + `:5)`,
+		`invalid LOG_LEVEL "loud" (env LOG_LEVEL)`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not report %q:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"p2nova-vpn/pkg/country"
+)
+
+type fleetFile struct {
+	Servers []ServerConfig `json:"servers"`
+}
+
+// loadFleet reads a JSON fleet definition. Per-server fields that are left
+// empty fall back to the global WireGuard settings.
+func loadFleet(path string, cfg *Config) ([]ServerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fleet file: %w", err)
+	}
+
+	var fleet fleetFile
+	if err := json.Unmarshal(data, &fleet); err != nil {
+		return nil, fmt.Errorf("failed to parse fleet file %s: %w", path, err)
+	}
+
+	if len(fleet.Servers) == 0 {
+		return nil, fmt.Errorf("fleet file %s defines no servers", path)
+	}
+
+	// The servers are returned even when invalid so that the remaining
+	// checks can still report on them
+	err = prepareServers(fleet.Servers, cfg, nil)
+	return fleet.Servers, err
+}
+
+// prepareServers validates fleet servers and fills in their defaults,
+// reporting every problem found. When position is set, errors are prefixed
+// with the server's location in the file it came from.
+func prepareServers(servers []ServerConfig, cfg *Config, position func(i int) string) error {
+	defaultPort, _ := strconv.Atoi(cfg.WGPort)
+	seen := make(map[string]bool)
+
+	var errs []error
+	for i := range servers {
+		for _, err := range prepareServer(&servers[i], i, cfg, defaultPort, seen) {
+			if position != nil {
+				err = fmt.Errorf("%s: %w", position(i), err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func prepareServer(srv *ServerConfig, i int, cfg *Config, defaultPort int, seen map[string]bool) []error {
+	if srv.Code == "" {
+		return []error{fmt.Errorf("fleet server #%d: code is required", i+1)}
+	}
+
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("fleet server %s: "+format, append([]interface{}{srv.Code}, args...)...))
+	}
+
+	if seen[srv.Code] {
+		fail("duplicate code")
+	}
+	seen[srv.Code] = true
+
+	if srv.Port == 0 {
+		srv.Port = defaultPort
+	}
+	if srv.Subnet == "" {
+		srv.Subnet = cfg.VPNSubnet
+	}
+	for _, err := range CheckServer(srv.Code, srv.Endpoint, srv.Port, srv.Subnet, srv.PublicKey, srv.CanaryKey) {
+		fail("%v", err)
+	}
+	if err := srv.Tunnel.Validate(); err != nil {
+		fail("tunnel: %v", err)
+	}
+	if srv.Capacity == 0 {
+		srv.Capacity = SubnetCapacity(srv.Subnet)
+	}
+	if srv.Interface == "" {
+		srv.Interface = cfg.WGInterface
+	}
+	if srv.IP == "" {
+		srv.IP = srv.Endpoint
+	}
+	if srv.Name == "" {
+		srv.Name = srv.Code
+	}
+	if srv.Country == "" && len(srv.Code) == 2 {
+		srv.Country = srv.Code
+	}
+	srv.Country = country.Normalize(srv.Country)
+	if srv.Flag == "" {
+		srv.Flag = country.Flag(srv.Country)
+	}
+
+	return errs
+}
+
+// SubnetCapacity is the number of client addresses in a subnet, leaving out
+// the network address, the gateway and the broadcast address.
+func SubnetCapacity(cidr string) int {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return 0
+	}
+
+	ones, bits := network.Mask.Size()
+	if bits-ones >= 16 {
+		return 1<<16 - 3
+	}
+	return 1<<(bits-ones) - 3
+}
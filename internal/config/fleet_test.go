@@ -0,0 +1,139 @@
+package config
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testKey returns a valid base64 WireGuard key made of one repeated byte.
+func testKey(b byte) string {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = b
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func defaultsConfig() *Config {
+	return &Config{WGPort: "51820", VPNSubnet: "10.8.0.0/24", WGInterface: "wg0"}
+}
+
+func TestLoadFleetDefaults(t *testing.T) {
+	path := writeFile(t, "fleet.json", `{"servers": [
+		{"code": "DE", "endpoint": "de.example.com", "publicKey": "`+testKey(1)+`"},
+		{"code": "KE", "name": "Nairobi", "endpoint": "203.0.113.7", "port": 51000, "publicKey": "`+testKey(2)+`",
+		 "subnet": "10.9.0.0/24", "interface": "wg1", "country": "uk"}
+	]}`)
+
+	servers, err := loadFleet(path, defaultsConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 2 {
+		t.Fatalf("got %d servers, want 2", len(servers))
+	}
+
+	de := servers[0]
+	if de.Port != 51820 || de.Subnet != "10.8.0.0/24" || de.Interface != "wg0" {
+		t.Errorf("DE did not get the global defaults: port %d, subnet %s, interface %s", de.Port, de.Subnet, de.Interface)
+	}
+	if de.Name != "DE" || de.IP != "de.example.com" || de.Country != "DE" || de.Flag != "🇩🇪" {
+		t.Errorf("DE defaults: name %q, ip %q, country %q, flag %q", de.Name, de.IP, de.Country, de.Flag)
+	}
+	if de.Capacity != 253 {
+		t.Errorf("DE capacity %d, want 253", de.Capacity)
+	}
+
+	ke := servers[1]
+	if ke.Port != 51000 || ke.Subnet != "10.9.0.0/24" || ke.Interface != "wg1" || ke.Name != "Nairobi" {
+		t.Errorf("KE settings were overridden: %+v", ke)
+	}
+	if ke.Country != "GB" {
+		t.Errorf("KE country %q, want the alias normalised to GB", ke.Country)
+	}
+}
+
+func TestLoadFleetMetadata(t *testing.T) {
+	path := writeFile(t, "fleet.json", `{"servers": [
+		{"code": "DE", "endpoint": "de.example.com", "publicKey": "`+testKey(1)+`",
+		 "city": "Frankfurt", "tags": ["p2p", "streaming"], "features": ["ipv6"], "flag": "🏴"}
+	]}`)
+
+	servers, err := loadFleet(path, defaultsConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	de := servers[0]
+	if de.City != "Frankfurt" || strings.Join(de.Tags, ",") != "p2p,streaming" || strings.Join(de.Features, ",") != "ipv6" {
+		t.Errorf("metadata not loaded: %+v", de)
+	}
+	if de.Flag != "🏴" {
+		t.Errorf("flag %q, want the configured one kept", de.Flag)
+	}
+}
+
+func TestLoadFleetReportsEveryProblem(t *testing.T) {
+	path := writeFile(t, "fleet.json", `{"servers": [
+		{"code": "DE", "endpoint": "de.example.com", "publicKey": "`+testKey(1)+`"},
+		{"code": "DE", "endpoint": "de2.example.com", "publicKey": "`+testKey(2)+`"},
+		{"code": "FR", "publicKey": "not-a-key", "subnet": "8.8.8.0/24", "port": 70000},
+		{"endpoint": "nameless.example.com"},
+		{"code": "auto", "endpoint": "auto.example.com", "publicKey": "`+testKey(3)+`"},
+		{"code": "NL", "endpoint": "-nl.example.com", "publicKey": "`+testKey(4)+`"}
+	]}`)
+
+	_, err := loadFleet(path, defaultsConfig())
+	if err == nil {
+		t.Fatal("invalid fleet loaded")
+	}
+	for _, want := range []string{
+		"fleet server DE: duplicate code",
+		"fleet server FR: endpoint is required",
+		"fleet server FR: publicKey",
+		"fleet server FR: port",
+		`fleet server FR: subnet "8.8.8.0/24"`,
+		"fleet server #4: code is required",
+		`fleet server auto: invalid server code "auto"`,
+		`fleet server NL: invalid endpoint "-nl.example.com"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadFleetEmpty(t *testing.T) {
+	path := writeFile(t, "fleet.json", `{"servers": []}`)
+	if _, err := loadFleet(path, defaultsConfig()); err == nil || !strings.Contains(err.Error(), "defines no servers") {
+		t.Errorf("got %v, want an error for an empty fleet", err)
+	}
+}
+
+func TestSubnetCapacity(t *testing.T) {
+	tests := []struct {
+		cidr string
+		want int
+	}{
+		{"10.8.0.0/24", 253},
+		{"10.8.0.0/30", 1},
+		{"10.0.0.0/8", 1<<16 - 3},
+		{"bogus", 0},
+	}
+	for _, tt := range tests {
+		if got := SubnetCapacity(tt.cidr); got != tt.want {
+			t.Errorf("SubnetCapacity(%q) = %d, want %d", tt.cidr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"p2nova-vpn/internal/geo"
+	"p2nova-vpn/pkg/country"
+)
+
+// loadGeo builds the geo provider chain in the order given by GEO_PROVIDERS.
+// Without it the chain is static overrides, then the local database, and
+// ipinfo.io only when no database is configured.
+func loadGeo(cfg *Config, src *source) error {
+	var err error
+	if cfg.GeoIPReloadInterval, err = src.duration("GEOIP_RELOAD_INTERVAL", "1m"); err != nil {
+		return err
+	}
+	if cfg.GeoTimeout, err = src.duration("GEO_TIMEOUT", "2s"); err != nil {
+		return err
+	}
+	if cfg.GeoCacheTTL, err = src.duration("GEO_CACHE_TTL", "1h"); err != nil {
+		return err
+	}
+	if cfg.GeoNegativeTTL, err = src.duration("GEO_NEGATIVE_TTL", "5m"); err != nil {
+		return err
+	}
+	if cfg.GeoCacheSize, err = strconv.Atoi(src.get("GEO_CACHE_SIZE", "4096")); err != nil {
+		return src.invalid("GEO_CACHE_SIZE")
+	}
+
+	order := src.get("GEO_PROVIDERS", "")
+	if order == "" {
+		order = "static,mmdb"
+		if cfg.GeoIPFile == "" {
+			order += ",ipinfo"
+		}
+	}
+
+	var providers []geo.Provider
+	for _, name := range strings.Split(order, ",") {
+		switch strings.TrimSpace(name) {
+		case "static":
+			if cfg.GeoStaticFile == "" {
+				continue
+			}
+			static, err := geo.LoadStaticProvider(cfg.GeoStaticFile)
+			if err != nil {
+				return err
+			}
+			providers = append(providers, static)
+		case "mmdb":
+			if cfg.GeoIPFile == "" {
+				continue
+			}
+			db, err := geo.OpenMMDB(cfg.GeoIPFile, cfg.GeoIPASNFile)
+			if err != nil {
+				return err
+			}
+			cfg.GeoDB = db
+			providers = append(providers, db)
+		case "ipinfo":
+			providers = append(providers, geo.NewHTTPProvider(cfg.IPInfoURL, cfg.IPInfoToken))
+		default:
+			return fmt.Errorf("unknown geo provider %q in GEO_PROVIDERS (%s)", name, src.origin("GEO_PROVIDERS"))
+		}
+		cfg.GeoProviders = append(cfg.GeoProviders, strings.TrimSpace(name))
+	}
+
+	cfg.Geo = geo.NewCache(geo.NewChain(cfg.GeoTimeout, providers...), cfg.GeoCacheSize, cfg.GeoCacheTTL, cfg.GeoNegativeTTL)
+	return nil
+}
+
+// locateServers fills in missing location details of fleet servers. On
+// reload, servers already running at the same address take the details
+// from previous rather than a new lookup.
+func locateServers(cfg *Config, previous *Config) {
+	located := make(map[string]ServerConfig)
+	if previous != nil {
+		for _, srv := range previous.Servers {
+			located[srv.Code] = srv
+		}
+	}
+
+	for i := range cfg.Servers {
+		srv := &cfg.Servers[i]
+		if srv.Country != "" && srv.City != "" && (srv.Latitude != 0 || srv.Longitude != 0) {
+			continue
+		}
+
+		if prev, ok := located[srv.Code]; ok && prev.IP == srv.IP {
+			if srv.Country == "" {
+				srv.Country, srv.Flag = prev.Country, prev.Flag
+			}
+			if srv.City == "" {
+				srv.City = prev.City
+			}
+			if srv.Latitude == 0 && srv.Longitude == 0 {
+				srv.Latitude, srv.Longitude = prev.Latitude, prev.Longitude
+			}
+			continue
+		}
+
+		info, err := cfg.Geo.Lookup(context.Background(), srv.IP)
+		if err != nil {
+			continue
+		}
+
+		if srv.Country == "" {
+			srv.Country = country.Normalize(info.Country)
+			srv.Flag = country.Flag(srv.Country)
+		}
+		if srv.City == "" {
+			srv.City = info.City
+		}
+		if srv.Latitude == 0 && srv.Longitude == 0 {
+			srv.Latitude, srv.Longitude, _ = info.Coordinates()
+		}
+	}
+}
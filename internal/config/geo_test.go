@@ -0,0 +1,90 @@
+package config
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"p2nova-vpn/internal/geo"
+)
+
+// fakeGeo answers lookups from a map keyed by IP.
+type fakeGeo map[string]geo.GeoInfo
+
+func (f fakeGeo) Name() string { return "fake" }
+
+func (f fakeGeo) Lookup(ctx context.Context, ip string) (*geo.GeoInfo, error) {
+	info, ok := f[ip]
+	if !ok {
+		return nil, geo.ErrNotFound
+	}
+	return &info, nil
+}
+
+func TestLocateServers(t *testing.T) {
+	cfg := &Config{
+		Geo: fakeGeo{
+			"203.0.113.7": {Country: "ke", City: "Nairobi", Loc: "-1.29,36.82"},
+			"203.0.113.8": {Country: "DE", City: "Berlin", Loc: "52.52,13.40"},
+		},
+		Servers: []ServerConfig{
+			{Code: "KE", IP: "203.0.113.7"},
+			{Code: "DE", IP: "203.0.113.8", Country: "DE", City: "Frankfurt"},
+			{Code: "XX", IP: "198.51.100.1"},
+		},
+	}
+	locateServers(cfg, nil)
+
+	ke := cfg.Servers[0]
+	if ke.Country != "KE" || ke.Flag != "🇰🇪" || ke.City != "Nairobi" || ke.Latitude != -1.29 || ke.Longitude != 36.82 {
+		t.Errorf("KE not located: %+v", ke)
+	}
+	de := cfg.Servers[1]
+	if de.City != "Frankfurt" || de.Latitude != 52.52 {
+		t.Errorf("DE: configured details must win, missing ones be filled in: %+v", de)
+	}
+	if xx := cfg.Servers[2]; xx.Country != "" || xx.City != "" {
+		t.Errorf("XX located without a record: %+v", xx)
+	}
+}
+
+func TestLoadGeoProviders(t *testing.T) {
+	singleServerEnv(t)
+	static := writeFile(t, "geo.json", `{"192.0.2.0/24": {"country": "NL", "city": "Amsterdam", "loc": "52.37,4.90"}}`)
+	t.Setenv("GEOIP_DB", "../geo/testdata/city.mmdb")
+
+	// Without GEO_PROVIDERS the database replaces ipinfo.io
+	t.Setenv("GEO_PROVIDERS", "")
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(cfg.GeoProviders, ","); got != "mmdb" {
+		t.Errorf("default providers = %s, want mmdb", got)
+	}
+
+	t.Setenv("GEO_STATIC_FILE", static)
+	t.Setenv("GEO_PROVIDERS", "static, mmdb")
+	if cfg, err = Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(cfg.GeoProviders, ","); got != "static,mmdb" {
+		t.Errorf("providers = %s, want static,mmdb", got)
+	}
+	if srv := cfg.Servers[0]; srv.Country != "NL" || srv.City != "Amsterdam" {
+		t.Errorf("server not located by the static override: %+v", srv)
+	}
+
+	for key, value := range map[string]string{
+		"GEO_PROVIDERS":  "static,carrier-pigeon",
+		"GEO_TIMEOUT":    "soon",
+		"GEO_CACHE_SIZE": "many",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), key) {
+				t.Errorf("%s=%s: got %v", key, value, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"sync"
+	"text/template"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/pkg/envelope"
+)
+
+// Live holds the settings that can change while the server runs. Everything
+// else in Config is fixed until restart.
+type Live struct {
+	mu          sync.RWMutex
+	dnsServers  string
+	corsOrigins []string
+	plans       map[string]*domain.Plan
+	defaultPlan string
+	templates   *Templates
+	keyring     *envelope.Keyring
+}
+
+func newLive(cfg *Config) *Live {
+	l := &Live{}
+	l.Apply(cfg)
+	return l
+}
+
+// Apply takes the live settings of a freshly loaded configuration.
+func (l *Live) Apply(cfg *Config) {
+	plans := make(map[string]*domain.Plan, len(cfg.Plans))
+	for i := range cfg.Plans {
+		plans[cfg.Plans[i].Name] = &cfg.Plans[i]
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dnsServers = cfg.DNSServers
+	l.corsOrigins = cfg.CORSOrigins
+	l.plans = plans
+	l.defaultPlan = cfg.DefaultPlan
+	l.templates = cfg.Templates
+
+	// Values sealed with earlier keys must stay readable, so a reload adds
+	// keys and moves the current version but drops none until restart. A
+	// new temporary key would only make the old one unreadable.
+	switch {
+	case l.keyring == nil:
+		l.keyring = cfg.Keyring
+	case !cfg.Keyring.Ephemeral():
+		l.keyring = cfg.Keyring.Including(l.keyring)
+	}
+}
+
+func (l *Live) DNSServers() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.dnsServers
+}
+
+func (l *Live) CORSOrigins() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.corsOrigins
+}
+
+// Plan returns the named plan, or the default plan for an empty name. The
+// plan is nil when no default is configured, and ok is false when the name
+// is unknown.
+func (l *Live) Plan(name string) (plan *domain.Plan, ok bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if name == "" {
+		if l.defaultPlan == "" {
+			return nil, true
+		}
+		name = l.defaultPlan
+	}
+	plan, ok = l.plans[name]
+	return plan, ok
+}
+
+// Keyring returns the master keys for sealing data at rest.
+func (l *Live) Keyring() *envelope.Keyring {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.keyring
+}
+
+// Template returns the client config template for a server and platform.
+func (l *Live) Template(server, platform string) *template.Template {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.templates.Lookup(server, platform)
+}
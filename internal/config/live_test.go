@@ -0,0 +1,81 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"testing"
+)
+
+func TestLiveApply(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+server:
+  publicKey: `+testKey(1)+`
+  endpoint: 192.0.2.1
+geo:
+  providers: [static]
+plans:
+  - name: standard
+  - name: pro
+    overrides: [mtu]
+defaultPlan: standard
+`)
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	opts := BindFlags(fs)
+	if err := fs.Parse([]string{"--config", path}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := cfg.Live
+	if live.DNSServers() != "1.1.1.1, 8.8.8.8" || len(live.CORSOrigins()) != 1 || live.CORSOrigins()[0] != "*" {
+		t.Errorf("DNS %q, CORS origins %v", live.DNSServers(), live.CORSOrigins())
+	}
+	if plan, ok := live.Plan(""); !ok || plan == nil || plan.Name != "standard" {
+		t.Errorf("default plan = %+v, %v", plan, ok)
+	}
+	if plan, ok := live.Plan("pro"); !ok || !plan.Allows("mtu") {
+		t.Errorf("pro = %+v, %v", plan, ok)
+	}
+	if _, ok := live.Plan("gold"); ok {
+		t.Error("unknown plan found")
+	}
+
+	t.Setenv("DNS_SERVERS", "9.9.9.9")
+	t.Setenv("CORS_ORIGINS", "https://app.example, https://admin.example")
+	t.Setenv("DEFAULT_PLAN", "")
+	if err := os.WriteFile(path, []byte(`
+server:
+  publicKey: `+testKey(1)+`
+  endpoint: 192.0.2.1
+geo:
+  providers: [static]
+plans:
+  - name: standard
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	next, err := Reload(opts, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if live.DNSServers() != "1.1.1.1, 8.8.8.8" {
+		t.Error("reload changed the live settings before they were applied")
+	}
+
+	live.Apply(next)
+	if live.DNSServers() != "9.9.9.9" {
+		t.Errorf("DNS = %q after apply", live.DNSServers())
+	}
+	if origins := live.CORSOrigins(); len(origins) != 2 || origins[1] != "https://admin.example" {
+		t.Errorf("CORS origins = %v after apply", origins)
+	}
+	if plan, ok := live.Plan(""); !ok || plan != nil {
+		t.Errorf("default plan = %+v after it was removed", plan)
+	}
+	if _, ok := live.Plan("pro"); ok {
+		t.Error("removed plan still found")
+	}
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"p2nova-vpn/pkg/keystore"
+)
+
+// secretKeys are the settings that hold secrets. Their values are never
+// printed or put in error messages.
+var secretKeys = map[string]bool{
+	"SERVER_PRIVATE_KEY":  true,
+	"ADMIN_TOKEN":         true,
+	"IPINFO_TOKEN":        true,
+	"KEYSTORE_PASSPHRASE": true,
+	"ENCRYPTION_KEYS":     true,
+	"LINK_SECRET":         true,
+}
+
+// secretValue is a resolved secret and where it was found.
+type secretValue struct {
+	value  string
+	origin string
+}
+
+// loadSecrets resolves every secret, trying in order the variable itself,
+// a file named by KEY_FILE, a systemd credential named KEY in
+// $CREDENTIALS_DIRECTORY, the keystore and finally the config file.
+func (s *source) loadSecrets() {
+	s.secrets = make(map[string]secretValue)
+
+	// The passphrase unlocks the keystore, so it cannot come from it
+	s.resolveSecret("KEYSTORE_PASSPHRASE", nil)
+
+	var store map[string]string
+	if path := s.get("KEYSTORE_FILE", ""); path != "" {
+		passphrase := s.secrets["KEYSTORE_PASSPHRASE"].value
+		if passphrase == "" {
+			s.errs = append(s.errs, fmt.Errorf("KEYSTORE_FILE is set but KEYSTORE_PASSPHRASE is not"))
+		} else if opened, err := keystore.Open(path, passphrase); err != nil {
+			s.errs = append(s.errs, err)
+		} else {
+			store = opened
+			for name := range store {
+				if !secretKeys[name] || name == "KEYSTORE_PASSPHRASE" {
+					s.errs = append(s.errs, fmt.Errorf("keystore %s holds unknown secret %s", path, name))
+				}
+			}
+		}
+	}
+
+	for key := range secretKeys {
+		if key != "KEYSTORE_PASSPHRASE" {
+			s.resolveSecret(key, store)
+		}
+	}
+}
+
+func (s *source) resolveSecret(key string, store map[string]string) {
+	if value := os.Getenv(key); value != "" {
+		s.secrets[key] = secretValue{value, "env " + key}
+		return
+	}
+
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		s.readSecret(key, path, "env "+key+"_FILE")
+		return
+	}
+
+	if dir := os.Getenv("CREDENTIALS_DIRECTORY"); dir != "" {
+		path := filepath.Join(dir, key)
+		if _, err := os.Stat(path); err == nil {
+			s.readSecret(key, path, "credential "+key)
+			return
+		}
+	}
+
+	if value, ok := store[key]; ok {
+		s.secrets[key] = secretValue{value, "keystore"}
+		return
+	}
+
+	if value, ok := s.file.values[key]; ok {
+		s.secrets[key] = secretValue{value.value, fmt.Sprintf("%s:%d", s.fileName, value.line)}
+	}
+}
+
+func (s *source) readSecret(key, path, origin string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// The error names the path, never the contents
+		s.errs = append(s.errs, fmt.Errorf("failed to read %s (%s): %w", key, origin, err))
+		return
+	}
+	s.secrets[key] = secretValue{strings.TrimSpace(string(data)), origin}
+}
+
+// secretOrigins lists where each configured secret came from, for the
+// startup printout.
+func (s *source) secretOrigins() []string {
+	var origins []string
+	for key, secret := range s.secrets {
+		if secret.value != "" {
+			origins = append(origins, fmt.Sprintf("%s (%s)", key, secret.origin))
+		}
+	}
+	sort.Strings(origins)
+	return origins
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"p2nova-vpn/pkg/keystore"
+)
+
+// captureStdout returns what fn prints.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	fn()
+	w.Close()
+	out, _ := io.ReadAll(r)
+	return string(out)
+}
+
+func TestSecretSources(t *testing.T) {
+	dir := t.TempDir()
+	store := filepath.Join(dir, "keystore.json")
+	if err := keystore.Save(store, "passphrase", map[string]string{
+		"ADMIN_TOKEN": "from-keystore",
+		"LINK_SECRET": "link-from-keystore",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	creds := filepath.Join(dir, "credentials")
+	if err := os.Mkdir(creds, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeSecret := func(path, value string) {
+		if err := os.WriteFile(path, []byte(value+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := writeFile(t, "config.yaml", "adminToken: from-file\nkeystoreFile: "+store+"\n")
+
+	singleServerEnv(t)
+	t.Setenv("KEYSTORE_PASSPHRASE", "passphrase")
+	t.Setenv("CREDENTIALS_DIRECTORY", creds)
+
+	token := func() (string, string) {
+		t.Helper()
+		src, err := newSource(&Options{File: file})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(src.errs) > 0 {
+			t.Fatal(src.errs)
+		}
+		return src.get("ADMIN_TOKEN", ""), src.origin("ADMIN_TOKEN")
+	}
+	check := func(wantValue, wantOrigin string) {
+		t.Helper()
+		if value, origin := token(); value != wantValue || origin != wantOrigin {
+			t.Errorf("ADMIN_TOKEN = %q from %s, want %q from %s", value, origin, wantValue, wantOrigin)
+		}
+	}
+
+	check("from-keystore", "keystore")
+
+	writeSecret(filepath.Join(creds, "ADMIN_TOKEN"), "from-credential")
+	check("from-credential", "credential ADMIN_TOKEN")
+
+	tokenFile := filepath.Join(dir, "admin-token")
+	writeSecret(tokenFile, "from-secret-file")
+	t.Setenv("ADMIN_TOKEN_FILE", tokenFile)
+	check("from-secret-file", "env ADMIN_TOKEN_FILE")
+
+	t.Setenv("ADMIN_TOKEN", "from-env")
+	check("from-env", "env ADMIN_TOKEN")
+
+	// Without the keystore the config file is the last resort
+	os.Unsetenv("ADMIN_TOKEN")
+	os.Unsetenv("ADMIN_TOKEN_FILE")
+	os.Remove(filepath.Join(creds, "ADMIN_TOKEN"))
+	file = writeFile(t, "plain.yaml", "adminToken: from-file\n")
+	check("from-file", file+":1")
+}
+
+func TestSecretErrors(t *testing.T) {
+	dir := t.TempDir()
+	store := filepath.Join(dir, "keystore.json")
+	if err := keystore.Save(store, "passphrase", map[string]string{"PORT": "9000"}); err != nil {
+		t.Fatal(err)
+	}
+	singleServerEnv(t)
+
+	t.Setenv("KEYSTORE_FILE", store)
+	_, err := Load(nil)
+	if err == nil || !strings.Contains(err.Error(), "KEYSTORE_FILE is set but KEYSTORE_PASSPHRASE is not") {
+		t.Errorf("missing passphrase: got %v", err)
+	}
+
+	t.Setenv("KEYSTORE_PASSPHRASE", "wrong")
+	if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), keystore.ErrWrongPassphrase.Error()) {
+		t.Errorf("wrong passphrase: got %v", err)
+	}
+
+	t.Setenv("KEYSTORE_PASSPHRASE", "passphrase")
+	if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "holds unknown secret PORT") {
+		t.Errorf("non-secret in keystore: got %v", err)
+	}
+
+	os.Unsetenv("KEYSTORE_FILE")
+	t.Setenv("ADMIN_TOKEN_FILE", filepath.Join(dir, "missing"))
+	if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "failed to read ADMIN_TOKEN (env ADMIN_TOKEN_FILE)") {
+		t.Errorf("missing secret file: got %v", err)
+	}
+}
+
+func TestSecretsNeverPrinted(t *testing.T) {
+	private := testKey(7)
+	singleServerEnv(t)
+	t.Setenv("SERVER_PRIVATE_KEY", private)
+	t.Setenv("ADMIN_TOKEN", "admin-token-value")
+	t.Setenv("LINK_SECRET", "link-secret-value")
+
+	// Mismatched keys: the error names the variables, not their values
+	_, err := Load(nil)
+	if err == nil {
+		t.Fatal("mismatched key pair accepted")
+	}
+	if strings.Contains(err.Error(), private) {
+		t.Errorf("error reveals SERVER_PRIVATE_KEY:\n%v", err)
+	}
+
+	t.Setenv("SERVER_PRIVATE_KEY", "")
+	t.Setenv("LINK_TTL", "soon")
+	if _, err := Load(nil); err == nil || strings.Contains(err.Error(), "link-secret-value") {
+		t.Errorf("invalid settings: got %v", err)
+	}
+	t.Setenv("LINK_TTL", "")
+
+	out := captureStdout(t, func() {
+		if _, err := Load(nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if strings.Contains(out, "admin-token-value") || strings.Contains(out, "link-secret-value") {
+		t.Errorf("startup printout reveals a secret:\n%s", out)
+	}
+	if !strings.Contains(out, "Secrets: ADMIN_TOKEN (env ADMIN_TOKEN), LINK_SECRET (env LINK_SECRET)") {
+		t.Errorf("startup printout does not list the secrets' origins:\n%s", out)
+	}
+}
+
+// The sample vpn.env loads once the operator adds a public key, and sets
+// no secret itself.
+func TestSampleEnv(t *testing.T) {
+	data, err := os.ReadFile("../../vpn.env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		if secretKeys[strings.TrimSuffix(key, "_FILE")] {
+			t.Errorf("vpn.env sets %s", key)
+		}
+		t.Setenv(key, value)
+	}
+	t.Setenv("SERVER_PUBLIC_KEY", testKey(1))
+	t.Setenv("GEO_PROVIDERS", "static")
+
+	if _, err := Load(nil); err != nil {
+		t.Errorf("vpn.env does not load: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Options selects the configuration file and carries command-line
+// overrides, keyed by the environment variable they replace.
+type Options struct {
+	File  string
+	Flags map[string]string
+}
+
+// flagKeys maps command-line flags to the settings they override. Secrets
+// are deliberately left out so they never end up in a process listing.
+var flagKeys = []struct {
+	name, key, usage string
+}{
+	{"port", "PORT", "HTTP listen port"},
+	{"endpoint", "SERVER_ENDPOINT", "public endpoint of the single server"},
+	{"wg-interface", "WG_INTERFACE", "default WireGuard interface"},
+	{"wg-port", "WG_PORT", "default WireGuard port"},
+	{"subnet", "VPN_SUBNET", "default client subnet"},
+	{"dns", "DNS_SERVERS", "comma separated DNS servers handed to clients"},
+	{"fleet", "FLEET_FILE", "JSON fleet definition"},
+	{"server-store", "SERVER_STORE_FILE", "file the server registry is persisted to"},
+	{"trusted-proxies", "TRUSTED_PROXIES", "comma separated trusted proxy CIDRs"},
+	{"trusted-proxy-header", "TRUSTED_PROXY_HEADER", "header the trusted proxies set, X-Forwarded-For or Forwarded"},
+	{"health-check-interval", "HEALTH_CHECK_INTERVAL", "server health check interval"},
+	{"geoip-db", "GEOIP_DB", "MaxMind City database"},
+	{"cors-origins", "CORS_ORIGINS", "comma separated origins allowed by CORS, * for any"},
+	{"log-level", "LOG_LEVEL", "debug, info, warn or error"},
+	{"templates-dir", "TEMPLATES_DIR", "directory of client config templates"},
+}
+
+// BindFlags registers --config and the override flags on fs. Only flags
+// that are actually passed override the file and the environment.
+func BindFlags(fs *flag.FlagSet) *Options {
+	opts := &Options{Flags: make(map[string]string)}
+
+	fs.StringVar(&opts.File, "config", os.Getenv("CONFIG_FILE"), "YAML configuration file")
+	for _, f := range flagKeys {
+		key := f.key
+		fs.Func(f.name, f.usage, func(value string) error {
+			opts.Flags[key] = value
+			return nil
+		})
+	}
+	return opts
+}
+
+// source resolves settings from flags, then the environment, then the
+// configuration file.
+type source struct {
+	file     *configFile
+	fileName string
+	flags    map[string]string
+	secrets  map[string]secretValue
+
+	// errs collects problems found while resolving secrets
+	errs []error
+}
+
+func newSource(opts *Options) (*source, error) {
+	src := &source{file: &configFile{}}
+	if opts != nil {
+		src.flags = opts.Flags
+		if opts.File != "" {
+			file, err := readFile(opts.File)
+			if err != nil {
+				return nil, err
+			}
+			src.file = file
+			src.fileName = opts.File
+		}
+	}
+
+	src.loadSecrets()
+	return src, nil
+}
+
+func (s *source) get(key, defaultValue string) string {
+	if secretKeys[key] {
+		if secret := s.secrets[key]; secret.value != "" {
+			return secret.value
+		}
+		return defaultValue
+	}
+
+	if value, ok := s.flags[key]; ok {
+		return value
+	}
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	if value, ok := s.file.values[key]; ok {
+		return value.value
+	}
+	return defaultValue
+}
+
+// origin describes where a setting came from, for error messages.
+func (s *source) origin(key string) string {
+	if secret, ok := s.secrets[key]; ok {
+		return secret.origin
+	}
+	if _, ok := s.flags[key]; ok {
+		return "flag"
+	}
+	if os.Getenv(key) != "" {
+		return "env " + key
+	}
+	if value, ok := s.file.values[key]; ok {
+		return fmt.Sprintf("%s:%d", s.fileName, value.line)
+	}
+	return "default"
+}
+
+// invalid reports a setting whose value could not be used. Secret values
+// are left out.
+func (s *source) invalid(key string) error {
+	if secretKeys[key] {
+		return fmt.Errorf("invalid %s (%s)", key, s.origin(key))
+	}
+	return fmt.Errorf("invalid %s %q (%s)", key, s.get(key, ""), s.origin(key))
+}
+
+func (s *source) duration(key, defaultValue string) (time.Duration, error) {
+	d, err := time.ParseDuration(s.get(key, defaultValue))
+	if err != nil || d <= 0 {
+		return 0, s.invalid(key)
+	}
+	return d, nil
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"p2nova-vpn/internal/domain"
+)
+
+// DefaultTemplate renders a standard wg-quick config. It is used unless the
+// template directory provides another.
+const DefaultTemplate = `[Interface]
+PrivateKey = {{.PrivateKey}}
+Address = {{.Address}}
+DNS = {{join .DNS ", "}}
+MTU = {{.MTU}}
+
+[Peer]
+PublicKey = {{.PublicKey}}
+Endpoint = {{.Endpoint}}
+AllowedIPs = {{join .AllowedIPs ", "}}
+{{- if .PersistentKeepalive}}
+PersistentKeepalive = {{.PersistentKeepalive}}
+{{- end}}`
+
+// templateName matches the files of a template directory:
+//
+//	default.tmpl            replaces the built-in template
+//	platform-<name>.tmpl    for clients on a platform, e.g. platform-linux.tmpl
+//	server-<code>.tmpl      for a server, with its code as configured
+//	server-<code>-<name>.tmpl for a server and platform
+//
+// Codes may contain hyphens, so server-eu-west.tmpl reads as server eu-west
+// or as server eu on platform west. Lookup builds the exact names for the
+// server and platform asked for, so it serves whichever of them it is.
+var templateName = regexp.MustCompile(`^(default|platform-[a-z0-9]+|server-` + domain.ServerCodeSyntax + `(-[a-z0-9]+)?)\.tmpl$`)
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// Templates holds the client config templates, keyed by file name without
+// the extension.
+type Templates struct {
+	byName map[string]*template.Template
+}
+
+// sampleData exercises every field when templates are checked at load time.
+var sampleData = domain.TemplateData{
+	TunnelConfig: &domain.TunnelConfig{
+		PrivateKey:          "cHJpdmF0ZS1rZXktcHJpdmF0ZS1rZXktcHJpdmF0ZQ==",
+		Address:             "10.8.0.2/32",
+		DNS:                 []string{"1.1.1.1"},
+		MTU:                 1420,
+		PublicKey:           "cHVibGljLWtleS1wdWJsaWMta2V5LXB1YmxpYy1rZQ==",
+		Endpoint:            "203.0.113.10:51820",
+		AllowedIPs:          []string{"0.0.0.0/0", "::/0"},
+		PersistentKeepalive: 25,
+	},
+	ClientIP: "10.8.0.2",
+	Server:   domain.TemplateServer{Code: "KE", Name: "Nairobi VPN", Country: "KE", City: "Nairobi"},
+	Platform: "linux",
+}
+
+// loadTemplates parses every template in dir and renders it against sample
+// data, so mistakes such as unknown fields surface at startup.
+func loadTemplates(dir string) (*Templates, error) {
+	t := &Templates{byName: make(map[string]*template.Template)}
+
+	builtin := template.Must(template.New("builtin").Funcs(templateFuncs).Option("missingkey=error").Parse(DefaultTemplate))
+	t.byName["default"] = builtin
+	if dir == "" {
+		return t, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template directory: %w", err)
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if !templateName.MatchString(entry.Name()) {
+			errs = append(errs, fmt.Errorf("template %s: unexpected file name, see TEMPLATES_DIR", entry.Name()))
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		text, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		tmpl, err := template.New(entry.Name()).Funcs(templateFuncs).Option("missingkey=error").Parse(string(text))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := tmpl.Execute(io.Discard, sampleData); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		t.byName[strings.TrimSuffix(entry.Name(), ".tmpl")] = tmpl
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid templates in %s:\n%w", dir, errors.Join(errs...))
+	}
+	return t, nil
+}
+
+// Lookup returns the most specific template for a server and platform:
+// server and platform, then server, then platform, then the default.
+func (t *Templates) Lookup(server, platform string) *template.Template {
+	var names []string
+	if platform != "" {
+		names = append(names, "server-"+server+"-"+platform)
+	}
+	names = append(names, "server-"+server)
+	if platform != "" {
+		names = append(names, "platform-"+platform)
+	}
+
+	for _, name := range names {
+		if tmpl, ok := t.byName[name]; ok {
+			return tmpl
+		}
+	}
+	return t.byName["default"]
+}
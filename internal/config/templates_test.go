@@ -0,0 +1,114 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// templateDir writes a template directory with the given files.
+func templateDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadTemplatesNames(t *testing.T) {
+	files := make(map[string]string)
+	for _, name := range []string{
+		"default.tmpl",
+		"platform-linux.tmpl",
+		"server-DE.tmpl",
+		"server-de.tmpl",
+		"server-lab_1.tmpl",
+		"server-eu-west.tmpl",
+		"server-eu-west-ios.tmpl",
+	} {
+		files[name] = "# " + strings.TrimSuffix(name, ".tmpl") + "\n{{.Address}}"
+	}
+
+	templates, err := loadTemplates(templateDir(t, files))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		server, platform, want string
+	}{
+		{"DE", "", "server-DE"},
+		{"de", "linux", "server-de"},
+		{"lab_1", "", "server-lab_1"},
+		{"eu-west", "", "server-eu-west"},
+		{"eu-west", "ios", "server-eu-west-ios"},
+		{"eu-west", "android", "server-eu-west"},
+		{"FR", "linux", "platform-linux"},
+		{"FR", "ios", "default"},
+		{"FR", "", "default"},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		if err := templates.Lookup(tt.server, tt.platform).Execute(&out, sampleData); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimPrefix(strings.SplitN(out.String(), "\n", 2)[0], "# "); got != tt.want {
+			t.Errorf("%s on %q: got template %s, want %s", tt.server, tt.platform, got, tt.want)
+		}
+	}
+}
+
+func TestLoadTemplatesRejects(t *testing.T) {
+	tests := map[string]string{
+		"notes.txt":         "hello",
+		"server-.tmpl":      "{{.Address}}",
+		"server-_lab.tmpl":  "{{.Address}}",
+		"platform-iOS.tmpl": "{{.Address}}",
+		"server-DE.tmpl":    "{{.Address",
+		"server-FR.tmpl":    "{{.Gateway}}",
+		"platform-mac.tmpl": "{{.Server.Region}}",
+		"server-" + strings.Repeat("A", 33) + ".tmpl": "{{.Address}}",
+	}
+	for name, text := range tests {
+		if _, err := loadTemplates(templateDir(t, map[string]string{name: text})); err == nil {
+			t.Errorf("%s with %q accepted", name, text)
+		}
+	}
+
+	// Every problem is reported at once
+	_, err := loadTemplates(templateDir(t, map[string]string{"server-DE.tmpl": "{{.Gateway}}", "extra.conf": ""}))
+	if err == nil || !strings.Contains(err.Error(), "server-DE.tmpl") || !strings.Contains(err.Error(), "extra.conf: unexpected file name") {
+		t.Errorf("got %v", err)
+	}
+
+	if _, err := loadTemplates(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("missing directory accepted")
+	}
+}
+
+func TestDefaultTemplate(t *testing.T) {
+	templates, err := loadTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := templates.Lookup("KE", "linux").Execute(&out, sampleData); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Address = 10.8.0.2/32\n",
+		"DNS = 1.1.1.1\n",
+		"MTU = 1420\n",
+		"Endpoint = 203.0.113.10:51820\n",
+		"AllowedIPs = 0.0.0.0/0, ::/0\n",
+		"PersistentKeepalive = 25",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("default config lacks %q:\n%s", want, out.String())
+		}
+	}
+}
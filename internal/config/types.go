@@ -1,5 +1,15 @@
 package config
 
+import (
+	"net"
+	"time"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/internal/geo"
+	"p2nova-vpn/internal/logging"
+	"p2nova-vpn/pkg/envelope"
+)
+
 type Config struct {
 	Port             string
 	ServerPublicKey  string
@@ -9,12 +19,70 @@ type Config struct {
 	WGPort           string
 	VPNSubnet        string
 	DNSServers       string
+	FleetFile        string
+	ServerStoreFile  string
+	AdminToken       string
+	TrustedProxies   []*net.IPNet
+	ForwardedHeader  string
+	CORSOrigins      []string
+	LogLevel         logging.Level
+	Plans            []domain.Plan
+	DefaultPlan      string
+	TemplatesDir     string
+	Templates        *Templates
+	Keyring          *envelope.Keyring
+	LinkSecret       string
+	LinkTTL          time.Duration
 	Servers          []ServerConfig
+
+	// Live carries the settings that hot reload may change
+	Live *Live
+
+	HealthCheckInterval time.Duration
+
+	// Geo lookups go through a cached chain of providers
+	GeoProviders        []string
+	GeoTimeout          time.Duration
+	GeoCacheSize        int
+	GeoCacheTTL         time.Duration
+	GeoNegativeTTL      time.Duration
+	GeoStaticFile       string
+	GeoIPFile           string
+	GeoIPASNFile        string
+	GeoIPReloadInterval time.Duration
+	IPInfoURL           string
+	IPInfoToken         string
+	GeoDB               *geo.MMDB
+	Geo                 geo.Provider
+
+	// mTLS material used to call node agents
+	AgentCAFile   string
+	AgentCertFile string
+	AgentKeyFile  string
 }
 
+// ServerConfig describes a single VPN node. Each node terminates tunnels on
+// its own endpoint and WireGuard interface, with its own key and subnet.
 type ServerConfig struct {
-	Code string
-	Name string
-	IP   string
-	Flag string
+	Code      string   `json:"code" yaml:"code"`
+	Name      string   `json:"name" yaml:"name"`
+	IP        string   `json:"ip" yaml:"ip"`
+	Flag      string   `json:"flag" yaml:"flag"`
+	Endpoint  string   `json:"endpoint" yaml:"endpoint"`
+	Port      int      `json:"port" yaml:"port"`
+	PublicKey string   `json:"publicKey" yaml:"publicKey"`
+	Subnet    string   `json:"subnet" yaml:"subnet"`
+	Interface string   `json:"interface" yaml:"interface"`
+	Agent     string   `json:"agent" yaml:"agent"`         // e.g. https://10.0.0.5:7443, empty for the local interface
+	CanaryKey string   `json:"canaryKey" yaml:"canaryKey"` // public key of a canary peer kept connected to the node
+	Country   string   `json:"country" yaml:"country"`
+	City      string   `json:"city" yaml:"city"`
+	Tags      []string `json:"tags" yaml:"tags"`         // e.g. p2p, streaming
+	Features  []string `json:"features" yaml:"features"` // protocol features, e.g. ipv6
+	Latitude  float64  `json:"latitude" yaml:"latitude"`
+	Longitude float64  `json:"longitude" yaml:"longitude"`
+	Capacity  int      `json:"capacity" yaml:"capacity"` // maximum concurrent peers, defaults to the subnet size
+
+	// Tunnel sets client tunnel parameters for this server
+	Tunnel domain.TunnelParams `json:"tunnel" yaml:"tunnel"`
 }
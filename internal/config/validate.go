@@ -0,0 +1,171 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/pkg/wireguard"
+)
+
+// validate checks the global settings. Fleet servers are checked as they are
+// prepared, so that errors can point at their entry.
+func validate(cfg *Config, src *source) []error {
+	var errs []error
+	fail := func(key string, err error) {
+		errs = append(errs, fmt.Errorf("%w: %v", src.invalid(key), err))
+	}
+
+	if err := checkPortString(cfg.Port); err != nil {
+		fail("PORT", err)
+	}
+	if err := checkPortString(cfg.WGPort); err != nil {
+		fail("WG_PORT", err)
+	}
+	if err := checkPrivateSubnet(cfg.VPNSubnet); err != nil {
+		fail("VPN_SUBNET", err)
+	}
+
+	for _, dns := range strings.Split(cfg.DNSServers, ",") {
+		if dns = strings.TrimSpace(dns); net.ParseIP(dns) == nil {
+			fail("DNS_SERVERS", fmt.Errorf("%q is not an IP address", dns))
+		}
+	}
+
+	var publicOK bool
+	if cfg.ServerPublicKey != "" {
+		_, err := wireguard.ParseKey(cfg.ServerPublicKey)
+		if err != nil {
+			fail("SERVER_PUBLIC_KEY", err)
+		}
+		publicOK = err == nil
+	}
+
+	if cfg.ServerPrivateKey != "" {
+		derived, err := wireguard.PublicKey(cfg.ServerPrivateKey)
+		switch {
+		case err != nil:
+			fail("SERVER_PRIVATE_KEY", err)
+		case publicOK && derived != cfg.ServerPublicKey:
+			errs = append(errs, fmt.Errorf("SERVER_PUBLIC_KEY (%s) does not belong to SERVER_PRIVATE_KEY (%s): the private key's public key is %s",
+				src.origin("SERVER_PUBLIC_KEY"), src.origin("SERVER_PRIVATE_KEY"), derived))
+		}
+	}
+
+	for _, srv := range cfg.Servers {
+		if srv.Agent != "" && (cfg.AgentCAFile == "" || cfg.AgentCertFile == "" || cfg.AgentKeyFile == "") {
+			errs = append(errs, fmt.Errorf("server %s uses an agent: AGENT_CA_FILE, AGENT_CERT_FILE and AGENT_KEY_FILE are required", srv.Code))
+		}
+	}
+
+	return errs
+}
+
+// checkPlans validates the plans and the default plan. position gives the
+// location of a plan in the config file.
+func checkPlans(cfg *Config, position func(i int) string) []error {
+	var errs []error
+	seen := make(map[string]bool)
+
+	for i, plan := range cfg.Plans {
+		fail := func(err error) {
+			errs = append(errs, fmt.Errorf("%s: plan %s: %w", position(i), plan.Name, err))
+		}
+
+		if plan.Name == "" {
+			fail(fmt.Errorf("name is required"))
+		} else if seen[plan.Name] {
+			fail(fmt.Errorf("duplicate name"))
+		}
+		seen[plan.Name] = true
+
+		if err := plan.Tunnel.Validate(); err != nil {
+			fail(err)
+		}
+		for _, param := range plan.Overrides {
+			if !domain.IsTunnelParam(param) {
+				fail(fmt.Errorf("overrides: unknown parameter %q", param))
+			}
+		}
+	}
+
+	if cfg.DefaultPlan != "" && !seen[cfg.DefaultPlan] {
+		errs = append(errs, fmt.Errorf("DEFAULT_PLAN: no plan named %q", cfg.DefaultPlan))
+	}
+	return errs
+}
+
+func checkPortString(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("not a number")
+	}
+	return checkPort(n)
+}
+
+func checkPort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("%d is out of range 1-65535", port)
+	}
+	return nil
+}
+
+var (
+	serverCodePattern = regexp.MustCompile(`^` + domain.ServerCodeSyntax + `$`)
+	hostnamePattern   = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?\.)*[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+)
+
+// CheckServer validates the code, endpoint and WireGuard settings of a
+// server, wherever it is defined: the fleet file, the config file or the
+// admin API.
+func CheckServer(code, endpoint string, port int, subnet, publicKey, canaryKey string) []error {
+	var errs []error
+	// Selection strategies share the namespace of server codes
+	if !serverCodePattern.MatchString(code) || domain.IsStrategy(code) || code == domain.StrategyManual {
+		errs = append(errs, fmt.Errorf("invalid server code %q", code))
+	}
+	if endpoint == "" {
+		errs = append(errs, fmt.Errorf("endpoint is required"))
+	} else if net.ParseIP(endpoint) == nil && (len(endpoint) > 253 || !hostnamePattern.MatchString(endpoint)) {
+		errs = append(errs, fmt.Errorf("invalid endpoint %q", endpoint))
+	}
+	if err := checkPort(port); err != nil {
+		errs = append(errs, fmt.Errorf("port: %v", err))
+	}
+	if err := checkPrivateSubnet(subnet); err != nil {
+		errs = append(errs, fmt.Errorf("subnet %q: %v", subnet, err))
+	}
+	if publicKey == "" {
+		errs = append(errs, fmt.Errorf("publicKey is required"))
+	} else if _, err := wireguard.ParseKey(publicKey); err != nil {
+		errs = append(errs, fmt.Errorf("publicKey: %v", err))
+	}
+	if canaryKey != "" {
+		if _, err := wireguard.ParseKey(canaryKey); err != nil {
+			errs = append(errs, fmt.Errorf("canaryKey: %v", err))
+		}
+	}
+	return errs
+}
+
+// checkPrivateSubnet requires a CIDR that lies entirely in private address
+// space, so client addresses never collide with public hosts.
+func checkPrivateSubnet(cidr string) error {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("not a CIDR")
+	}
+
+	first := network.IP
+	last := make(net.IP, len(first))
+	for i := range first {
+		last[i] = first[i] | ^network.Mask[i]
+	}
+	if !first.IsPrivate() || !last.IsPrivate() {
+		return fmt.Errorf("%s is not a private range", network)
+	}
+	return nil
+}
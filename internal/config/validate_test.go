@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/pkg/wireguard"
+)
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	singleServerEnv(t)
+	t.Setenv("PORT", "http")
+	t.Setenv("WG_PORT", "70000")
+	t.Setenv("VPN_SUBNET", "8.8.8.0/24")
+	t.Setenv("DNS_SERVERS", "1.1.1.1, dns.example")
+	t.Setenv("SERVER_PUBLIC_KEY", "c2hvcnQ=")
+
+	_, err := Load(nil)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		`invalid PORT "http" (env PORT): not a number`,
+		`invalid WG_PORT "70000" (env WG_PORT): 70000 is out of range 1-65535`,
+		`invalid VPN_SUBNET "8.8.8.0/24" (env VPN_SUBNET): 8.8.8.0/24 is not a private range`,
+		`"dns.example" is not an IP address`,
+		`invalid SERVER_PUBLIC_KEY`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not report %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestValidateSingleServerRequired(t *testing.T) {
+	t.Setenv("GEO_PROVIDERS", "static")
+	_, err := Load(nil)
+	if err == nil || !strings.Contains(err.Error(), "SERVER_PUBLIC_KEY (server.publicKey) is required") ||
+		!strings.Contains(err.Error(), "SERVER_ENDPOINT (server.endpoint) is required") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestValidateKeyPair(t *testing.T) {
+	private := testKey(7)
+	public, err := wireguard.PublicKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	singleServerEnv(t)
+	t.Setenv("SERVER_PUBLIC_KEY", public)
+	t.Setenv("SERVER_PRIVATE_KEY", private)
+	if _, err := Load(nil); err != nil {
+		t.Fatalf("matching key pair: %v", err)
+	}
+
+	t.Setenv("SERVER_PUBLIC_KEY", testKey(1))
+	_, err = Load(nil)
+	if err == nil || !strings.Contains(err.Error(), "SERVER_PUBLIC_KEY (env SERVER_PUBLIC_KEY) does not belong to SERVER_PRIVATE_KEY") ||
+		!strings.Contains(err.Error(), public) {
+		t.Errorf("mismatched key pair: got %v", err)
+	}
+	if strings.Contains(err.Error(), private) {
+		t.Error("error reveals the private key")
+	}
+
+	t.Setenv("SERVER_PRIVATE_KEY", "bm90IGEga2V5")
+	if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "invalid SERVER_PRIVATE_KEY (env SERVER_PRIVATE_KEY)") {
+		t.Errorf("malformed private key: got %v", err)
+	}
+}
+
+func TestCheckPrivateSubnet(t *testing.T) {
+	tests := map[string]bool{
+		"10.8.0.0/24":    true,
+		"172.16.5.0/24":  true,
+		"192.168.0.0/16": true,
+		"fd00:8::/64":    true,
+		"8.8.8.0/24":     false,
+		"10.0.0.0/7":     false, // runs past 10.255.255.255
+		"172.16.0.0/11":  false,
+		"10.8.0.0":       false,
+	}
+	for cidr, ok := range tests {
+		if err := checkPrivateSubnet(cidr); (err == nil) != ok {
+			t.Errorf("checkPrivateSubnet(%s) = %v", cidr, err)
+		}
+	}
+}
+
+func TestCheckServer(t *testing.T) {
+	if errs := CheckServer("DE", "de.example.com", 51820, "10.8.0.0/24", testKey(1), ""); len(errs) != 0 {
+		t.Errorf("valid server: %v", errs)
+	}
+
+	errs := CheckServer("a b", "bad_host!", 0, "8.8.8.0/24", "", "nope")
+	if len(errs) != 6 {
+		t.Fatalf("got %d errors, want all six problems: %v", len(errs), errs)
+	}
+	for i, want := range []string{"invalid server code", "invalid endpoint", "port", "subnet", "publicKey is required", "canaryKey"} {
+		if !strings.Contains(errs[i].Error(), want) {
+			t.Errorf("error %d = %v, want one about %s", i, errs[i], want)
+		}
+	}
+
+	for _, code := range []string{"auto", "fastest", "manual"} {
+		errs := CheckServer(code, "192.0.2.1", 51820, "10.8.0.0/24", testKey(1), "")
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), "invalid server code") {
+			t.Errorf("strategy %q as a code: %v", code, errs)
+		}
+	}
+}
+
+func TestCheckPlans(t *testing.T) {
+	cfg := &Config{
+		Plans: []domain.Plan{
+			{Name: "free"},
+			{Name: "free"},
+			{Tunnel: domain.TunnelParams{MTU: 9000}},
+			{Name: "pro", Overrides: []string{"mtu", "endpoint"}},
+		},
+		DefaultPlan: "gold",
+	}
+	errs := checkPlans(cfg, func(i int) string { return fmt.Sprintf("plans[%d]", i) })
+	got := errors.Join(errs...).Error()
+	for _, want := range []string{
+		"plans[1]: plan free: duplicate name",
+		"plans[2]: plan : name is required",
+		"plans[2]: plan : mtu: 9000 is out of range 1280-1500",
+		`plans[3]: plan pro: overrides: unknown parameter "endpoint"`,
+		`DEFAULT_PLAN: no plan named "gold"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%q not reported:\n%s", want, got)
+		}
+	}
+	if len(errs) != 5 {
+		t.Errorf("got %d problems, want 5:\n%s", len(errs), got)
+	}
+
+	cfg.Plans, cfg.DefaultPlan = cfg.Plans[:1], "free"
+	if errs := checkPlans(cfg, func(int) string { return "" }); len(errs) != 0 {
+		t.Errorf("valid plans: %v", errs)
+	}
+}
@@ -0,0 +1,14 @@
+package domain
+
+// Client describes the caller of a request as far as it can be located.
+type Client struct {
+	IP        string  `json:"ip"`
+	Country   string  `json:"country,omitempty"`
+	Region    string  `json:"region,omitempty"`
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+}
+
+func (c *Client) Located() bool {
+	return c != nil && c.Country != ""
+}
@@ -1,12 +1,85 @@
 package domain
 
-import "errors"
+// Kind classifies an error for API clients; the handlers map each kind to
+// an HTTP status.
+type Kind int
+
+const (
+	KindInternal     Kind = iota // 500
+	KindMalformed                // 400: the request could not be parsed
+	KindInvalid                  // 422: the request was understood but is not acceptable
+	KindNotFound                 // 404
+	KindConflict                 // 409: the current state does not allow it
+	KindGone                     // 410: the thing asked for existed but has ended
+	KindRateLimited              // 429
+	KindUnavailable              // 503: try again later or elsewhere
+	KindUnauthorized             // 401: missing or wrong credentials
+	KindForbidden                // 403: no credentials would do
+)
+
+// Error is a domain error with a stable code for API clients. Errors are
+// compared by identity, so wrapping them with fmt.Errorf("%w: ...") keeps
+// both errors.Is and the code.
+type Error struct {
+	Code    string
+	Kind    Kind
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// errorCodes lists the code of every domain error, in declaration order.
+var errorCodes []string
+
+func newError(code string, kind Kind, message string) *Error {
+	errorCodes = append(errorCodes, code)
+	return &Error{Code: code, Kind: kind, Message: message}
+}
+
+// ErrorCodes returns the codes of every domain error, which the API
+// description lists for clients.
+func ErrorCodes() []string {
+	return append([]string(nil), errorCodes...)
+}
 
 var (
-	ErrServerNotFound   = errors.New("server not found")
-	ErrSessionNotFound  = errors.New("session not found")
-	ErrInvalidRequest   = errors.New("invalid request")
-	ErrWireGuardFailed  = errors.New("wireguard operation failed")
-	ErrNotConnected     = errors.New("not connected")
-	ErrAlreadyConnected = errors.New("already connected")
+	ErrInternal             = newError("internal_error", KindInternal, "internal error")
+	ErrServerNotFound       = newError("server_not_found", KindNotFound, "server not found")
+	ErrServerDown           = newError("server_down", KindUnavailable, "server is down")
+	ErrNoServerAvailable    = newError("no_server_available", KindUnavailable, "no server available")
+	ErrServerExists         = newError("server_exists", KindConflict, "server already exists")
+	ErrServerHasSessions    = newError("server_has_sessions", KindConflict, "server has active sessions")
+	ErrServerDraining       = newError("server_draining", KindUnavailable, "server is draining")
+	ErrServerMaintenance    = newError("server_maintenance", KindUnavailable, "server is in maintenance")
+	ErrSessionNotFound      = newError("session_not_found", KindNotFound, "session not found")
+	ErrUnauthorized         = newError("unauthorized", KindUnauthorized, "missing or invalid token")
+	ErrAdminDisabled        = newError("forbidden", KindForbidden, "admin API disabled")
+	ErrMalformedRequest     = newError("malformed_request", KindMalformed, "malformed request")
+	ErrInvalidRequest       = newError("invalid_request", KindInvalid, "invalid request")
+	ErrWireGuardFailed      = newError("wireguard_failed", KindUnavailable, "wireguard operation failed")
+	ErrAddressPoolExhausted = newError("address_pool_exhausted", KindUnavailable, "no client address available")
+	ErrNotConnected         = newError("not_connected", KindGone, "not connected")
+	ErrAlreadyConnected     = newError("already_connected", KindConflict, "already connected")
+	ErrRestartRequired      = newError("restart_required", KindConflict, "change requires a restart")
+	ErrPlanNotFound         = newError("plan_not_found", KindInvalid, "plan not found")
+	ErrOverrideForbidden    = newError("override_forbidden", KindInvalid, "plan does not allow this override")
+	ErrLinkInvalid          = newError("link_invalid", KindNotFound, "invalid download link")
+	ErrLinkExpired          = newError("link_expired", KindGone, "download link has expired")
+	ErrLinkUsed             = newError("link_used", KindGone, "download link was already used")
+	ErrTooManyStreams       = newError("too_many_streams", KindRateLimited, "too many status streams from this client")
+	ErrShuttingDown         = newError("shutting_down", KindUnavailable, "server shutting down")
 )
+
+// DetailedError adds structured details, such as the accepted range of a
+// value, to an error.
+type DetailedError struct {
+	Err     error
+	Details map[string]interface{}
+}
+
+func (e *DetailedError) Error() string { return e.Err.Error() }
+func (e *DetailedError) Unwrap() error { return e.Err }
+
+func WithDetails(err error, details map[string]interface{}) error {
+	return &DetailedError{Err: err, Details: details}
+}
@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestErrorCodes(t *testing.T) {
+	codes := ErrorCodes()
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if !regexp.MustCompile(`^[a-z]+(_[a-z]+)*$`).MatchString(code) {
+			t.Errorf("code %q is not snake case", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q used twice", code)
+		}
+		seen[code] = true
+	}
+	for _, err := range []*Error{ErrInternal, ErrRestartRequired, ErrPlanNotFound, ErrAdminDisabled} {
+		if !seen[err.Code] {
+			t.Errorf("%s missing from %v", err.Code, codes)
+		}
+	}
+
+	// Callers get a copy
+	codes[0] = "changed"
+	if ErrorCodes()[0] == "changed" {
+		t.Error("ErrorCodes returned its own slice")
+	}
+}
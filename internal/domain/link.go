@@ -0,0 +1,33 @@
+package domain
+
+import "time"
+
+// MaxLinkTTL caps how long a config download link stays valid.
+const MaxLinkTTL = 24 * time.Hour
+
+// ConfigLink is the sealed content of a one-time config download link.
+type ConfigLink struct {
+	ID        string `json:"id"`
+	SessionID string `json:"sid"`
+	Format    string `json:"fmt"`
+	Platform  string `json:"plt,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// LinkRequest asks for a download link to a session's config. ExpiresIn is
+// in minutes; zero takes the configured default.
+type LinkRequest struct {
+	Format    string `json:"format"`
+	Platform  string `json:"platform"`
+	ExpiresIn int    `json:"expiresIn"`
+}
+
+// LinkRedemption is the audit record of a link being used.
+type LinkRedemption struct {
+	LinkID    string `json:"linkId"`
+	SessionID string `json:"sessionId"`
+	Format    string `json:"format"`
+	IP        string `json:"ip"`
+	Country   string `json:"country,omitempty"`
+	Time      int64  `json:"time"`
+}
@@ -1,7 +1,158 @@
 package domain
 
+import "strings"
+
+type HealthState string
+
+const (
+	HealthUnknown  HealthState = "unknown"
+	HealthHealthy  HealthState = "healthy"
+	HealthDegraded HealthState = "degraded"
+	HealthDown     HealthState = "down"
+)
+
+// ServerState is the operator-controlled lifecycle of a server, independent
+// of its health.
+type ServerState string
+
+const (
+	ServerActive      ServerState = "active"
+	ServerMaintenance ServerState = "maintenance"
+	ServerDraining    ServerState = "draining"
+)
+
+// ServerCodeSyntax is the form of a server code: a letter or digit, then up
+// to 31 letters, digits, underscores or hyphens.
+const ServerCodeSyntax = `[A-Za-z0-9][A-Za-z0-9_-]{0,31}`
+
+// What happens to sessions still on a server when its maintenance deadline
+// passes.
+const (
+	MaintenanceMigrate    = "migrate"
+	MaintenanceDisconnect = "disconnect"
+)
+
+// Selection strategies accepted in ConnectRequest.ServerCode in place of a
+// concrete server code. Fastest goes by Server.LatencyMs, which is measured
+// from the API server, not from the client.
+const (
+	StrategyAuto        = "auto"
+	StrategyFastest     = "fastest"
+	StrategyLeastLoaded = "least-loaded"
+	StrategyNearest     = "nearest"
+	StrategyManual      = "manual"
+)
+
 type Server struct {
-	Code string `json:"code"`
-	Name string `json:"name"`
-	IP   string `json:"ip"`
+	Code         string       `json:"code"`
+	Name         string       `json:"name"`
+	IP           string       `json:"ip"`
+	Country      string       `json:"country,omitempty"`
+	CountryName  string       `json:"countryName,omitempty"`
+	Continent    string       `json:"continent,omitempty"`
+	City         string       `json:"city,omitempty"`
+	Flag         string       `json:"flag,omitempty"`
+	Tags         []string     `json:"tags,omitempty"`
+	Features     []string     `json:"features,omitempty"`
+	Port         int          `json:"port"`
+	PublicKey    string       `json:"publicKey"`
+	Capacity     int          `json:"capacity"`
+	ActivePeers  int          `json:"activePeers"`
+	Load         float64      `json:"load"` // ActivePeers / Capacity
+	Health       HealthState  `json:"health"`
+	HealthDetail string       `json:"healthDetail,omitempty"`
+	LastChecked  int64        `json:"lastChecked,omitempty"`
+	LatencyMs    int          `json:"latencyMs,omitempty"` // round trip of the health check's peer API call, see HealthChecker
+	State        ServerState  `json:"state"`
+	Maintenance  *Maintenance `json:"maintenance,omitempty"`
+	Endpoint     string       `json:"-"`
+	Subnet       string       `json:"-"`
+	Interface    string       `json:"-"`
+	Agent        string       `json:"-"`
+	CanaryKey    string       `json:"-"`
+	Latitude     float64      `json:"-"`
+	Longitude    float64      `json:"-"`
+	Tunnel       TunnelParams `json:"-"`
+}
+
+func (s *Server) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServerFilter narrows and orders a server listing. Empty fields match all.
+type ServerFilter struct {
+	Tag       string
+	Country   string
+	Continent string
+	Sort      string // code (default), name, load or latency
+}
+
+// ServerGroup is a set of servers sharing a continent.
+type ServerGroup struct {
+	Continent string    `json:"continent"`
+	Name      string    `json:"name"`
+	Servers   []*Server `json:"servers"`
+}
+
+type Maintenance struct {
+	Reason   string `json:"reason,omitempty"`
+	Deadline int64  `json:"deadline"`
+	Action   string `json:"action"`
+}
+
+// AcceptsConnections reports whether new sessions may be placed on the server.
+func (s *Server) AcceptsConnections() bool {
+	return s.State == "" || s.State == ServerActive
+}
+
+// MaintenanceRequest sets the deadline either as a unix timestamp or as a
+// number of minutes from now.
+type MaintenanceRequest struct {
+	Reason   string `json:"reason"`
+	Deadline int64  `json:"deadline"`
+	Minutes  int    `json:"minutes"`
+	Action   string `json:"action"`
+}
+
+// ServerRequest is the admin payload for creating or replacing a server.
+type ServerRequest struct {
+	Code      string   `json:"code"`
+	Name      string   `json:"name"`
+	IP        string   `json:"ip"`
+	Endpoint  string   `json:"endpoint"`
+	Port      int      `json:"port"`
+	PublicKey string   `json:"publicKey"`
+	Subnet    string   `json:"subnet"`
+	Interface string   `json:"interface"`
+	Agent     string   `json:"agent"`
+	CanaryKey string   `json:"canaryKey"`
+	Country   string   `json:"country"`
+	City      string   `json:"city"`
+	Flag      string   `json:"flag"`
+	Tags      []string `json:"tags"`
+	Features  []string `json:"features"`
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Capacity  int      `json:"capacity"`
+
+	Tunnel TunnelParams `json:"tunnel"`
+}
+
+// Selection explains which server a connect request ended up on.
+type Selection struct {
+	Strategy string `json:"strategy"`
+	Reason   string `json:"reason"`
+}
+
+func IsStrategy(code string) bool {
+	switch code {
+	case StrategyAuto, StrategyFastest, StrategyLeastLoaded, StrategyNearest:
+		return true
+	}
+	return false
 }
@@ -0,0 +1,55 @@
+package domain
+
+import "testing"
+
+func TestIsStrategy(t *testing.T) {
+	for _, code := range []string{StrategyAuto, StrategyFastest, StrategyLeastLoaded, StrategyNearest} {
+		if !IsStrategy(code) {
+			t.Errorf("%s is not a strategy", code)
+		}
+	}
+	for _, code := range []string{"", "DE", "AUTO", "random"} {
+		if IsStrategy(code) {
+			t.Errorf("%q is a strategy", code)
+		}
+	}
+}
+
+func TestClientLocated(t *testing.T) {
+	var nobody *Client
+	if nobody.Located() || (&Client{IP: "192.0.2.1"}).Located() {
+		t.Error("a client without a country is located")
+	}
+	if !(&Client{IP: "192.0.2.1", Country: "DE"}).Located() {
+		t.Error("a client with a country is not located")
+	}
+}
+
+func TestServerAcceptsConnections(t *testing.T) {
+	tests := []struct {
+		state ServerState
+		want  bool
+	}{
+		{"", true},
+		{ServerActive, true},
+		{ServerMaintenance, false},
+		{ServerDraining, false},
+	}
+	for _, tt := range tests {
+		if got := (&Server{State: tt.state}).AcceptsConnections(); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.state, got, tt.want)
+		}
+	}
+}
+
+func TestServerHasTag(t *testing.T) {
+	server := &Server{Tags: []string{"p2p", "Streaming"}}
+	for _, tag := range []string{"p2p", "P2P", "streaming"} {
+		if !server.HasTag(tag) {
+			t.Errorf("%s not found", tag)
+		}
+	}
+	if server.HasTag("gaming") || (&Server{}).HasTag("") {
+		t.Error("tag found that the server does not have")
+	}
+}
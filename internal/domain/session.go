@@ -1,23 +1,103 @@
 package domain
 
-import "time"
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"time"
+
+	"p2nova-vpn/pkg/envelope"
+)
 
 type Session struct {
-	SessionID  string `json:"sessionId"`
-	ServerCode string `json:"serverCode"`
-	ClientIP   string `json:"ip"`
-	StartTime  int64  `json:"startTime"`
-	EndTime    int64  `json:"endTime,omitempty"`
-	Connected  bool   `json:"connected"`
-	PeerConfig string `json:"-"`
-	ClientKey  string `json:"-"`
+	SessionID  string     `json:"sessionId"`
+	ServerCode string     `json:"serverCode"`
+	ClientIP   string     `json:"ip"`
+	StartTime  int64      `json:"startTime"`
+	EndTime    int64      `json:"endTime,omitempty"`
+	Connected  bool       `json:"connected"`
+	Selection  *Selection `json:"selection,omitempty"`
+	// Request is the plan and overrides asked for; Plan and Params are the
+	// plan applied and the tunnel settings that went into the issued config.
+	Request TunnelRequest `json:"request"`
+	Plan    string        `json:"plan,omitempty"`
+	Params  TunnelParams  `json:"tunnel"`
+	// MigratedFrom and ReplacedBy link sessions moved to another server.
+	MigratedFrom string `json:"migratedFrom,omitempty"`
+	ReplacedBy   string `json:"replacedBy,omitempty"`
+	// PendingRelease marks an ended session whose peer and address could
+	// not be released because its server was down.
+	PendingRelease bool `json:"-"`
+	// Secrets is the sealed SessionSecrets, cleared when the session ends.
+	Secrets   *envelope.Envelope `json:"-"`
+	ClientKey string             `json:"-"`
+	// TokenHash is the SHA-256 of the owner token handed to the client on
+	// connect. A session that replaces another on migration keeps it.
+	TokenHash string `json:"-"`
+}
+
+// OwnedBy reports whether token is the session's owner token.
+func (s *Session) OwnedBy(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashSessionToken(token)), []byte(s.TokenHash)) == 1
+}
+
+// SessionSecrets is the key material of a session: its tunnel, including
+// the client's private key, and the config rendered from it. It is only
+// kept sealed.
+type SessionSecrets struct {
+	Tunnel     *TunnelConfig `json:"tunnel"`
+	PeerConfig string        `json:"peerConfig"`
 }
 
 type VPNStatus struct {
-	Connected bool   `json:"connected"`
-	Server    string `json:"server,omitempty"`
-	Duration  int64  `json:"duration,omitempty"`
-	IP        string `json:"ip,omitempty"`
+	Connected bool    `json:"connected"`
+	SessionID string  `json:"sessionId,omitempty"`
+	Server    string  `json:"server,omitempty"`
+	Duration  int64   `json:"duration,omitempty"`
+	IP        string  `json:"ip,omitempty"`
+	Notice    *Notice `json:"notice,omitempty"`
+	// Config is set when the session was moved to another server, so the
+	// client can switch tunnels.
+	Config string `json:"config,omitempty"`
+}
+
+// Notice types shown on a session's status.
+const (
+	NoticeMaintenance = "maintenance"
+	NoticeDraining    = "draining"
+	NoticeMigrated    = "migrated"
+)
+
+type Notice struct {
+	Type      string `json:"type"`
+	Message   string `json:"message"`
+	Deadline  int64  `json:"deadline,omitempty"`
+	SessionID string `json:"sessionId,omitempty"`
+}
+
+// PeerTraffic is what WireGuard reports for a session's peer. Rx counts
+// bytes received from the client, Tx bytes sent to it.
+type PeerTraffic struct {
+	// LatestHandshake is a Unix time, zero before the first handshake
+	LatestHandshake int64 `json:"latestHandshake,omitempty"`
+	RxBytes         int64 `json:"rxBytes"`
+	TxBytes         int64 `json:"txBytes"`
+}
+
+// HandshakeEvent is streamed when a session's peer completes a handshake.
+type HandshakeEvent struct {
+	LatestHandshake int64 `json:"latestHandshake"`
+}
+
+// TransferEvent is streamed when a session's peer moved traffic. The deltas
+// are the bytes since the previous transfer event of the stream, zero on
+// its first.
+type TransferEvent struct {
+	RxBytes int64 `json:"rxBytes"`
+	TxBytes int64 `json:"txBytes"`
+	RxDelta int64 `json:"rxDelta"`
+	TxDelta int64 `json:"txDelta"`
 }
 
 type SpeedTest struct {
@@ -27,34 +107,42 @@ type SpeedTest struct {
 }
 
 type ConnectRequest struct {
+	// ServerCode is either a server code or one of the selection strategies
+	// (auto, fastest, least-loaded, nearest). Empty means auto.
 	ServerCode string `json:"serverCode"`
+	// Plan selects a plan's tunnel settings, empty for the default plan.
+	Plan string `json:"plan,omitempty"`
+	// Tunnel overrides the plan's settings where the plan allows it.
+	Tunnel TunnelParams `json:"tunnel,omitempty"`
+	// Platform picks an operator config template, e.g. linux or ios.
+	Platform string `json:"platform,omitempty"`
 }
 
 type DisconnectRequest struct {
 	SessionID string `json:"sessionId"`
 }
 
-func NewSession(serverCode, clientIP, peerConfig, clientKey string) *Session {
+func NewSession(serverCode, clientIP string, secrets *envelope.Envelope, clientKey, tokenHash string) *Session {
 	return &Session{
-		SessionID:  generateSessionID(),
+		SessionID:  rand.Text(),
 		ServerCode: serverCode,
 		ClientIP:   clientIP,
 		StartTime:  time.Now().Unix(),
 		Connected:  true,
-		PeerConfig: peerConfig,
+		Secrets:    secrets,
 		ClientKey:  clientKey,
+		TokenHash:  tokenHash,
 	}
 }
 
-func generateSessionID() string {
-	return time.Now().Format("20060102150405") + "-" + randomString(8)
+// NewSessionToken returns a random owner token for a new session and the
+// hash to keep on it.
+func NewSessionToken() (token, hash string) {
+	token = rand.Text()
+	return token, HashSessionToken(token)
 }
 
-func randomString(n int) string {
-	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
-	b := make([]byte, n)
-	for i := range b {
-		b[i] = letters[time.Now().UnixNano()%int64(len(letters))]
-	}
-	return string(b)
+func HashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewSessionID(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id := NewSession("DE", "10.8.1.2", nil, "", "").SessionID
+		if len(id) != 26 || strings.Trim(id, "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567") != "" {
+			t.Fatalf("session ID %q is not 26 base32 characters", id)
+		}
+		if seen[id] {
+			t.Fatalf("session ID %q repeated", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestSessionOwnedBy(t *testing.T) {
+	token, hash := NewSessionToken()
+	if token == hash || hash != HashSessionToken(token) {
+		t.Fatalf("hash %q of token %q", hash, token)
+	}
+	session := NewSession("DE", "10.8.1.2", nil, "", hash)
+	if !session.OwnedBy(token) {
+		t.Error("owner token refused")
+	}
+	for _, wrong := range []string{"", hash, token + "x"} {
+		if session.OwnedBy(wrong) {
+			t.Errorf("%q accepted", wrong)
+		}
+	}
+	if (&Session{}).OwnedBy("") {
+		t.Error("a session without a token is owned by the empty token")
+	}
+}
@@ -0,0 +1,201 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// TunnelConfig is everything a client needs to bring up its tunnel. Every
+// config format handed out is rendered from it.
+type TunnelConfig struct {
+	PrivateKey          string   `json:"privateKey"`
+	Address             string   `json:"address"` // e.g. 10.8.0.2/32
+	DNS                 []string `json:"dns"`
+	MTU                 int      `json:"mtu"`
+	PublicKey           string   `json:"publicKey"` // the server's key
+	Endpoint            string   `json:"endpoint"`  // host:port
+	AllowedIPs          []string `json:"allowedIPs"`
+	PersistentKeepalive int      `json:"persistentKeepalive"`
+}
+
+// Config formats served by the session config endpoint.
+const (
+	ConfigFormatINI  = "ini"
+	ConfigFormatConf = "conf"
+	ConfigFormatJSON = "json"
+	ConfigFormatPNG  = "png"
+	ConfigFormatSVG  = "svg"
+
+	// Exports for clients other than wg-quick and the WireGuard apps
+	ConfigFormatUCI          = "uci"          // OpenWrt /etc/config/network
+	ConfigFormatNM           = "nmconnection" // NetworkManager keyfile
+	ConfigFormatRouterOS     = "routeros"     // MikroTik RouterOS 7 script
+	ConfigFormatMobileConfig = "mobileconfig" // Apple configuration profile
+)
+
+// IsConfigFormat reports whether the session config endpoint serves format.
+func IsConfigFormat(format string) bool {
+	switch format {
+	case ConfigFormatINI, ConfigFormatConf, ConfigFormatJSON, ConfigFormatPNG, ConfigFormatSVG:
+		return true
+	}
+	return IsExportFormat(format)
+}
+
+func IsExportFormat(format string) bool {
+	switch format {
+	case ConfigFormatUCI, ConfigFormatNM, ConfigFormatRouterOS, ConfigFormatMobileConfig:
+		return true
+	}
+	return false
+}
+
+// ExportOptions tune an export. Platform picks the config template and,
+// for profiles, macos or ios. OnDemand makes Apple devices bring the tunnel
+// up on their own, except on the trusted Wi-Fi networks.
+type ExportOptions struct {
+	Platform     string
+	OnDemand     bool
+	TrustedSSIDs []string
+}
+
+// ConfigExport is a rendered export, ready to serve as a download.
+type ConfigExport struct {
+	Content     []byte
+	ContentType string
+	FileName    string
+}
+
+// TunnelParams are the tunable settings of a client tunnel. They are set
+// per server, per plan and, where the plan allows, per connect request;
+// unset fields are left to the layer below.
+type TunnelParams struct {
+	DNS                 []string `json:"dns,omitempty" yaml:"dns"`
+	MTU                 int      `json:"mtu,omitempty" yaml:"mtu"`
+	AllowedIPs          []string `json:"allowedIPs,omitempty" yaml:"allowedIPs"`
+	PersistentKeepalive *int     `json:"persistentKeepalive,omitempty" yaml:"persistentKeepalive"` // 0 disables keepalives
+}
+
+// Names of the tunnel parameters, as used in a plan's overrides.
+const (
+	ParamDNS        = "dns"
+	ParamMTU        = "mtu"
+	ParamAllowedIPs = "allowedIPs"
+	ParamKeepalive  = "persistentKeepalive"
+)
+
+// WireGuard needs an MTU of at least 1280 to carry IPv6.
+const (
+	MinMTU = 1280
+	MaxMTU = 1500
+)
+
+func IsTunnelParam(name string) bool {
+	switch name {
+	case ParamDNS, ParamMTU, ParamAllowedIPs, ParamKeepalive:
+		return true
+	}
+	return false
+}
+
+// Merge returns p with every field that is set in over replaced.
+func (p TunnelParams) Merge(over TunnelParams) TunnelParams {
+	if len(over.DNS) > 0 {
+		p.DNS = over.DNS
+	}
+	if over.MTU != 0 {
+		p.MTU = over.MTU
+	}
+	if len(over.AllowedIPs) > 0 {
+		p.AllowedIPs = over.AllowedIPs
+	}
+	if over.PersistentKeepalive != nil {
+		p.PersistentKeepalive = over.PersistentKeepalive
+	}
+	return p
+}
+
+// Set lists the names of the parameters that are set.
+func (p TunnelParams) Set() []string {
+	var names []string
+	if len(p.DNS) > 0 {
+		names = append(names, ParamDNS)
+	}
+	if p.MTU != 0 {
+		names = append(names, ParamMTU)
+	}
+	if len(p.AllowedIPs) > 0 {
+		names = append(names, ParamAllowedIPs)
+	}
+	if p.PersistentKeepalive != nil {
+		names = append(names, ParamKeepalive)
+	}
+	return names
+}
+
+// Validate reports every parameter that is out of range or malformed.
+func (p TunnelParams) Validate() error {
+	var errs []error
+	for _, dns := range p.DNS {
+		if net.ParseIP(dns) == nil {
+			errs = append(errs, fmt.Errorf("dns: %q is not an IP address", dns))
+		}
+	}
+	if p.MTU != 0 && (p.MTU < MinMTU || p.MTU > MaxMTU) {
+		errs = append(errs, fmt.Errorf("mtu: %d is out of range %d-%d", p.MTU, MinMTU, MaxMTU))
+	}
+	for _, cidr := range p.AllowedIPs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			errs = append(errs, fmt.Errorf("allowedIPs: %q is not a CIDR", cidr))
+		}
+	}
+	if k := p.PersistentKeepalive; k != nil && (*k < 0 || *k > 65535) {
+		errs = append(errs, fmt.Errorf("persistentKeepalive: %d is out of range 0-65535", *k))
+	}
+	return errors.Join(errs...)
+}
+
+// Plan is a named set of tunnel parameters, with the parameters a client
+// may override on connect.
+type Plan struct {
+	Name      string       `json:"name" yaml:"name"`
+	Tunnel    TunnelParams `json:"tunnel" yaml:"tunnel"`
+	Overrides []string     `json:"overrides" yaml:"overrides"`
+}
+
+// Allows reports whether clients on the plan may override param.
+func (p *Plan) Allows(param string) bool {
+	for _, o := range p.Overrides {
+		if o == param {
+			return true
+		}
+	}
+	return false
+}
+
+// TunnelRequest is what a client asked for on connect. It is kept on the
+// session so a migrated session gets the same treatment.
+type TunnelRequest struct {
+	Plan      string       `json:"plan,omitempty"`
+	Platform  string       `json:"platform,omitempty"`
+	Overrides TunnelParams `json:"tunnel,omitempty"`
+}
+
+// TemplateData is what client config templates are rendered against. The
+// tunnel fields are promoted, so a template uses {{.PrivateKey}},
+// {{.Address}}, {{.DNS}}, {{.MTU}}, {{.PublicKey}}, {{.Endpoint}},
+// {{.AllowedIPs}} (the routes) and {{.PersistentKeepalive}} directly.
+type TemplateData struct {
+	*TunnelConfig
+	ClientIP string         // the client's address without prefix length
+	Server   TemplateServer // the server the tunnel goes to
+	Platform string         // the client platform asked for, may be empty
+}
+
+type TemplateServer struct {
+	Code    string
+	Name    string
+	Country string
+	City    string
+}
@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTunnelParamsMerge(t *testing.T) {
+	zero, five := 0, 5
+	base := TunnelParams{DNS: []string{"1.1.1.1"}, MTU: 1420, AllowedIPs: []string{"0.0.0.0/0"}, PersistentKeepalive: &five}
+
+	if got := base.Merge(TunnelParams{}); !reflect.DeepEqual(got, base) {
+		t.Errorf("empty merge changed %+v to %+v", base, got)
+	}
+
+	got := base.Merge(TunnelParams{MTU: 1280, PersistentKeepalive: &zero})
+	if got.MTU != 1280 || *got.PersistentKeepalive != 0 || got.DNS[0] != "1.1.1.1" || got.AllowedIPs[0] != "0.0.0.0/0" {
+		t.Errorf("merge = %+v", got)
+	}
+	if *base.PersistentKeepalive != 5 {
+		t.Error("merge changed the receiver")
+	}
+}
+
+func TestTunnelParamsSet(t *testing.T) {
+	zero := 0
+	if set := (TunnelParams{}).Set(); len(set) != 0 {
+		t.Errorf("empty params set %v", set)
+	}
+	// A keepalive of 0 is set: it turns keepalives off
+	got := TunnelParams{MTU: 1300, PersistentKeepalive: &zero}.Set()
+	if want := []string{ParamMTU, ParamKeepalive}; !reflect.DeepEqual(got, want) {
+		t.Errorf("set = %v, want %v", got, want)
+	}
+	for _, name := range []string{ParamDNS, ParamMTU, ParamAllowedIPs, ParamKeepalive} {
+		if !IsTunnelParam(name) {
+			t.Errorf("%s is not a tunnel parameter", name)
+		}
+	}
+	if IsTunnelParam("endpoint") {
+		t.Error("endpoint is a tunnel parameter")
+	}
+}
+
+func TestTunnelParamsValidate(t *testing.T) {
+	zero, max := 0, 65535
+	valid := TunnelParams{DNS: []string{"1.1.1.1", "2606:4700::1111"}, MTU: MinMTU, AllowedIPs: []string{"10.0.0.0/8", "::/0"}, PersistentKeepalive: &zero}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("valid params: %v", err)
+	}
+	if err := (TunnelParams{MTU: MaxMTU, PersistentKeepalive: &max}).Validate(); err != nil {
+		t.Errorf("upper bounds: %v", err)
+	}
+
+	negative := -1
+	err := TunnelParams{DNS: []string{"dns.example"}, MTU: 1279, AllowedIPs: []string{"10.0.0.0"}, PersistentKeepalive: &negative}.Validate()
+	if err == nil {
+		t.Fatal("invalid params accepted")
+	}
+	for _, want := range []string{"dns:", "mtu:", "allowedIPs:", "persistentKeepalive:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%q not reported in %v", want, err)
+		}
+	}
+	if err := (TunnelParams{MTU: MaxMTU + 1}).Validate(); err == nil {
+		t.Error("MTU above the maximum accepted")
+	}
+}
+
+func TestPlanAllows(t *testing.T) {
+	plan := &Plan{Name: "pro", Overrides: []string{ParamMTU}}
+	if !plan.Allows(ParamMTU) || plan.Allows(ParamDNS) {
+		t.Errorf("plan %+v allows the wrong parameters", plan)
+	}
+}
+
+func TestIsExportFormat(t *testing.T) {
+	for _, format := range []string{ConfigFormatUCI, ConfigFormatNM, ConfigFormatRouterOS, ConfigFormatMobileConfig} {
+		if !IsExportFormat(format) {
+			t.Errorf("%s is not an export format", format)
+		}
+	}
+	for _, format := range []string{ConfigFormatINI, ConfigFormatConf, ConfigFormatJSON, ConfigFormatPNG, ConfigFormatSVG, "", "UCI"} {
+		if IsExportFormat(format) {
+			t.Errorf("%q is an export format", format)
+		}
+	}
+}
+
+func TestIsConfigFormat(t *testing.T) {
+	for _, format := range []string{ConfigFormatINI, ConfigFormatConf, ConfigFormatJSON, ConfigFormatPNG, ConfigFormatSVG, ConfigFormatUCI, ConfigFormatMobileConfig} {
+		if !IsConfigFormat(format) {
+			t.Errorf("%s is not a config format", format)
+		}
+	}
+	for _, format := range []string{"", "pdf", "INI"} {
+		if IsConfigFormat(format) {
+			t.Errorf("%q is a config format", format)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package geo
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache is an LRU cache in front of a provider. Answers are kept for ttl,
+// misses and failures for negativeTTL, so an unreachable provider is not
+// asked again on every request. Lookups cut short by their caller are not
+// cached.
+type Cache struct {
+	provider    Provider
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu      sync.Mutex
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	ip      string
+	info    *GeoInfo // nil for a cached miss or failure
+	err     error
+	expires time.Time
+}
+
+func NewCache(provider Provider, size int, ttl, negativeTTL time.Duration) *Cache {
+	return &Cache{
+		provider:    provider,
+		size:        size,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		order:       list.New(),
+		entries:     make(map[string]*list.Element),
+	}
+}
+
+func (c *Cache) Name() string { return "cache" }
+
+func (c *Cache) Lookup(ctx context.Context, ip string) (*GeoInfo, error) {
+	if entry, ok := c.get(ip); ok {
+		if entry.info == nil {
+			return nil, entry.err
+		}
+		info := *entry.info
+		return &info, nil
+	}
+
+	info, err := c.provider.Lookup(ctx, ip)
+	switch {
+	case err == nil:
+		c.put(ip, info, nil, c.ttl)
+	case ctx.Err() == nil:
+		c.put(ip, nil, err, c.negativeTTL)
+	}
+	return info, err
+}
+
+func (c *Cache) get(ip string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[ip]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, ip)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry, true
+}
+
+func (c *Cache) put(ip string, info *GeoInfo, err error, ttl time.Duration) {
+	if c.size <= 0 || ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{ip: ip, info: info, err: err, expires: time.Now().Add(ttl)}
+	if elem, ok := c.entries[ip]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[ip] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).ip)
+	}
+}
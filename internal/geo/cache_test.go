@@ -0,0 +1,116 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCacheTTL(t *testing.T) {
+	p := &fakeProvider{name: "p", lookup: answer("KE")}
+	cache := NewCache(p, 10, 30*time.Millisecond, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		info, err := cache.Lookup(context.Background(), "192.0.2.1")
+		if err != nil || info.Country != "KE" {
+			t.Fatalf("got %+v, %v", info, err)
+		}
+	}
+	if p.calls != 1 {
+		t.Errorf("provider asked %d times, want once", p.calls)
+	}
+
+	// Callers get copies; the cached answer stays intact
+	info, _ := cache.Lookup(context.Background(), "192.0.2.1")
+	info.Country = "XX"
+	if info, _ := cache.Lookup(context.Background(), "192.0.2.1"); info.Country != "KE" {
+		t.Errorf("cached answer changed to %s", info.Country)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if _, err := cache.Lookup(context.Background(), "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	if p.calls != 2 {
+		t.Errorf("provider asked %d times, want the expired entry refreshed", p.calls)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	p := &fakeProvider{name: "p", lookup: answer("KE")}
+	cache := NewCache(p, 2, time.Minute, time.Minute)
+	lookup := func(ip string) {
+		if _, err := cache.Lookup(context.Background(), ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lookup("192.0.2.1")
+	lookup("192.0.2.2")
+	lookup("192.0.2.1") // .2 is now the least recently used
+	lookup("192.0.2.3")
+	if p.calls != 3 {
+		t.Fatalf("provider asked %d times, want 3", p.calls)
+	}
+
+	lookup("192.0.2.1")
+	if p.calls != 3 {
+		t.Error("recently used entry was evicted")
+	}
+	lookup("192.0.2.2")
+	if p.calls != 4 {
+		t.Error("least recently used entry was kept")
+	}
+}
+
+func TestCacheNegative(t *testing.T) {
+	miss := &fakeProvider{name: "miss", lookup: fail(ErrNotFound)}
+	cache := NewCache(miss, 10, time.Minute, 30*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Lookup(context.Background(), "10.0.0.1"); err != ErrNotFound {
+			t.Fatalf("got %v, want ErrNotFound", err)
+		}
+	}
+	if miss.calls != 1 {
+		t.Errorf("miss looked up %d times, want once", miss.calls)
+	}
+	time.Sleep(40 * time.Millisecond)
+	cache.Lookup(context.Background(), "10.0.0.1")
+	if miss.calls != 2 {
+		t.Error("miss was cached past its TTL")
+	}
+
+	// Failures are cached as well, with their error
+	unreachable := errors.New("unreachable")
+	failing := &fakeProvider{name: "failing", lookup: fail(unreachable)}
+	cache = NewCache(failing, 10, time.Minute, time.Minute)
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Lookup(context.Background(), "192.0.2.1"); err != unreachable {
+			t.Fatalf("got %v, want the provider's error", err)
+		}
+	}
+	if failing.calls != 1 {
+		t.Errorf("failure looked up %d times, want once", failing.calls)
+	}
+
+	// Unless the caller gave up
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	slow := &fakeProvider{name: "slow", lookup: hang}
+	cache = NewCache(slow, 10, time.Minute, time.Minute)
+	cache.Lookup(ctx, "192.0.2.1")
+	cache.Lookup(ctx, "192.0.2.1")
+	if slow.calls != 2 {
+		t.Errorf("cancelled lookup was cached")
+	}
+
+	// A zero negative TTL disables caching misses
+	miss.calls = 0
+	cache = NewCache(miss, 10, time.Minute, 0)
+	cache.Lookup(context.Background(), "10.0.0.1")
+	cache.Lookup(context.Background(), "10.0.0.1")
+	if miss.calls != 2 {
+		t.Errorf("miss looked up %d times with negative caching off, want 2", miss.calls)
+	}
+}
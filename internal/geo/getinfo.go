@@ -1,9 +1,14 @@
 package geo
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 )
 
 type GeoInfo struct {
@@ -11,18 +16,85 @@ type GeoInfo struct {
 	City    string `json:"city"`
 	Region  string `json:"region"`
 	IP      string `json:"ip"`
+	Loc     string `json:"loc"` // "latitude,longitude"
+	ASN     uint   `json:"asn,omitempty"`
+	Org     string `json:"org,omitempty"` // e.g. "AS15169 Google LLC"
 }
 
-func GetServerGeo(ip string) (*GeoInfo, error) {
-	resp, err := http.Get(fmt.Sprintf("https://ipinfo.io/%s/json", ip))
+// Coordinates parses Loc. ok is false when the location is unknown.
+func (g *GeoInfo) Coordinates() (lat, lon float64, ok bool) {
+	parts := strings.Split(g.Loc, ",")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	lat, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	lon, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+// HTTPProvider queries an ipinfo.io compatible API: GET {base}/{ip}/json.
+type HTTPProvider struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func NewHTTPProvider(baseURL, token string) *HTTPProvider {
+	return &HTTPProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{},
+	}
+}
+
+func (p *HTTPProvider) Name() string { return "ipinfo" }
+
+func (p *HTTPProvider) Lookup(ctx context.Context, ip string) (*GeoInfo, error) {
+	endpoint := fmt.Sprintf("%s/%s/json", p.baseURL, url.PathEscape(ip))
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	var info GeoInfo
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return nil, fmt.Errorf("%s returned %d: %s", p.baseURL, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var info struct {
+		GeoInfo
+		Bogon bool `json:"bogon"`
+	}
 	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid response from %s: %w", p.baseURL, err)
+	}
+
+	// Private and reserved ranges come back as bogons without location
+	if info.Bogon || info.Country == "" {
+		return nil, ErrNotFound
 	}
-	return &info, nil
+
+	if info.ASN == 0 && strings.HasPrefix(info.Org, "AS") {
+		asn, _ := strconv.ParseUint(strings.Fields(info.Org)[0][2:], 10, 32)
+		info.ASN = uint(asn)
+	}
+
+	return &info.GeoInfo, nil
 }
@@ -0,0 +1,92 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPProviderLookup(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/81.2.69.142/json" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q", got)
+		}
+		fmt.Fprint(w, `{"ip":"81.2.69.142","country":"GB","city":"London","region":"England","loc":"51.5,-0.12","org":"AS20712 Andrews & Arnold"}`)
+	}))
+	defer srv.Close()
+
+	info, err := NewHTTPProvider(srv.URL+"/", "secret").Lookup(context.Background(), "81.2.69.142")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Country != "GB" || info.City != "London" || info.ASN != 20712 {
+		t.Errorf("got %+v", info)
+	}
+	if lat, lon, ok := info.Coordinates(); !ok || lat != 51.5 || lon != -0.12 {
+		t.Errorf("coordinates = %v, %v, %v", lat, lon, ok)
+	}
+}
+
+func TestHTTPProviderErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		notFound bool
+		want     string
+	}{
+		{"not found", http.StatusNotFound, "", true, ""},
+		{"bogon", http.StatusOK, `{"ip":"10.0.0.1","bogon":true}`, true, ""},
+		{"no country", http.StatusOK, `{"ip":"192.0.2.1"}`, true, ""},
+		{"rate limited", http.StatusTooManyRequests, "slow down\n", false, "returned 429: slow down"},
+		{"server error", http.StatusInternalServerError, "", false, "returned 500"},
+		{"bad body", http.StatusOK, "<html>", false, "invalid response"},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			fmt.Fprint(w, tt.body)
+		}))
+
+		_, err := NewHTTPProvider(srv.URL, "").Lookup(context.Background(), "192.0.2.1")
+		switch {
+		case tt.notFound && !errors.Is(err, ErrNotFound):
+			t.Errorf("%s: got %v, want ErrNotFound", tt.name, err)
+		case !tt.notFound && (err == nil || errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: got %v, want an error containing %q", tt.name, err, tt.want)
+		}
+		srv.Close()
+	}
+}
+
+func TestHTTPProviderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := NewHTTPProvider(srv.URL, "").Lookup(ctx, "192.0.2.1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("lookup took %s despite the deadline", elapsed)
+	}
+}
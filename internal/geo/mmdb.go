@@ -0,0 +1,191 @@
+package geo
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"p2nova-vpn/internal/logging"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+type cityRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// MMDB resolves addresses from local MaxMind databases: a City database and,
+// optionally, an ASN database. Watch swaps in a new file when it changes on
+// disk without interrupting lookups.
+type MMDB struct {
+	cityPath string
+	asnPath  string
+
+	mu       sync.RWMutex
+	city     *maxminddb.Reader
+	asn      *maxminddb.Reader
+	cityTime time.Time
+	asnTime  time.Time
+}
+
+func OpenMMDB(cityPath, asnPath string) (*MMDB, error) {
+	db := &MMDB{cityPath: cityPath, asnPath: asnPath}
+
+	var err error
+	db.city, db.cityTime, err = openReader(cityPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if asnPath != "" {
+		db.asn, db.asnTime, err = openReader(asnPath)
+		if err != nil {
+			db.city.Close()
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+func (db *MMDB) Name() string { return "mmdb" }
+
+func (db *MMDB) Lookup(ctx context.Context, ip string) (*GeoInfo, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, fmt.Errorf("invalid IP %q", ip)
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var city cityRecord
+	if err := db.city.Lookup(addr, &city); err != nil {
+		return nil, fmt.Errorf("geoip lookup failed: %w", err)
+	}
+	if city.Country.ISOCode == "" {
+		return nil, ErrNotFound
+	}
+
+	info := &GeoInfo{
+		IP:      ip,
+		Country: city.Country.ISOCode,
+		City:    city.City.Names["en"],
+	}
+	if len(city.Subdivisions) > 0 {
+		info.Region = city.Subdivisions[0].Names["en"]
+	}
+	if city.Location.Latitude != 0 || city.Location.Longitude != 0 {
+		info.Loc = fmt.Sprintf("%.4f,%.4f", city.Location.Latitude, city.Location.Longitude)
+	}
+
+	if db.asn != nil {
+		var asn asnRecord
+		if err := db.asn.Lookup(addr, &asn); err == nil && asn.Number != 0 {
+			info.ASN = asn.Number
+			info.Org = fmt.Sprintf("AS%d %s", asn.Number, asn.Organization)
+		}
+	}
+
+	return info, nil
+}
+
+// Watch checks the database files every interval and reloads any that were
+// replaced, until ctx is cancelled. A file that fails to load keeps the
+// previous database in service.
+func (db *MMDB) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			db.reloadIfChanged(db.cityPath, &db.city, &db.cityTime)
+			if db.asnPath != "" {
+				db.reloadIfChanged(db.asnPath, &db.asn, &db.asnTime)
+			}
+		}
+	}
+}
+
+func (db *MMDB) reloadIfChanged(path string, reader **maxminddb.Reader, loaded *time.Time) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	db.mu.RLock()
+	changed := !info.ModTime().Equal(*loaded)
+	db.mu.RUnlock()
+	if !changed {
+		return
+	}
+
+	next, modTime, err := openReader(path)
+	if err != nil {
+		logging.Warnf("GeoIP database %s changed but failed to load: %v", path, err)
+		return
+	}
+
+	db.mu.Lock()
+	old := *reader
+	*reader = next
+	*loaded = modTime
+	db.mu.Unlock()
+
+	old.Close()
+	logging.Infof("GeoIP database %s reloaded (built %s)", path,
+		time.Unix(int64(next.Metadata.BuildEpoch), 0).UTC().Format(time.DateOnly))
+}
+
+func (db *MMDB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.asn != nil {
+		db.asn.Close()
+	}
+	return db.city.Close()
+}
+
+// openReader loads the whole file into memory rather than mapping it, so a
+// database replaced in place cannot change under an open reader.
+func openReader(path string) (*maxminddb.Reader, time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read GeoIP database: %w", err)
+	}
+
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid GeoIP database %s: %w", path, err)
+	}
+	return reader, info.ModTime(), nil
+}
@@ -0,0 +1,138 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The databases in testdata hold a single network, 81.2.69.0/24. The
+// updated city database names a different city for it.
+
+func copyDB(t *testing.T, src, dst string, modTime time.Time) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(dst, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMMDBLookup(t *testing.T) {
+	db, err := OpenMMDB("testdata/city.mmdb", "testdata/asn.mmdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	info, err := db.Lookup(context.Background(), "81.2.69.142")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := GeoInfo{
+		IP:      "81.2.69.142",
+		Country: "GB",
+		City:    "London",
+		Region:  "England",
+		Loc:     "51.5000,-0.1200",
+		ASN:     20712,
+		Org:     "AS20712 Andrews & Arnold",
+	}
+	if *info != want {
+		t.Errorf("got %+v, want %+v", *info, want)
+	}
+
+	if _, err := db.Lookup(context.Background(), "192.0.2.1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("address outside the database: got %v, want ErrNotFound", err)
+	}
+	if _, err := db.Lookup(context.Background(), "not-an-ip"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("invalid address: got %v", err)
+	}
+}
+
+func TestMMDBWithoutASN(t *testing.T) {
+	db, err := OpenMMDB("testdata/city.mmdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	info, err := db.Lookup(context.Background(), "81.2.69.142")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ASN != 0 || info.Org != "" {
+		t.Errorf("ASN resolved without an ASN database: %+v", info)
+	}
+}
+
+func TestOpenMMDBErrors(t *testing.T) {
+	bad := filepath.Join(t.TempDir(), "bad.mmdb")
+	if err := os.WriteFile(bad, []byte("not a database"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, paths := range [][2]string{
+		{"testdata/missing.mmdb", ""},
+		{bad, ""},
+		{"testdata/city.mmdb", bad},
+	} {
+		if _, err := OpenMMDB(paths[0], paths[1]); err == nil {
+			t.Errorf("OpenMMDB(%q, %q) succeeded", paths[0], paths[1])
+		}
+	}
+}
+
+func TestMMDBWatchReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	start := time.Now().Add(-time.Hour)
+	copyDB(t, "testdata/city.mmdb", path, start)
+
+	db, err := OpenMMDB(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go db.Watch(ctx, 5*time.Millisecond)
+
+	city := func() string {
+		info, err := db.Lookup(context.Background(), "81.2.69.142")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.City
+	}
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for city() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("city = %q, want %q", city(), want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// A broken replacement keeps the loaded database in service
+	if err := os.WriteFile(path, []byte("truncated"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := city(); got != "London" {
+		t.Fatalf("city after a broken update = %q, want London", got)
+	}
+
+	copyDB(t, "testdata/city-updated.mmdb", path, start.Add(time.Minute))
+	waitFor("Croydon")
+}
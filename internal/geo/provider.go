@@ -0,0 +1,70 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ErrNotFound means a provider has no record for the address. Unlike other
+// errors it does not make the chain report a failure.
+var ErrNotFound = errors.New("no geo record")
+
+// Public reports whether ip is a public unicast address. Private,
+// loopback, link-local and shared (CGNAT) addresses cannot be located.
+func Public(ip net.IP) bool {
+	return ip != nil && ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0).To4(), Mask: net.CIDRMask(10, 32)}
+
+type Provider interface {
+	Name() string
+	Lookup(ctx context.Context, ip string) (*GeoInfo, error)
+}
+
+// Chain asks each provider in order and returns the first answer. Every
+// provider gets its own timeout so a slow one cannot starve the fallbacks.
+type Chain struct {
+	providers []Provider
+	timeout   time.Duration
+}
+
+func NewChain(timeout time.Duration, providers ...Provider) *Chain {
+	return &Chain{providers: providers, timeout: timeout}
+}
+
+func (c *Chain) Name() string { return "chain" }
+
+func (c *Chain) Lookup(ctx context.Context, ip string) (*GeoInfo, error) {
+	var errs []error
+	for _, p := range c.providers {
+		info, err := c.lookup(ctx, p, ip)
+		if err == nil {
+			return info, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !errors.Is(err, ErrNotFound) {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil, ErrNotFound
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (c *Chain) lookup(ctx context.Context, p Provider, ip string) (*GeoInfo, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	return p.Lookup(ctx, ip)
+}
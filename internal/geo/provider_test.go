@@ -0,0 +1,130 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeProvider answers from a function and records how often it was asked.
+type fakeProvider struct {
+	name   string
+	lookup func(ctx context.Context, ip string) (*GeoInfo, error)
+	calls  int
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) Lookup(ctx context.Context, ip string) (*GeoInfo, error) {
+	p.calls++
+	return p.lookup(ctx, ip)
+}
+
+func answer(country string) func(context.Context, string) (*GeoInfo, error) {
+	return func(_ context.Context, ip string) (*GeoInfo, error) {
+		return &GeoInfo{IP: ip, Country: country}, nil
+	}
+}
+
+func fail(err error) func(context.Context, string) (*GeoInfo, error) {
+	return func(context.Context, string) (*GeoInfo, error) { return nil, err }
+}
+
+// hang blocks until the lookup's context ends.
+func hang(ctx context.Context, _ string) (*GeoInfo, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestChainFallbackOrder(t *testing.T) {
+	first := &fakeProvider{name: "first", lookup: fail(ErrNotFound)}
+	second := &fakeProvider{name: "second", lookup: fail(errors.New("unreachable"))}
+	third := &fakeProvider{name: "third", lookup: answer("KE")}
+	fourth := &fakeProvider{name: "fourth", lookup: answer("DE")}
+
+	info, err := NewChain(time.Second, first, second, third, fourth).Lookup(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Country != "KE" {
+		t.Errorf("got %s, want the answer of the first provider that had one", info.Country)
+	}
+	if first.calls != 1 || second.calls != 1 || third.calls != 1 || fourth.calls != 0 {
+		t.Errorf("calls = %d, %d, %d, %d", first.calls, second.calls, third.calls, fourth.calls)
+	}
+}
+
+func TestChainErrors(t *testing.T) {
+	misses := NewChain(time.Second,
+		&fakeProvider{name: "a", lookup: fail(ErrNotFound)},
+		&fakeProvider{name: "b", lookup: fail(ErrNotFound)},
+	)
+	if _, err := misses.Lookup(context.Background(), "192.0.2.1"); err != ErrNotFound {
+		t.Errorf("all misses: got %v, want ErrNotFound", err)
+	}
+
+	failures := NewChain(time.Second,
+		&fakeProvider{name: "a", lookup: fail(ErrNotFound)},
+		&fakeProvider{name: "b", lookup: fail(errors.New("unreachable"))},
+	)
+	_, err := failures.Lookup(context.Background(), "192.0.2.1")
+	if err == nil || errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "b: unreachable") {
+		t.Errorf("failure: got %v, want the provider's error", err)
+	}
+}
+
+func TestChainPerProviderTimeout(t *testing.T) {
+	slow := &fakeProvider{name: "slow", lookup: hang}
+	fallback := &fakeProvider{name: "fallback", lookup: answer("KE")}
+
+	start := time.Now()
+	info, err := NewChain(20*time.Millisecond, slow, fallback).Lookup(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Country != "KE" {
+		t.Errorf("got %s, want the fallback's answer", info.Country)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("lookup took %s, the slow provider was not cut off", elapsed)
+	}
+
+	// The caller's deadline ends the whole chain
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fallback.calls = 0
+	if _, err := NewChain(time.Second, slow, fallback).Lookup(ctx, "192.0.2.1"); err != context.Canceled {
+		t.Errorf("cancelled lookup: got %v", err)
+	}
+	if fallback.calls != 0 {
+		t.Error("the chain kept going after its caller gave up")
+	}
+}
+
+func TestPublic(t *testing.T) {
+	tests := map[string]bool{
+		"81.2.69.142":  true,
+		"2001:4860::1": true,
+		"10.1.2.3":     false,
+		"172.16.0.1":   false,
+		"192.168.1.1":  false,
+		"127.0.0.1":    false,
+		"::1":          false,
+		"169.254.1.1":  false,
+		"fe80::1":      false,
+		"fd00::1":      false,
+		"100.64.0.1":   false,
+		"100.128.0.1":  true,
+		"0.0.0.0":      false,
+		"224.0.0.1":    false,
+		"not-an-ip":    false,
+	}
+	for ip, want := range tests {
+		if got := Public(net.ParseIP(ip)); got != want {
+			t.Errorf("Public(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
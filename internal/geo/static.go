@@ -0,0 +1,92 @@
+package geo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+)
+
+// StaticProvider answers from operator-supplied overrides keyed by IP or
+// CIDR. The most specific matching prefix wins.
+type StaticProvider struct {
+	entries []staticEntry
+}
+
+type staticEntry struct {
+	network *net.IPNet
+	info    GeoInfo
+}
+
+func NewStaticProvider(overrides map[string]GeoInfo) (*StaticProvider, error) {
+	p := &StaticProvider{}
+	for key, info := range overrides {
+		network, err := parsePrefix(key)
+		if err != nil {
+			return nil, err
+		}
+		p.entries = append(p.entries, staticEntry{network: network, info: info})
+	}
+	return p, nil
+}
+
+// LoadStaticProvider reads overrides from a JSON object of the form
+// {"203.0.113.0/24": {"country": "KE", "city": "Nairobi"}}.
+func LoadStaticProvider(path string) (*StaticProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read geo overrides: %w", err)
+	}
+
+	var overrides map[string]GeoInfo
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse geo overrides %s: %w", path, err)
+	}
+	return NewStaticProvider(overrides)
+}
+
+func (p *StaticProvider) Name() string { return "static" }
+
+func (p *StaticProvider) Lookup(ctx context.Context, ip string) (*GeoInfo, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, fmt.Errorf("invalid IP %q", ip)
+	}
+
+	var best *staticEntry
+	bestLen := -1
+	for i := range p.entries {
+		e := &p.entries[i]
+		if !e.network.Contains(addr) {
+			continue
+		}
+		if ones, _ := e.network.Mask.Size(); ones > bestLen {
+			best, bestLen = e, ones
+		}
+	}
+
+	if best == nil {
+		return nil, ErrNotFound
+	}
+
+	info := best.info
+	info.IP = ip
+	return &info, nil
+}
+
+func parsePrefix(key string) (*net.IPNet, error) {
+	if _, network, err := net.ParseCIDR(key); err == nil {
+		return network, nil
+	}
+
+	ip := net.ParseIP(key)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid geo override key %q", key)
+	}
+	bits := 128
+	if ip.To4() != nil {
+		ip, bits = ip.To4(), 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
@@ -0,0 +1,76 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStaticProviderMostSpecificWins(t *testing.T) {
+	p, err := NewStaticProvider(map[string]GeoInfo{
+		"203.0.113.0/24": {Country: "KE", City: "Nairobi"},
+		"203.0.113.0/28": {Country: "KE", City: "Mombasa"},
+		"203.0.113.9":    {Country: "TZ"},
+		"2001:db8::/32":  {Country: "DE"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct{ ip, country, city string }{
+		{"203.0.113.200", "KE", "Nairobi"},
+		{"203.0.113.3", "KE", "Mombasa"},
+		{"203.0.113.9", "TZ", ""},
+		{"2001:db8::1", "DE", ""},
+	}
+	for _, tt := range tests {
+		info, err := p.Lookup(context.Background(), tt.ip)
+		if err != nil {
+			t.Errorf("%s: %v", tt.ip, err)
+			continue
+		}
+		if info.Country != tt.country || info.City != tt.city || info.IP != tt.ip {
+			t.Errorf("%s: got %+v", tt.ip, info)
+		}
+	}
+
+	if _, err := p.Lookup(context.Background(), "198.51.100.1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unmatched address: got %v, want ErrNotFound", err)
+	}
+	if _, err := p.Lookup(context.Background(), "not an ip"); err == nil {
+		t.Error("invalid address accepted")
+	}
+}
+
+func TestLoadStaticProvider(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "geo.json")
+	if err := os.WriteFile(path, []byte(`{"192.0.2.0/24": {"country": "NL"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadStaticProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := p.Lookup(context.Background(), "192.0.2.7"); err != nil || info.Country != "NL" {
+		t.Errorf("got %+v, %v", info, err)
+	}
+
+	for name, content := range map[string]string{
+		"syntax.json": `{"192.0.2.0/24": `,
+		"key.json":    `{"192.0.2.0/33": {"country": "NL"}}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadStaticProvider(path); err == nil {
+			t.Errorf("%s loaded", name)
+		}
+	}
+	if _, err := LoadStaticProvider(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("missing file loaded")
+	}
+}
@@ -0,0 +1,37 @@
+package handler
+
+import "net/http"
+
+// ReloadConfig re-reads the configuration and applies the changes that are
+// safe while tunnels are up. Changes that need a restart reject the whole
+// reload with restart_required.
+func (h *Handler) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	changes, err := h.reloader.Reload()
+	if err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	if changes == nil {
+		changes = []string{}
+	}
+	SuccessResponse(w, http.StatusOK, map[string]interface{}{
+		"changes": changes,
+	})
+}
+
+// ReencryptKeys rewraps the key material of every session under the current
+// master key. Run it after rotating ENCRYPTION_KEY_VERSION and before
+// removing the old key.
+func (h *Handler) ReencryptKeys(w http.ResponseWriter, r *http.Request) {
+	version, count, err := h.vpnService.Reencrypt()
+	if err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	SuccessResponse(w, http.StatusOK, map[string]interface{}{
+		"keyVersion":  version,
+		"reencrypted": count,
+	})
+}
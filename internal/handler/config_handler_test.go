@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"p2nova-vpn/pkg/envelope"
+)
+
+func TestReloadConfig(t *testing.T) {
+	api := newTestAPI(t)
+
+	if rec := api.do(t, "POST", "/api/v1/config/reload", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("reload without a token: %d", rec.Code)
+	}
+
+	t.Setenv("CORS_ORIGINS", "https://app.example")
+	rec := api.do(t, "POST", "/api/v1/config/reload", testAdminToken, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reload: %d %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Data struct {
+			Changes []string `json:"changes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data.Changes) != 1 || !strings.HasPrefix(resp.Data.Changes[0], "CORS origins") {
+		t.Errorf("changes = %v", resp.Data.Changes)
+	}
+
+	// The new origins apply to the next request
+	req := httptest.NewRequest("GET", "/api/v1/health", nil)
+	req.Header.Set("Origin", "https://app.example")
+	health := httptest.NewRecorder()
+	api.router.ServeHTTP(health, req)
+	if got := health.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example" {
+		t.Errorf("allowed origin = %q after reload", got)
+	}
+
+	// Nothing changed since: an empty list, not null
+	rec = api.do(t, "POST", "/api/v1/config/reload", testAdminToken, "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"changes":[]`) {
+		t.Errorf("second reload: %d %s", rec.Code, rec.Body)
+	}
+
+	t.Setenv("PORT", "9999")
+	rec = api.do(t, "POST", "/api/v1/config/reload", testAdminToken, "")
+	if rec.Code != http.StatusConflict || errorCode(t, rec) != "restart_required" ||
+		!strings.Contains(rec.Body.String(), "PORT changed") {
+		t.Errorf("restart-only change: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestReencryptKeys(t *testing.T) {
+	key := func(b byte) string {
+		return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, envelope.KeyLen))
+	}
+	t.Setenv("ENCRYPTION_KEYS", "1:"+key(1))
+	api := newTestAPI(t)
+	sessionID, token := api.connect(t)
+
+	if rec := api.do(t, "POST", "/api/v1/keys/reencrypt", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("reencrypt without a token: %d", rec.Code)
+	}
+
+	// Rotate to version 2
+	t.Setenv("ENCRYPTION_KEYS", "1:"+key(1)+",2:"+key(2))
+	if rec := api.do(t, "POST", "/api/v1/config/reload", testAdminToken, ""); rec.Code != http.StatusOK {
+		t.Fatalf("reload: %d %s", rec.Code, rec.Body)
+	}
+	rec := api.do(t, "POST", "/api/v1/keys/reencrypt", testAdminToken, "")
+	var resp struct {
+		Data struct {
+			KeyVersion  int `json:"keyVersion"`
+			Reencrypted int `json:"reencrypted"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("reencrypt: %d %s", rec.Code, rec.Body)
+	}
+	if resp.Data.KeyVersion != 2 || resp.Data.Reencrypted != 1 {
+		t.Errorf("reencrypt = %+v, want 1 session under version 2", resp.Data)
+	}
+
+	rec = api.do(t, "GET", "/api/v1/vpn/sessions/"+sessionID+"/config", token, "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "PrivateKey = ") {
+		t.Errorf("config after reencryption: %d %s", rec.Code, rec.Body)
+	}
+}
@@ -1,17 +1,70 @@
 package handler
 
 import (
+	"context"
+	"sync"
+
+	"p2nova-vpn/internal/middleware"
 	"p2nova-vpn/internal/service"
+
+	"github.com/gorilla/mux"
 )
 
 type Handler struct {
 	vpnService    *service.VPNService
 	serverService *service.ServerService
+	linkService   *service.LinkService
+	reloader      *service.Reloader
+
+	// streams is cancelled on shutdown to end the status streams, which
+	// streamsDone then waits for
+	streams      context.Context
+	closeStreams context.CancelFunc
+	streamsDone  sync.WaitGroup
+
+	// streamsMu guards clientStreams, which counts the open status streams
+	// per client IP, and orders starting a stream against closing them
+	streamsMu     sync.Mutex
+	clientStreams map[string]int
 }
 
-func NewHandler(vpnService *service.VPNService, serverService *service.ServerService) *Handler {
+func NewHandler(vpnService *service.VPNService, serverService *service.ServerService, linkService *service.LinkService, reloader *service.Reloader) *Handler {
+	streams, closeStreams := context.WithCancel(context.Background())
 	return &Handler{
 		vpnService:    vpnService,
 		serverService: serverService,
+		linkService:   linkService,
+		reloader:      reloader,
+		streams:       streams,
+		closeStreams:  closeStreams,
+		clientStreams: make(map[string]int),
 	}
 }
+
+// Routes registers the API under a path prefix. The admin routes take
+// adminToken as a bearer token.
+func Routes(api *mux.Router, h *Handler, adminToken string) {
+	api.HandleFunc("/servers", h.GetServers).Methods("GET")
+	api.HandleFunc("/vpn/server", h.SelectServer).Methods("POST")
+	api.HandleFunc("/vpn/connect", h.Connect).Methods("POST")
+	api.HandleFunc("/vpn/disconnect", h.Disconnect).Methods("POST")
+	api.HandleFunc("/vpn/speed", h.GetSpeed).Methods("GET")
+	api.HandleFunc("/vpn/status", h.GetStatus).Methods("GET")
+	api.HandleFunc("/vpn/status/stream", h.StreamStatus).Methods("GET")
+	api.HandleFunc("/vpn/sessions/{id}/config", h.GetSessionConfig).Methods("GET")
+	api.HandleFunc("/vpn/sessions/{id}/links", h.CreateConfigLink).Methods("POST")
+	api.HandleFunc("/vpn/links/{token}", h.RedeemConfigLink).Methods("GET")
+	api.HandleFunc("/health", h.Health).Methods("GET")
+
+	// Admin routes
+	admin := api.NewRoute().Subrouter()
+	admin.Use(middleware.AdminAuth(adminToken))
+	admin.HandleFunc("/servers", h.CreateServer).Methods("POST")
+	admin.HandleFunc("/servers/{code}", h.UpdateServer).Methods("PUT")
+	admin.HandleFunc("/servers/{code}", h.DeleteServer).Methods("DELETE")
+	admin.HandleFunc("/servers/{code}/maintenance", h.StartMaintenance).Methods("POST")
+	admin.HandleFunc("/servers/{code}/maintenance", h.EndMaintenance).Methods("DELETE")
+	admin.HandleFunc("/config/reload", h.ReloadConfig).Methods("POST")
+	admin.HandleFunc("/keys/reencrypt", h.ReencryptKeys).Methods("POST")
+	admin.HandleFunc("/links/redemptions", h.GetLinkRedemptions).Methods("GET")
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"p2nova-vpn/internal/config"
+	"p2nova-vpn/internal/middleware"
+	"p2nova-vpn/internal/repository"
+	"p2nova-vpn/internal/service"
+	"p2nova-vpn/pkg/wireguard"
+
+	"github.com/gorilla/mux"
+)
+
+const testAdminToken = "admin-secret"
+
+// testAPI serves the API the way cmd/api does, with one server, DE, whose
+// interface is an in-memory backend.
+type testAPI struct {
+	cfg     *config.Config
+	vpn     *service.VPNService
+	servers *service.ServerService
+	handler *Handler
+	router  *mux.Router
+	// backend is DE's interface
+	backend *wireguard.FakeBackend
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	return newTestAPIWithConfig(t, "")
+}
+
+// newTestAPIWithConfig is newTestAPI with a config file holding yaml, as if
+// passed with --config. Without yaml there is no config file, whatever
+// CONFIG_FILE says.
+func newTestAPIWithConfig(t *testing.T, yaml string) *testAPI {
+	t.Helper()
+
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, wireguard.KeyLen))
+	fleet := filepath.Join(t.TempDir(), "fleet.json")
+	data := `{"servers": [{"code": "DE", "endpoint": "192.0.2.1", "publicKey": "` + key + `", "subnet": "10.8.1.0/24", "interface": "wg-DE"}]}`
+	if err := os.WriteFile(fleet, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FLEET_FILE", fleet)
+	t.Setenv("GEO_PROVIDERS", "static")
+	t.Setenv("ADMIN_TOKEN", testAdminToken)
+
+	opts := &config.Options{}
+	if yaml != "" {
+		opts.File = filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(opts.File, []byte(yaml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg, err := config.Load(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := repository.NewSessionRepository()
+	servers, err := service.NewServerService(repository.NewServerRepository(), sessions, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg, err := service.NewWireguardService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	de := wireguard.NewFakeBackend()
+	backends := map[string]wireguard.Backend{"wg-DE": de}
+	wg.UseLocalBackends(func(iface string) wireguard.Backend {
+		mu.Lock()
+		defer mu.Unlock()
+		if backends[iface] == nil {
+			backends[iface] = wireguard.NewFakeBackend()
+		}
+		return backends[iface]
+	})
+	vpn := service.NewVPNService(sessions, servers, wg, cfg)
+	links, err := service.NewLinkService(repository.NewLinkRepository(), vpn, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(vpn, servers, links, service.NewReloader(opts, cfg, servers))
+	t.Cleanup(h.CloseStreams)
+
+	// The routes and middleware of cmd/api, under /api/v1
+	r := mux.NewRouter()
+	r.Use(middleware.CORS(cfg.Live.CORSOrigins))
+	r.Use(middleware.ClientInfo(cfg.TrustedProxies, cfg.ForwardedHeader, cfg.Geo))
+	r.Use(middleware.Recovery)
+	api := r.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/openapi.json", h.OpenAPI).Methods("GET")
+	Routes(api, h, cfg.AdminToken)
+
+	return &testAPI{cfg: cfg, vpn: vpn, servers: servers, handler: h, router: r, backend: de}
+}
+
+// do sends a request, with token as a bearer token unless empty.
+func (api *testAPI) do(t *testing.T, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	api.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// connect opens a session on DE and returns its ID and owner token.
+func (api *testAPI) connect(t *testing.T) (string, string) {
+	t.Helper()
+	rec := api.do(t, "POST", "/api/v1/vpn/connect", "", `{"serverCode": "DE"}`)
+	var resp struct {
+		Data struct {
+			SessionID string `json:"sessionId"`
+			Token     string `json:"token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK || resp.Data.Token == "" {
+		t.Fatalf("connect: %d %s", rec.Code, rec.Body)
+	}
+	return resp.Data.SessionID, resp.Data.Token
+}
+
+// errorCode returns the code of a JSON error response.
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error == nil {
+		t.Fatalf("not a JSON error: %d %s", rec.Code, rec.Body)
+	}
+	return resp.Error.Code
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/internal/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateConfigLink issues a sealed, expiring link that downloads a session's
+// config once, e.g. to open on a phone or scan as a QR code elsewhere. The
+// caller authenticates as for the session's config.
+func (h *Handler) CreateConfigLink(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["id"]
+	if err := h.vpnService.AuthorizeSession(sessionID, bearerToken(r)); err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	var req domain.LinkRequest
+	if r.ContentLength != 0 {
+		if err := DecodeJSON(r, &req); err != nil {
+			ErrorResponse(w, err)
+			return
+		}
+	}
+
+	token, link, err := h.linkService.CreateLink(sessionID, req)
+	if err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	SuccessResponse(w, http.StatusCreated, map[string]interface{}{
+		"url":       "/api/v1/vpn/links/" + token,
+		"format":    link.Format,
+		"expiresAt": link.ExpiresAt,
+	})
+}
+
+// RedeemConfigLink serves the config a link points to and uses the link
+// up. PNG codes take ?size= as on the config endpoint. The config is
+// rendered before the link is used, so a request that fails, e.g. on a bad
+// size, leaves the link for another try.
+func (h *Handler) RedeemConfigLink(w http.ResponseWriter, r *http.Request) {
+	client := middleware.ClientFromContext(r.Context())
+	if client == nil {
+		client = &domain.Client{IP: remoteIP(r)}
+	}
+
+	link, err := h.linkService.Open(mux.Vars(r)["token"], client)
+	if err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	rendered := newResponseBuffer()
+	h.serveSessionConfig(rendered, r, link.SessionID, link.Format, link.Platform)
+	if rendered.status < 400 {
+		if err := h.linkService.Redeem(link, client); err != nil {
+			ErrorResponse(w, err)
+			return
+		}
+	}
+	rendered.writeTo(w)
+}
+
+// responseBuffer holds a response until the handler knows it can send it.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: make(http.Header), status: http.StatusOK}
+}
+
+func (b *responseBuffer) Header() http.Header { return b.header }
+
+func (b *responseBuffer) Write(p []byte) (int, error) { return b.body.Write(p) }
+
+func (b *responseBuffer) WriteHeader(status int) { b.status = status }
+
+func (b *responseBuffer) writeTo(w http.ResponseWriter) {
+	for key, values := range b.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
+
+// GetLinkRedemptions returns the audit trail of link redemptions, for one
+// session with ?session=.
+func (h *Handler) GetLinkRedemptions(w http.ResponseWriter, r *http.Request) {
+	SuccessResponse(w, http.StatusOK, h.linkService.Redemptions(r.URL.Query().Get("session")))
+}
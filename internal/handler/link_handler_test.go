@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSessionConfigRequiresToken(t *testing.T) {
+	api := newTestAPI(t)
+	sessionID, token := api.connect(t)
+	_, other := api.connect(t)
+	path := "/api/v1/vpn/sessions/" + sessionID + "/config"
+
+	for _, bad := range []string{"", "wrong", other} {
+		rec := api.do(t, "GET", path, bad, "")
+		if rec.Code != http.StatusUnauthorized || errorCode(t, rec) != "unauthorized" || rec.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("token %q: %d %s", bad, rec.Code, rec.Body)
+		}
+		if strings.Contains(rec.Body.String(), "PrivateKey") {
+			t.Errorf("token %q got the config", bad)
+		}
+	}
+
+	for _, good := range []string{token, testAdminToken} {
+		rec := api.do(t, "GET", path, good, "")
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "PrivateKey = ") {
+			t.Errorf("token %q: %d %s", good, rec.Code, rec.Body)
+		}
+	}
+
+	// Only the admin learns that a session does not exist
+	if rec := api.do(t, "GET", "/api/v1/vpn/sessions/missing/config", testAdminToken, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("admin, unknown session: %d", rec.Code)
+	}
+	if rec := api.do(t, "GET", "/api/v1/vpn/sessions/missing/config", token, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("owner token, unknown session: %d", rec.Code)
+	}
+
+	// The token only counts as a bearer token
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Authorization", token)
+	rec := httptest.NewRecorder()
+	api.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("token without the Bearer scheme: %d", rec.Code)
+	}
+}
+
+// createLink issues a link to a session's config and returns its path.
+func createLink(t *testing.T, api *testAPI, sessionID, token, body string) string {
+	t.Helper()
+	rec := api.do(t, "POST", "/api/v1/vpn/sessions/"+sessionID+"/links", token, body)
+	var resp struct {
+		Data struct {
+			URL string `json:"url"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusCreated {
+		t.Fatalf("create link: %d %s", rec.Code, rec.Body)
+	}
+	return resp.Data.URL
+}
+
+func TestCreateConfigLinkRequiresToken(t *testing.T) {
+	api := newTestAPI(t)
+	sessionID, token := api.connect(t)
+	_, other := api.connect(t)
+	path := "/api/v1/vpn/sessions/" + sessionID + "/links"
+
+	for _, bad := range []string{"", other} {
+		if rec := api.do(t, "POST", path, bad, ""); rec.Code != http.StatusUnauthorized || errorCode(t, rec) != "unauthorized" {
+			t.Errorf("token %q: %d %s", bad, rec.Code, rec.Body)
+		}
+	}
+
+	url := createLink(t, api, sessionID, token, `{"expiresIn": 30}`)
+	if !strings.HasPrefix(url, "/api/v1/vpn/links/") || strings.Contains(url, sessionID) {
+		t.Errorf("url = %s", url)
+	}
+	createLink(t, api, sessionID, testAdminToken, "")
+
+	if rec := api.do(t, "POST", path, token, `{"expiresIn": 1441}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expiresIn above a day: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRedeemConfigLinkKeepsLinkOnFailure(t *testing.T) {
+	api := newTestAPI(t)
+	sessionID, token := api.connect(t)
+	url := createLink(t, api, sessionID, token, `{"format": "png"}`)
+
+	// A bad size fails before the link is used
+	if rec := api.do(t, "GET", url+"?size=5", "", ""); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("bad size: %d %s", rec.Code, rec.Body)
+	}
+	if rec := api.do(t, "GET", "/api/v1/links/redemptions", testAdminToken, ""); strings.Contains(rec.Body.String(), sessionID) {
+		t.Errorf("failed download recorded: %s", rec.Body)
+	}
+
+	rec := api.do(t, "GET", url+"?size=256", "", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("redeem: %d %v", rec.Code, rec.Header())
+	}
+
+	rec = api.do(t, "GET", url, "", "")
+	if rec.Code != http.StatusGone || errorCode(t, rec) != "link_used" {
+		t.Errorf("second redeem: %d %s", rec.Code, rec.Body)
+	}
+	if rec := api.do(t, "GET", "/api/v1/links/redemptions", testAdminToken, ""); strings.Count(rec.Body.String(), sessionID) != 1 {
+		t.Errorf("redemptions = %s", rec.Body)
+	}
+}
@@ -0,0 +1,18 @@
+package handler
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPI describes the /api/v1 endpoints. Keep it in step with the routes
+// and the domain types.
+//
+//go:embed openapi.json
+var openAPI []byte
+
+// OpenAPI serves the OpenAPI 3 document of the API.
+func (h *Handler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPI)
+}
@@ -0,0 +1,400 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"p2nova-vpn/internal/domain"
+
+	"github.com/gorilla/mux"
+)
+
+// apiSpec is the embedded OpenAPI document, decoded for the contract tests.
+type apiSpec map[string]interface{}
+
+func loadSpec(t *testing.T) apiSpec {
+	t.Helper()
+	var spec apiSpec
+	if err := json.Unmarshal(openAPI, &spec); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	return spec
+}
+
+// lookup follows a path of keys through the document.
+func (s apiSpec) lookup(keys ...string) map[string]interface{} {
+	node := map[string]interface{}(s)
+	for _, key := range keys {
+		next, _ := node[key].(map[string]interface{})
+		if next == nil {
+			return nil
+		}
+		node = next
+	}
+	return node
+}
+
+// resolve follows a $ref to the object it names.
+func (s apiSpec) resolve(node map[string]interface{}) map[string]interface{} {
+	for node != nil {
+		ref, ok := node["$ref"].(string)
+		if !ok {
+			return node
+		}
+		node = s.lookup(strings.Split(strings.TrimPrefix(ref, "#/"), "/")...)
+	}
+	return nil
+}
+
+// flatten resolves a schema and merges its allOf parts into one.
+func (s apiSpec) flatten(schema map[string]interface{}) map[string]interface{} {
+	schema = s.resolve(schema)
+	parts, ok := schema["allOf"].([]interface{})
+	if !ok {
+		return schema
+	}
+	merged := map[string]interface{}{}
+	properties := map[string]interface{}{}
+	var required []interface{}
+	for _, part := range parts {
+		part := s.flatten(part.(map[string]interface{}))
+		for key, value := range part {
+			merged[key] = value
+		}
+		for name, property := range part["properties"].(map[string]interface{}) {
+			properties[name] = property
+		}
+		if r, ok := part["required"].([]interface{}); ok {
+			required = append(required, r...)
+		}
+	}
+	merged["properties"] = properties
+	merged["required"] = required
+	return merged
+}
+
+// validate checks a decoded JSON value against a schema and returns every
+// mismatch, naming where in the value it is.
+func (s apiSpec) validate(where string, schema map[string]interface{}, value interface{}) []string {
+	schema = s.flatten(schema)
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, where+": "+fmt.Sprintf(format, args...))
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			found = found || allowed == value
+		}
+		if !found {
+			fail("%v is not one of %v", value, enum)
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			fail("want an object, got %T", value)
+			break
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				fail("required %s is missing", name)
+			}
+		}
+		for name, field := range object {
+			property, ok := properties[name].(map[string]interface{})
+			switch {
+			case ok:
+				problems = append(problems, s.validate(where+"."+name, property, field)...)
+			case schema["additionalProperties"] == nil || schema["additionalProperties"] == false:
+				fail("%s is not in the spec", name)
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			fail("want an array, got %T", value)
+			break
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range array {
+			problems = append(problems, s.validate(fmt.Sprintf("%s[%d]", where, i), items, item)...)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			fail("want a string, got %T", value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("want a boolean, got %T", value)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			fail("want a number, got %T", value)
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != float64(int64(n)) {
+			fail("want an integer, got %v", value)
+		}
+	}
+	return problems
+}
+
+// jsonFields maps the JSON names of a struct type to their fields. Embedded
+// structs contribute their own fields.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			for name, f := range jsonFields(embedded) {
+				fields[name] = f
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// schemaType is the JSON schema type a Go type encodes as; empty for any.
+func schemaType(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+		return "array"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	}
+	return ""
+}
+
+// TestSchemasMatchTypes fails when a request or response type gains, loses
+// or changes a field without the spec following.
+func TestSchemasMatchTypes(t *testing.T) {
+	spec := loadSpec(t)
+	types := map[string]interface{}{
+		"Response":          Response{},
+		"ErrorBody":         ErrorBody{},
+		"ConnectRequest":    domain.ConnectRequest{},
+		"DisconnectRequest": domain.DisconnectRequest{},
+		"VPNStatus":         domain.VPNStatus{},
+		"Notice":            domain.Notice{},
+		"SpeedTest":         domain.SpeedTest{},
+		"HandshakeEvent":    domain.HandshakeEvent{},
+		"TransferEvent":     domain.TransferEvent{},
+		"TunnelParams":      domain.TunnelParams{},
+		"TunnelConfig":      domain.TunnelConfig{},
+		"Selection":         domain.Selection{},
+		"LinkRequest":       domain.LinkRequest{},
+		"LinkRedemption":    domain.LinkRedemption{},
+	}
+
+	for name, value := range types {
+		schema := spec.lookup("components", "schemas", name)
+		if schema == nil {
+			t.Errorf("%s: no schema", name)
+			continue
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		fields := jsonFields(reflect.TypeOf(value))
+
+		for field, sf := range fields {
+			property, ok := properties[field].(map[string]interface{})
+			if !ok {
+				t.Errorf("%s.%s is not in the spec", name, field)
+				continue
+			}
+			want := schemaType(sf.Type)
+			if got, _ := spec.resolve(property)["type"].(string); want != "" && got != "" && got != want {
+				t.Errorf("%s.%s: spec says %s, Go encodes %s", name, field, got, want)
+			}
+		}
+		for property := range properties {
+			if _, ok := fields[property]; !ok {
+				t.Errorf("%s.%s is in the spec but not in %T", name, property, value)
+			}
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, field := range required {
+			if sf, ok := fields[field.(string)]; ok && strings.Contains(sf.Tag.Get("json"), "omitempty") {
+				t.Errorf("%s.%s is required but omitted when empty", name, field)
+			}
+		}
+	}
+}
+
+func TestErrorCodesInSpec(t *testing.T) {
+	spec := loadSpec(t)
+	enum := spec.lookup("components", "schemas", "ErrorBody", "properties", "code")["enum"].([]interface{})
+	listed := make(map[string]bool)
+	for _, code := range enum {
+		listed[code.(string)] = true
+	}
+
+	for _, code := range domain.ErrorCodes() {
+		if !listed[code] {
+			t.Errorf("error code %s is not in the spec", code)
+		}
+		delete(listed, code)
+	}
+	var extra []string
+	for code := range listed {
+		extra = append(extra, code)
+	}
+	sort.Strings(extra)
+	if len(extra) > 0 {
+		t.Errorf("the spec lists codes no error has: %v", extra)
+	}
+}
+
+// TestRoutesInSpec fails when a route is served that the spec does not
+// describe.
+func TestRoutesInSpec(t *testing.T) {
+	spec := loadSpec(t)
+	api := newTestAPI(t)
+	err := api.router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			if spec.lookup("paths", strings.TrimPrefix(path, "/api/v1"), strings.ToLower(method)) == nil {
+				t.Errorf("%s %s is not in the spec", method, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkResponse validates a recorded JSON response against the spec of the
+// operation that produced it.
+func checkResponse(t *testing.T, spec apiSpec, method, path string, rec *httptest.ResponseRecorder) {
+	t.Helper()
+	responses := spec.lookup("paths", path, strings.ToLower(method), "responses")
+	response, _ := responses[fmt.Sprint(rec.Code)].(map[string]interface{})
+	response = spec.resolve(response)
+	if response == nil {
+		t.Errorf("%s %s: status %d is not in the spec", method, path, rec.Code)
+		return
+	}
+	content, _ := response["content"].(map[string]interface{})
+	media, _ := content["application/json"].(map[string]interface{})
+	if media == nil {
+		t.Errorf("%s %s: %d is not JSON in the spec", method, path, rec.Code)
+		return
+	}
+
+	var body interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	for _, problem := range spec.validate("response", media["schema"].(map[string]interface{}), body) {
+		t.Errorf("%s %s %d: %s", method, path, rec.Code, problem)
+	}
+}
+
+// TestResponsesMatchSpec runs the handlers and checks what they send,
+// including the responses built from maps rather than types.
+func TestResponsesMatchSpec(t *testing.T) {
+	spec := loadSpec(t)
+	api := newTestAPI(t)
+
+	// The request body sent is one the spec allows
+	connect := `{"serverCode": "DE", "plan": "", "platform": "linux", "tunnel": {}}`
+	var req map[string]interface{}
+	if err := json.Unmarshal([]byte(connect), &req); err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range spec.validate("request", spec.lookup("components", "schemas", "ConnectRequest"), req) {
+		t.Error(problem)
+	}
+
+	rec := api.do(t, "POST", "/api/v1/vpn/connect", "", connect)
+	checkResponse(t, spec, "POST", "/vpn/connect", rec)
+	var connected struct {
+		Data struct {
+			SessionID string `json:"sessionId"`
+			Token     string `json:"token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &connected); err != nil {
+		t.Fatal(err)
+	}
+	sessionID, token := connected.Data.SessionID, connected.Data.Token
+
+	tests := []struct {
+		method, path, specPath, token, body string
+		status                              int
+	}{
+		{"GET", "/api/v1/vpn/status?sessionId=" + sessionID, "/vpn/status", token, "", http.StatusOK},
+		{"GET", "/api/v1/vpn/status?sessionId=" + sessionID, "/vpn/status", "", "", http.StatusUnauthorized},
+		{"GET", "/api/v1/vpn/status?sessionId=missing", "/vpn/status", testAdminToken, "", http.StatusNotFound},
+		{"GET", "/api/v1/vpn/speed", "/vpn/speed", "", "", http.StatusOK},
+		{"GET", "/api/v1/servers", "/servers", "", "", http.StatusOK},
+		{"POST", "/api/v1/vpn/connect", "/vpn/connect", "", `{"serverCode": "XX"}`, http.StatusNotFound},
+		{"POST", "/api/v1/vpn/connect", "/vpn/connect", "", `{"serverCode":`, http.StatusBadRequest},
+		{"GET", "/api/v1/vpn/sessions/" + sessionID + "/config?format=json", "/vpn/sessions/{id}/config", token, "", http.StatusOK},
+		{"GET", "/api/v1/vpn/sessions/" + sessionID + "/config", "/vpn/sessions/{id}/config", "", "", http.StatusUnauthorized},
+		{"GET", "/api/v1/vpn/sessions/" + sessionID + "/config?format=pdf", "/vpn/sessions/{id}/config", token, "", http.StatusUnprocessableEntity},
+		{"POST", "/api/v1/vpn/sessions/" + sessionID + "/links", "/vpn/sessions/{id}/links", token, `{"expiresIn": 5}`, http.StatusCreated},
+		{"GET", "/api/v1/vpn/links/nope", "/vpn/links/{token}", "", "", http.StatusNotFound},
+		{"GET", "/api/v1/links/redemptions", "/links/redemptions", testAdminToken, "", http.StatusOK},
+		{"GET", "/api/v1/links/redemptions", "/links/redemptions", "nope", "", http.StatusUnauthorized},
+		{"POST", "/api/v1/vpn/disconnect", "/vpn/disconnect", "nope", `{"sessionId": "` + sessionID + `"}`, http.StatusUnauthorized},
+		{"POST", "/api/v1/vpn/disconnect", "/vpn/disconnect", token, `{"sessionId": "` + sessionID + `"}`, http.StatusOK},
+		{"POST", "/api/v1/vpn/disconnect", "/vpn/disconnect", token, `{"sessionId": "` + sessionID + `"}`, http.StatusGone},
+		{"GET", "/api/v1/vpn/status?sessionId=" + sessionID, "/vpn/status", token, "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := api.do(t, tt.method, tt.path, tt.token, tt.body)
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: got %d, want %d: %s", tt.method, tt.path, rec.Code, tt.status, rec.Body)
+			continue
+		}
+		checkResponse(t, spec, tt.method, tt.specPath, rec)
+	}
+}
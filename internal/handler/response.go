@@ -2,13 +2,41 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/internal/logging"
 )
 
 type Response struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Error   *ErrorBody  `json:"error,omitempty"`
+}
+
+// ErrorBody describes a failed request. Code is stable for clients to act
+// on; Message is for people and may change.
+type ErrorBody struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+var kindStatus = map[domain.Kind]int{
+	domain.KindInternal:    http.StatusInternalServerError,
+	domain.KindMalformed:   http.StatusBadRequest,
+	domain.KindInvalid:     http.StatusUnprocessableEntity,
+	domain.KindNotFound:    http.StatusNotFound,
+	domain.KindConflict:    http.StatusConflict,
+	domain.KindGone:        http.StatusGone,
+	domain.KindRateLimited: http.StatusTooManyRequests,
+	domain.KindUnavailable: http.StatusServiceUnavailable,
+
+	domain.KindUnauthorized: http.StatusUnauthorized,
+	domain.KindForbidden:    http.StatusForbidden,
 }
 
 func SuccessResponse(w http.ResponseWriter, status int, data interface{}) {
@@ -20,15 +48,54 @@ func SuccessResponse(w http.ResponseWriter, status int, data interface{}) {
 	})
 }
 
-func ErrorResponse(w http.ResponseWriter, status int, message string) {
+// ErrorResponse answers with err's code and the status of its kind. Errors
+// that are not domain errors are internal_error with 500. A 500 never tells
+// the client more than that; the error itself is logged.
+func ErrorResponse(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	body := &ErrorBody{Code: domain.ErrInternal.Code, Message: err.Error()}
+
+	var domainErr *domain.Error
+	if errors.As(err, &domainErr) {
+		body.Code = domainErr.Code
+		if s, ok := kindStatus[domainErr.Kind]; ok {
+			status = s
+		}
+	}
+	if status == http.StatusInternalServerError {
+		logging.Errorf("Request failed: %v", err)
+		body.Code, body.Message = domain.ErrInternal.Code, domain.ErrInternal.Message
+	}
+	var detailed *domain.DetailedError
+	if errors.As(err, &detailed) {
+		body.Details = detailed.Details
+	}
+
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(Response{
 		Success: false,
-		Error:   message,
+		Error:   body,
 	})
 }
 
+// bearerToken returns the token of an Authorization: Bearer header.
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return token
+}
+
+// DecodeJSON reads the request body into v. Failures are
+// domain.ErrMalformedRequest.
 func DecodeJSON(r *http.Request, v interface{}) error {
-	return json.NewDecoder(r.Body).Decode(v)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrMalformedRequest, err)
+	}
+	return nil
 }
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"p2nova-vpn/internal/domain"
+)
+
+func TestErrorResponse(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		err     error
+		status  int
+		code    string
+		message string
+	}{
+		{domain.ErrServerNotFound, http.StatusNotFound, "server_not_found", "server not found"},
+		{fmt.Errorf("%w: plan gold", domain.ErrPlanNotFound), http.StatusUnprocessableEntity, "plan_not_found", "plan not found: plan gold"},
+		{fmt.Errorf("%w: bad json", domain.ErrMalformedRequest), http.StatusBadRequest, "malformed_request", "malformed request: bad json"},
+		{domain.ErrAddressPoolExhausted, http.StatusServiceUnavailable, "address_pool_exhausted", "no client address available"},
+		{errors.New("disk on fire"), http.StatusInternalServerError, "internal_error", "internal error"},
+		{fmt.Errorf("%w: disk on fire", domain.ErrInternal), http.StatusInternalServerError, "internal_error", "internal error"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		ErrorResponse(rec, tt.err)
+		var resp Response
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Success || resp.Error == nil {
+			t.Fatalf("%v: body %s", tt.err, rec.Body)
+		}
+		if rec.Code != tt.status || resp.Error.Code != tt.code || resp.Error.Message != tt.message {
+			t.Errorf("%v: %d %+v, want %d %s", tt.err, rec.Code, resp.Error, tt.status, tt.code)
+		}
+		if rec.Header().Get("Content-Type") != "application/json" || rec.Header().Get("WWW-Authenticate") != "" {
+			t.Errorf("%v: headers %v", tt.err, rec.Header())
+		}
+	}
+	if strings.Count(logged.String(), "disk on fire") != 2 {
+		t.Errorf("internal errors not logged:\n%s", logged.String())
+	}
+
+	rec := httptest.NewRecorder()
+	ErrorResponse(rec, domain.WithDetails(
+		fmt.Errorf("%w: unknown format", domain.ErrInvalidRequest),
+		map[string]interface{}{"allowed": []string{"ini"}},
+	))
+	if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != "invalid_request" ||
+		rec.Body.String() != `{"success":false,"error":{"code":"invalid_request","message":"invalid request: unknown format","details":{"allowed":["ini"]}}}`+"\n" {
+		t.Errorf("detailed error: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	ErrorResponse(rec, domain.ErrUnauthorized)
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("unauthorized: %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestKindStatus(t *testing.T) {
+	for kind := domain.KindInternal; kind <= domain.KindForbidden; kind++ {
+		if _, ok := kindStatus[kind]; !ok {
+			t.Errorf("kind %d has no status", kind)
+		}
+	}
+}
@@ -1,13 +1,66 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/pkg/country"
+
+	"github.com/gorilla/mux"
 )
 
+// GetServers lists servers, optionally filtered by ?tag=, ?country= and
+// ?continent=, ordered by ?sort=load|latency|name and grouped with
+// ?groupBy=continent.
 func (h *Handler) GetServers(w http.ResponseWriter, r *http.Request) {
-	servers, err := h.serverService.ListServers()
+	query := r.URL.Query()
+	filter := domain.ServerFilter{
+		Tag:     query.Get("tag"),
+		Country: query.Get("country"),
+		Sort:    query.Get("sort"),
+	}
+
+	if c := query.Get("continent"); c != "" {
+		continent, ok := country.ParseContinent(c)
+		if !ok {
+			ErrorResponse(w, fmt.Errorf("%w: unknown continent %q", domain.ErrInvalidRequest, c))
+			return
+		}
+		filter.Continent = string(continent)
+	}
+
+	switch filter.Sort {
+	case "", "code", "name", "load", "latency":
+	default:
+		ErrorResponse(w, domain.WithDetails(
+			fmt.Errorf("%w: unknown sort %q", domain.ErrInvalidRequest, filter.Sort),
+			map[string]interface{}{"allowed": []string{"code", "name", "load", "latency"}},
+		))
+		return
+	}
+
+	switch query.Get("groupBy") {
+	case "":
+	case "continent":
+		groups, err := h.serverService.GroupByContinent(filter)
+		if err != nil {
+			ErrorResponse(w, err)
+			return
+		}
+		SuccessResponse(w, http.StatusOK, groups)
+		return
+	default:
+		ErrorResponse(w, domain.WithDetails(
+			fmt.Errorf("%w: unknown groupBy %q", domain.ErrInvalidRequest, query.Get("groupBy")),
+			map[string]interface{}{"allowed": []string{"continent"}},
+		))
+		return
+	}
+
+	servers, err := h.serverService.ListServers(filter)
 	if err != nil {
-		ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		ErrorResponse(w, err)
 		return
 	}
 
@@ -20,13 +73,90 @@ func (h *Handler) SelectServer(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := DecodeJSON(r, &req); err != nil {
-		ErrorResponse(w, http.StatusBadRequest, "Invalid request")
+		ErrorResponse(w, err)
 		return
 	}
 
 	server, err := h.serverService.GetServer(req.ServerCode)
 	if err != nil {
-		ErrorResponse(w, http.StatusNotFound, err.Error())
+		ErrorResponse(w, err)
+		return
+	}
+
+	SuccessResponse(w, http.StatusOK, server)
+}
+
+func (h *Handler) CreateServer(w http.ResponseWriter, r *http.Request) {
+	var req domain.ServerRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	server, err := h.serverService.CreateServer(req)
+	if err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	SuccessResponse(w, http.StatusCreated, server)
+}
+
+func (h *Handler) UpdateServer(w http.ResponseWriter, r *http.Request) {
+	var req domain.ServerRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	server, err := h.serverService.UpdateServer(mux.Vars(r)["code"], req)
+	if err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	SuccessResponse(w, http.StatusOK, server)
+}
+
+// DeleteServer removes a server. Servers with active sessions need either
+// ?drain=true or ?force=true.
+func (h *Handler) DeleteServer(w http.ResponseWriter, r *http.Request) {
+	code := mux.Vars(r)["code"]
+	force := r.URL.Query().Get("force") == "true"
+	drain := r.URL.Query().Get("drain") == "true"
+
+	if err := h.vpnService.RemoveServer(code, force, drain); err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	if _, err := h.serverService.GetServer(code); err == nil {
+		SuccessResponse(w, http.StatusAccepted, map[string]string{"status": "draining"})
+		return
+	}
+	SuccessResponse(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func (h *Handler) StartMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req domain.MaintenanceRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	server, err := h.serverService.StartMaintenance(mux.Vars(r)["code"], req)
+	if err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	SuccessResponse(w, http.StatusOK, server)
+}
+
+func (h *Handler) EndMaintenance(w http.ResponseWriter, r *http.Request) {
+	server, err := h.serverService.EndMaintenance(mux.Vars(r)["code"])
+	if err != nil {
+		ErrorResponse(w, err)
 		return
 	}
 
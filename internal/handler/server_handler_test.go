@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/pkg/wireguard"
+)
+
+// servers decodes a server listing.
+func servers(t *testing.T, api *testAPI, path string) []domain.Server {
+	t.Helper()
+	rec := api.do(t, "GET", path, "", "")
+	var resp struct {
+		Data []domain.Server `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: %d %s", path, rec.Code, rec.Body)
+	}
+	return resp.Data
+}
+
+func TestGetServersHealth(t *testing.T) {
+	api := newTestAPI(t)
+
+	if list := servers(t, api, "/api/v1/servers"); len(list) != 1 || list[0].Health != domain.HealthUnknown {
+		t.Fatalf("before a check: %+v", list)
+	}
+
+	api.servers.SetHealth("DE", domain.HealthDown, "peer API failed", 0)
+	list := servers(t, api, "/api/v1/servers")
+	if list[0].Health != domain.HealthDown || list[0].HealthDetail != "peer API failed" || list[0].LastChecked < time.Now().Add(-time.Minute).Unix() {
+		t.Errorf("after a failed check: %+v", list[0])
+	}
+
+	rec := api.do(t, "POST", "/api/v1/vpn/connect", "", `{"serverCode": "DE"}`)
+	if rec.Code != http.StatusServiceUnavailable || errorCode(t, rec) != "server_down" {
+		t.Errorf("connect to a down server: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestServerRegistry(t *testing.T) {
+	api := newTestAPI(t)
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, wireguard.KeyLen))
+	fr := `{"code": "FR", "name": "Paris", "endpoint": "fr.example.com", "publicKey": "` + key + `", "subnet": "10.8.2.0/24", "country": "FR"}`
+
+	if rec := api.do(t, "POST", "/api/v1/servers", "", fr); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("create without the admin token: %d", rec.Code)
+	}
+
+	rec := api.do(t, "POST", "/api/v1/servers", testAdminToken, fr)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+	if rec := api.do(t, "POST", "/api/v1/servers", testAdminToken, fr); rec.Code != http.StatusConflict || errorCode(t, rec) != "server_exists" {
+		t.Errorf("duplicate create: %d %s", rec.Code, rec.Body)
+	}
+	if rec := api.do(t, "POST", "/api/v1/servers", testAdminToken, `{"code": "NL"}`); rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != "invalid_request" {
+		t.Errorf("invalid create: %d %s", rec.Code, rec.Body)
+	}
+	if list := servers(t, api, "/api/v1/servers"); len(list) != 2 || list[1].Code != "FR" || list[1].Name != "Paris" {
+		t.Fatalf("listing after create: %+v", list)
+	}
+
+	renamed := strings.Replace(fr, "Paris", "Lyon", 1)
+	if rec := api.do(t, "PUT", "/api/v1/servers/FR", testAdminToken, renamed); rec.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", rec.Code, rec.Body)
+	}
+	if rec := api.do(t, "PUT", "/api/v1/servers/NL", testAdminToken, renamed); rec.Code != http.StatusNotFound {
+		t.Errorf("update of an unknown server: %d", rec.Code)
+	}
+	if list := servers(t, api, "/api/v1/servers"); list[1].Name != "Lyon" {
+		t.Errorf("listing after update: %+v", list[1])
+	}
+
+	if rec := api.do(t, "DELETE", "/api/v1/servers/FR", testAdminToken, ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", rec.Code, rec.Body)
+	}
+	if rec := api.do(t, "DELETE", "/api/v1/servers/FR", testAdminToken, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("second delete: %d", rec.Code)
+	}
+}
+
+func TestDeleteServerWithSessions(t *testing.T) {
+	api := newTestAPI(t)
+	sessionID, token := api.connect(t)
+
+	rec := api.do(t, "DELETE", "/api/v1/servers/DE", testAdminToken, "")
+	if rec.Code != http.StatusConflict || errorCode(t, rec) != "server_has_sessions" {
+		t.Fatalf("plain delete: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = api.do(t, "DELETE", "/api/v1/servers/DE?drain=true", testAdminToken, "")
+	if rec.Code != http.StatusAccepted || !strings.Contains(rec.Body.String(), `"draining"`) {
+		t.Fatalf("drain: %d %s", rec.Code, rec.Body)
+	}
+	if rec := api.do(t, "POST", "/api/v1/vpn/connect", "", `{"serverCode": "DE"}`); rec.Code != http.StatusServiceUnavailable || errorCode(t, rec) != "server_draining" {
+		t.Errorf("connect to a draining server: %d %s", rec.Code, rec.Body)
+	}
+
+	api.do(t, "POST", "/api/v1/vpn/disconnect", token, `{"sessionId": "`+sessionID+`"}`)
+	if list := servers(t, api, "/api/v1/servers"); len(list) != 0 {
+		t.Errorf("drained server kept after its last session: %+v", list)
+	}
+}
+
+func TestMaintenanceEndpoints(t *testing.T) {
+	api := newTestAPI(t)
+	sessionID, token := api.connect(t)
+
+	if rec := api.do(t, "POST", "/api/v1/servers/DE/maintenance", testAdminToken, `{"action": "reboot"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown action: %d %s", rec.Code, rec.Body)
+	}
+	if rec := api.do(t, "POST", "/api/v1/servers/XX/maintenance", testAdminToken, `{}`); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown server: %d %s", rec.Code, rec.Body)
+	}
+
+	rec := api.do(t, "POST", "/api/v1/servers/DE/maintenance", testAdminToken, `{"reason": "kernel update", "minutes": 10}`)
+	var resp struct {
+		Data domain.Server `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("start: %d %s", rec.Code, rec.Body)
+	}
+	if resp.Data.State != domain.ServerMaintenance || resp.Data.Maintenance == nil || resp.Data.Maintenance.Reason != "kernel update" {
+		t.Errorf("server after start: %+v", resp.Data)
+	}
+
+	rec = api.do(t, "GET", "/api/v1/vpn/status?sessionId="+sessionID, token, "")
+	var status struct {
+		Data domain.VPNStatus `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if notice := status.Data.Notice; notice == nil || notice.Type != domain.NoticeMaintenance || notice.Deadline != resp.Data.Maintenance.Deadline {
+		t.Errorf("status notice = %+v", notice)
+	}
+	if rec := api.do(t, "POST", "/api/v1/vpn/connect", "", `{"serverCode": "DE"}`); rec.Code != http.StatusServiceUnavailable || errorCode(t, rec) != "server_maintenance" {
+		t.Errorf("connect during maintenance: %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := api.do(t, "DELETE", "/api/v1/servers/DE/maintenance", testAdminToken, ""); rec.Code != http.StatusOK {
+		t.Fatalf("end: %d %s", rec.Code, rec.Body)
+	}
+	api.connect(t)
+}
+
+func TestGetServersQuery(t *testing.T) {
+	api := newTestAPI(t)
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, wireguard.KeyLen))
+	fr := `{"code": "FR", "endpoint": "fr.example.com", "publicKey": "` + key + `", "subnet": "10.8.2.0/24", "country": "FR", "tags": ["p2p"]}`
+	if rec := api.do(t, "POST", "/api/v1/servers", testAdminToken, fr); rec.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+	api.connect(t)
+
+	codes := func(query string) string {
+		var out []string
+		for _, server := range servers(t, api, "/api/v1/servers"+query) {
+			out = append(out, server.Code)
+		}
+		return strings.Join(out, ",")
+	}
+	tests := []struct{ query, want string }{
+		{"", "DE,FR"},
+		{"?tag=P2P", "FR"},
+		{"?country=fr", "FR"},
+		{"?sort=load", "FR,DE"},
+	}
+	for _, tt := range tests {
+		if got := codes(tt.query); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.query, got, tt.want)
+		}
+	}
+
+	rec := api.do(t, "GET", "/api/v1/servers?sort=random", "", "")
+	if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != "invalid_request" {
+		t.Errorf("unknown sort: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestGetServersByContinent(t *testing.T) {
+	api := newTestAPI(t)
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, wireguard.KeyLen))
+	ke := `{"code": "KE", "endpoint": "ke.example.com", "publicKey": "` + key + `", "subnet": "10.8.2.0/24", "country": "KE"}`
+	if rec := api.do(t, "POST", "/api/v1/servers", testAdminToken, ke); rec.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+
+	if list := servers(t, api, "/api/v1/servers?continent=af"); len(list) != 1 || list[0].Code != "KE" || list[0].CountryName != "Kenya" {
+		t.Errorf("African servers: %+v", list)
+	}
+
+	rec := api.do(t, "GET", "/api/v1/servers?groupBy=continent", "", "")
+	var resp struct {
+		Data []domain.ServerGroup `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("grouped: %d %s", rec.Code, rec.Body)
+	}
+	var got []string
+	for _, group := range resp.Data {
+		for _, server := range group.Servers {
+			got = append(got, group.Name+":"+server.Code)
+		}
+	}
+	if strings.Join(got, " ") != "Africa:KE Europe:DE" {
+		t.Errorf("groups = %v", got)
+	}
+
+	for _, query := range []string{"?continent=Atlantis", "?groupBy=city"} {
+		rec := api.do(t, "GET", "/api/v1/servers"+query, "", "")
+		if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != "invalid_request" {
+			t.Errorf("%s: %d %s", query, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/internal/service"
+
+	"github.com/gorilla/mux"
+	"github.com/skip2/go-qrcode"
+)
+
+// QR code sizes, in pixels, accepted for PNG output
+const (
+	defaultQRSize = 512
+	minQRSize     = 128
+	maxQRSize     = 2048
+)
+
+// configFormats lists the ?format= values, for error details
+var configFormats = []string{
+	domain.ConfigFormatINI, domain.ConfigFormatConf, domain.ConfigFormatJSON, domain.ConfigFormatPNG, domain.ConfigFormatSVG,
+	domain.ConfigFormatUCI, domain.ConfigFormatNM, domain.ConfigFormatRouterOS, domain.ConfigFormatMobileConfig,
+}
+
+// GetSessionConfig serves a connected session's client config. ?format=
+// selects ini (default), conf (an attachment for wg-quick), json, or a QR
+// code as png or svg for the mobile apps to scan. PNG codes take ?size= in
+// pixels, and ?platform= renders the operator's template for that platform.
+//
+// The export formats uci (OpenWrt), nmconnection (NetworkManager), routeros
+// (MikroTik script) and mobileconfig (Apple profile) are served as
+// downloads. Profiles connect on demand unless ?ondemand=false, staying off
+// on the Wi-Fi networks listed in ?trusted=.
+//
+// The caller authenticates with the session's owner token from connect, or
+// the admin token, as a bearer token.
+func (h *Handler) GetSessionConfig(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["id"]
+	if err := h.vpnService.AuthorizeSession(sessionID, bearerToken(r)); err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = domain.ConfigFormatINI
+	}
+	platform := strings.ToLower(r.URL.Query().Get("platform"))
+	h.serveSessionConfig(w, r, sessionID, format, platform)
+}
+
+// serveSessionConfig writes a session's config in format. Other options
+// come from the query.
+func (h *Handler) serveSessionConfig(w http.ResponseWriter, r *http.Request, sessionID, format, platform string) {
+	if domain.IsExportFormat(format) {
+		h.exportSessionConfig(w, r, sessionID, format, platform)
+		return
+	}
+
+	session, secrets, err := h.vpnService.SessionConfig(sessionID, platform)
+	if err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	size := defaultQRSize
+	if s := r.URL.Query().Get("size"); s != "" {
+		if size, err = strconv.Atoi(s); err != nil || size < minQRSize || size > maxQRSize {
+			ErrorResponse(w, domain.WithDetails(
+				fmt.Errorf("%w: size must be %d to %d", domain.ErrInvalidRequest, minQRSize, maxQRSize),
+				map[string]interface{}{"min": minQRSize, "max": maxQRSize},
+			))
+			return
+		}
+	}
+
+	// The config carries the client's private key
+	w.Header().Set("Cache-Control", "no-store")
+	writeSessionConfig(w, session, secrets, format, size)
+}
+
+// writeSessionConfig renders a session's config in the given format.
+func writeSessionConfig(w http.ResponseWriter, session *domain.Session, secrets *domain.SessionSecrets, format string, size int) {
+	switch format {
+	case domain.ConfigFormatINI:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(secrets.PeerConfig + "\n"))
+
+	case domain.ConfigFormatConf:
+		// wg-quick names the interface after the file
+		name := service.InterfaceName(session.ServerCode)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.conf"`, name))
+		w.Write([]byte(secrets.PeerConfig + "\n"))
+
+	case domain.ConfigFormatJSON:
+		SuccessResponse(w, http.StatusOK, secrets.Tunnel)
+
+	case domain.ConfigFormatPNG, domain.ConfigFormatSVG:
+		code, err := qrcode.New(secrets.PeerConfig, qrcode.Medium)
+		if err != nil {
+			ErrorResponse(w, fmt.Errorf("failed to encode QR code: %w", err))
+			return
+		}
+
+		if format == domain.ConfigFormatSVG {
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write(qrSVG(code.Bitmap()))
+			return
+		}
+
+		png, err := code.PNG(size)
+		if err != nil {
+			ErrorResponse(w, fmt.Errorf("failed to encode QR code: %w", err))
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+
+	default:
+		ErrorResponse(w, domain.WithDetails(
+			fmt.Errorf("%w: unknown format %q", domain.ErrInvalidRequest, format),
+			map[string]interface{}{"allowed": configFormats},
+		))
+	}
+}
+
+func (h *Handler) exportSessionConfig(w http.ResponseWriter, r *http.Request, sessionID, format, platform string) {
+	opts := domain.ExportOptions{Platform: platform, OnDemand: true}
+	if s := r.URL.Query().Get("ondemand"); s != "" {
+		onDemand, err := strconv.ParseBool(s)
+		if err != nil {
+			ErrorResponse(w, fmt.Errorf("%w: ondemand must be true or false", domain.ErrInvalidRequest))
+			return
+		}
+		opts.OnDemand = onDemand
+	}
+	for _, ssid := range strings.Split(r.URL.Query().Get("trusted"), ",") {
+		if ssid = strings.TrimSpace(ssid); ssid != "" {
+			opts.TrustedSSIDs = append(opts.TrustedSSIDs, ssid)
+		}
+	}
+
+	export, err := h.vpnService.ExportConfig(sessionID, format, opts)
+	if err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	// The export carries the client's private key
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", export.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, export.FileName))
+	w.Write(export.Content)
+}
+
+// qrSVG draws a QR bitmap, quiet zone included, as a scalable SVG with one
+// path for all dark modules.
+func qrSVG(bitmap [][]bool) []byte {
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, len(bitmap), len(bitmap))
+	buf.WriteString(`<rect width="100%" height="100%" fill="#fff"/>`)
+	fmt.Fprintf(&buf, `<path fill="#000" d="%s"/></svg>`, path.String())
+	return buf.Bytes()
+}
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"p2nova-vpn/internal/domain"
+)
+
+func TestGetSessionConfigFormats(t *testing.T) {
+	api := newTestAPI(t)
+	sessionID, token := api.connect(t)
+	path := "/api/v1/vpn/sessions/" + sessionID + "/config"
+
+	get := func(query string) *http.Response {
+		t.Helper()
+		rec := api.do(t, "GET", path+query, token, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", query, rec.Code, rec.Body)
+		}
+		if rec.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: cacheable", query)
+		}
+		return rec.Result()
+	}
+	body := func(resp *http.Response) string {
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		return buf.String()
+	}
+
+	ini := body(get(""))
+	if !strings.HasPrefix(ini, "[Interface]") || !strings.Contains(ini, "PrivateKey = ") {
+		t.Errorf("ini config:\n%s", ini)
+	}
+
+	resp := get("?format=conf")
+	if got := resp.Header.Get("Content-Disposition"); got != `attachment; filename="p2nova-DE.conf"` {
+		t.Errorf("conf disposition = %q", got)
+	}
+	if got := body(resp); got != ini {
+		t.Errorf("conf differs from ini:\n%s", got)
+	}
+
+	var tunnel struct {
+		Data domain.TunnelConfig `json:"data"`
+	}
+	if err := json.NewDecoder(get("?format=json").Body).Decode(&tunnel); err != nil {
+		t.Fatal(err)
+	}
+	if tunnel.Data.PrivateKey == "" || !strings.HasPrefix(tunnel.Data.Address, "10.8.1.") || tunnel.Data.Endpoint != "192.0.2.1:51820" {
+		t.Errorf("json config = %+v", tunnel.Data)
+	}
+
+	resp = get("?format=png&size=256")
+	if resp.Header.Get("Content-Type") != "image/png" || !strings.HasPrefix(body(resp), "\x89PNG") {
+		t.Error("png is not a PNG image")
+	}
+	resp = get("?format=svg")
+	if resp.Header.Get("Content-Type") != "image/svg+xml" || !strings.HasPrefix(body(resp), "<svg ") {
+		t.Error("svg is not an SVG image")
+	}
+
+	for _, query := range []string{"?format=pdf", "?format=png&size=64", "?format=png&size=big"} {
+		rec := api.do(t, "GET", path+query, token, "")
+		if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != "invalid_request" {
+			t.Errorf("%s: %d %s", query, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestQRSVG(t *testing.T) {
+	bitmap := [][]bool{
+		{true, true, false},
+		{false, true, true},
+		{false, false, false},
+	}
+	want := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 3 3" shape-rendering="crispEdges">` +
+		`<rect width="100%" height="100%" fill="#fff"/>` +
+		`<path fill="#000" d="M0 0h2v1h-2zM1 1h2v1h-2z"/></svg>`
+	if got := string(qrSVG(bitmap)); got != want {
+		t.Errorf("qrSVG =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGetSessionConfigPlatform(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range map[string]string{
+		"platform-linux.tmpl": "# linux {{.Server.Code}}",
+		"platform-ios.tmpl":   "# ios {{.Server.Code}}",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("TEMPLATES_DIR", dir)
+	api := newTestAPI(t)
+
+	rec := api.do(t, "POST", "/api/v1/vpn/connect", "", `{"serverCode": "DE", "platform": "Linux"}`)
+	var resp struct {
+		Data struct {
+			SessionID string `json:"sessionId"`
+			Token     string `json:"token"`
+			Config    string `json:"config"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("connect: %d %s", rec.Code, rec.Body)
+	}
+	if resp.Data.Config != "# linux DE" {
+		t.Errorf("config on connect = %q", resp.Data.Config)
+	}
+
+	path := "/api/v1/vpn/sessions/" + resp.Data.SessionID + "/config"
+	for query, want := range map[string]string{
+		"":              "# linux DE\n",
+		"?platform=IOS": "# ios DE\n",
+	} {
+		rec := api.do(t, "GET", path+query, resp.Data.Token, "")
+		if rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Errorf("%q: %d %q, want %q", query, rec.Code, rec.Body, want)
+		}
+	}
+}
+
+func TestGetSessionConfigExports(t *testing.T) {
+	api := newTestAPI(t)
+	sessionID, token := api.connect(t)
+	path := "/api/v1/vpn/sessions/" + sessionID + "/config?format="
+
+	tests := []struct{ format, contentType, fileName string }{
+		{"uci", "text/plain; charset=utf-8", "p2nova-DE.uci"},
+		{"nmconnection", "text/plain; charset=utf-8", "p2nova-DE.nmconnection"},
+		{"routeros", "text/plain; charset=utf-8", "p2nova-DE.rsc"},
+		{"mobileconfig", "application/x-apple-aspen-config", "p2nova-DE.mobileconfig"},
+	}
+	for _, tt := range tests {
+		rec := api.do(t, "GET", path+tt.format, token, "")
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: %d %s", tt.format, rec.Code, rec.Body)
+			continue
+		}
+		h := rec.Header()
+		if h.Get("Content-Type") != tt.contentType || h.Get("Cache-Control") != "no-store" ||
+			h.Get("Content-Disposition") != `attachment; filename="`+tt.fileName+`"` {
+			t.Errorf("%s: headers %v", tt.format, h)
+		}
+	}
+
+	rec := api.do(t, "GET", path+"mobileconfig&trusted=Home,%20Office%20", token, "")
+	if body := rec.Body.String(); !strings.Contains(body, "<string>Home</string>") || !strings.Contains(body, "<string>Office</string>") {
+		t.Errorf("trusted networks missing from the profile:\n%s", body)
+	}
+	rec = api.do(t, "GET", path+"mobileconfig&ondemand=false", token, "")
+	if strings.Contains(rec.Body.String(), "OnDemandEnabled") {
+		t.Error("profile connects on demand with ondemand=false")
+	}
+	rec = api.do(t, "GET", path+"mobileconfig&ondemand=sometimes", token, "")
+	if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != "invalid_request" {
+		t.Errorf("bad ondemand: %d %s", rec.Code, rec.Body)
+	}
+}
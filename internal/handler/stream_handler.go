@@ -0,0 +1,334 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/internal/logging"
+	"p2nova-vpn/internal/middleware"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// statusPollInterval is how often a stream looks for status changes
+	statusPollInterval = time.Second
+	// streamHeartbeat keeps idle streams, and proxies in between, alive
+	streamHeartbeat = 15 * time.Second
+	// streamWriteWait is how long a client may take to accept a write
+	// before it is dropped
+	streamWriteWait = 10 * time.Second
+	// wsPongWait is how long a WebSocket client may go silent
+	wsPongWait = 2 * streamHeartbeat
+	// maxStreamsPerClient caps the status streams one client IP may hold
+	maxStreamsPerClient = 8
+)
+
+// errSessionEnded ends a stream once its session is over
+var errSessionEnded = errors.New("session ended")
+
+// StreamStatus pushes status updates for the session ?sessionId= as
+// server-sent events. While the session is connected, handshake and
+// transfer events follow its WireGuard peer. A WebSocket upgrade request on
+// the same path gets the same events as WebSocket text messages. Only the
+// session's owner or the admin may subscribe, authenticated like GetStatus.
+//
+// Updates are sent when anything but the duration changes. A slow client
+// never builds a queue: changes made while a write is pending are folded
+// into the next update, and a client that cannot take a write within
+// streamWriteWait is disconnected. A client IP may hold at most
+// maxStreamsPerClient streams.
+func (h *Handler) StreamStatus(w http.ResponseWriter, r *http.Request) {
+	if !h.startStream() {
+		ErrorResponse(w, domain.ErrShuttingDown)
+		return
+	}
+	defer h.streamsDone.Done()
+
+	sessionID := r.URL.Query().Get("sessionId")
+	if err := h.vpnService.AuthorizeSession(sessionID, bearerToken(r)); err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+	if _, err := h.vpnService.GetStatus(sessionID); err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	ip := remoteIP(r)
+	if client := middleware.ClientFromContext(r.Context()); client != nil {
+		ip = client.IP
+	}
+	if !h.acquireStream(ip) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(streamHeartbeat.Seconds())))
+		ErrorResponse(w, domain.WithDetails(domain.ErrTooManyStreams, map[string]interface{}{"limit": maxStreamsPerClient}))
+		return
+	}
+	defer h.releaseStream(ip)
+
+	if websocket.IsWebSocketUpgrade(r) {
+		h.streamStatusWebSocket(w, r, sessionID)
+		return
+	}
+	h.streamStatusSSE(w, r, sessionID)
+}
+
+// startStream counts a stream in for CloseStreams to wait for, unless
+// streams are being closed. Both hold streamsMu, so no stream starts after
+// CloseStreams began waiting.
+func (h *Handler) startStream() bool {
+	h.streamsMu.Lock()
+	defer h.streamsMu.Unlock()
+	if h.streams.Err() != nil {
+		return false
+	}
+	h.streamsDone.Add(1)
+	return true
+}
+
+func (h *Handler) acquireStream(ip string) bool {
+	h.streamsMu.Lock()
+	defer h.streamsMu.Unlock()
+	if h.clientStreams[ip] >= maxStreamsPerClient {
+		return false
+	}
+	h.clientStreams[ip]++
+	return true
+}
+
+func (h *Handler) releaseStream(ip string) {
+	h.streamsMu.Lock()
+	defer h.streamsMu.Unlock()
+	if h.clientStreams[ip]--; h.clientStreams[ip] <= 0 {
+		delete(h.clientStreams, ip)
+	}
+}
+
+// CloseStreams ends every status stream and waits until each has said
+// goodbye, for a clean server shutdown.
+func (h *Handler) CloseStreams() {
+	h.streamsMu.Lock()
+	h.closeStreams()
+	h.streamsMu.Unlock()
+	h.streamsDone.Wait()
+}
+
+func (h *Handler) streamStatusSSE(w http.ResponseWriter, r *http.Request, sessionID string) {
+	// The server's WriteTimeout would cut the stream; every write gets its
+	// own deadline instead
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Now().Add(streamWriteWait)); err != nil {
+		ErrorResponse(w, fmt.Errorf("streaming not supported: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(format string, args ...interface{}) error {
+		if err := rc.SetWriteDeadline(time.Now().Add(streamWriteWait)); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	if err := write("retry: %d\n\n", statusPollInterval.Milliseconds()*3); err != nil {
+		return
+	}
+
+	err := h.watchStatus(r.Context(), sessionID,
+		func(event string, data []byte) error { return write("event: %s\ndata: %s\n\n", event, data) },
+		func() error { return write(": ping\n\n") },
+	)
+
+	switch {
+	case errors.Is(err, domain.ErrShuttingDown):
+		write("event: shutdown\ndata: {}\n\n")
+	case errors.Is(err, errSessionEnded), r.Context().Err() != nil:
+	default:
+		logging.Debugf("Status stream for %s ended: %v", r.RemoteAddr, err)
+	}
+}
+
+func (h *Handler) streamStatusWebSocket(w http.ResponseWriter, r *http.Request, sessionID string) {
+	upgrader := websocket.Upgrader{
+		// Browsers may connect from the origins the CORS middleware
+		// allowed for this request; apps send no Origin
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			allowed := w.Header().Get("Access-Control-Allow-Origin")
+			return origin == "" || allowed == "*" || allowed == origin
+		},
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already answered the client
+		return
+	}
+	defer conn.Close()
+
+	// Clients only answer pings and close; reading also notices when the
+	// client goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	err = h.watchStatus(ctx, sessionID,
+		func(event string, data []byte) error {
+			conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			return conn.WriteJSON(wsEvent{Event: event, Data: data})
+		},
+		func() error {
+			return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteWait))
+		},
+	)
+
+	closeCode, reason := websocket.CloseInternalServerErr, "status unavailable"
+	switch {
+	case errors.Is(err, domain.ErrShuttingDown):
+		closeCode, reason = websocket.CloseGoingAway, domain.ErrShuttingDown.Error()
+	case errors.Is(err, errSessionEnded):
+		closeCode, reason = websocket.CloseNormalClosure, errSessionEnded.Error()
+	case ctx.Err() != nil:
+		// The client is gone
+		return
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, reason), time.Now().Add(streamWriteWait))
+}
+
+// wsEvent is a stream event sent as a WebSocket message
+type wsEvent struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// watchStatus sends the session's status, then again whenever it changes,
+// and calls heartbeat when nothing was sent for a while. Each poll of a
+// connected session also sends the peer's handshake and transfer events.
+// It returns when ctx ends, on shutdown, once the session has ended, or when
+// a write fails.
+func (h *Handler) watchStatus(ctx context.Context, sessionID string, send func(event string, data []byte) error, heartbeat func() error) error {
+	poll := time.NewTicker(statusPollInterval)
+	defer poll.Stop()
+	beat := time.NewTicker(streamHeartbeat)
+	defer beat.Stop()
+
+	emit := func(event string, v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if err := send(event, data); err != nil {
+			return err
+		}
+		beat.Reset(streamHeartbeat)
+		return nil
+	}
+
+	var last []byte
+	var traffic *domain.PeerTraffic // the last peer reading
+	for {
+		status, err := h.vpnService.GetStatus(sessionID)
+		if err != nil {
+			return err
+		}
+
+		// The duration ticks on its own; only other changes are news
+		duration := status.Duration
+		status.Duration = 0
+		current, err := json.Marshal(status)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(current, last) {
+			status.Duration = duration
+			if err := emit("status", status); err != nil {
+				return err
+			}
+			last = current
+		}
+
+		if !status.Connected {
+			return errSessionEnded
+		}
+		if traffic, err = h.sendTraffic(sessionID, traffic, emit); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-h.streams.Done():
+			return domain.ErrShuttingDown
+		case <-beat.C:
+			if err := heartbeat(); err != nil {
+				return err
+			}
+		case <-poll.C:
+		}
+	}
+}
+
+// sendTraffic reads the session's peer and emits a handshake event when it
+// shook hands since prev, and a transfer event when its counters moved. It
+// returns the reading for the next call. A failed read is skipped, as the
+// status reports a server that is down.
+func (h *Handler) sendTraffic(sessionID string, prev *domain.PeerTraffic, emit func(string, interface{}) error) (*domain.PeerTraffic, error) {
+	traffic, err := h.vpnService.Traffic(sessionID)
+	if err != nil {
+		logging.Debugf("Traffic of session %s unavailable: %v", sessionID, err)
+		return prev, nil
+	}
+
+	if traffic.LatestHandshake != 0 && (prev == nil || traffic.LatestHandshake != prev.LatestHandshake) {
+		if err := emit("handshake", domain.HandshakeEvent{LatestHandshake: traffic.LatestHandshake}); err != nil {
+			return nil, err
+		}
+	}
+	if prev == nil || traffic.RxBytes != prev.RxBytes || traffic.TxBytes != prev.TxBytes {
+		event := domain.TransferEvent{RxBytes: traffic.RxBytes, TxBytes: traffic.TxBytes}
+		if prev != nil {
+			event.RxDelta = counterDelta(prev.RxBytes, traffic.RxBytes)
+			event.TxDelta = counterDelta(prev.TxBytes, traffic.TxBytes)
+		}
+		if err := emit("transfer", event); err != nil {
+			return nil, err
+		}
+	}
+	return traffic, nil
+}
+
+// counterDelta is how far a transfer counter moved. One that went back was
+// reset, as when the peer was re-added, and counts from zero.
+func counterDelta(prev, current int64) int64 {
+	if current < prev {
+		return current
+	}
+	return current - prev
+}
@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"p2nova-vpn/internal/domain"
+
+	"github.com/gorilla/websocket"
+)
+
+// serve starts a server for the API. Streams are closed before it is, so
+// closing it does not wait on them.
+func (api *testAPI) serve(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(api.router)
+	t.Cleanup(func() {
+		api.handler.CloseStreams()
+		srv.Close()
+	})
+	return srv
+}
+
+// peerKey returns the public key of the only peer on DE.
+func (api *testAPI) peerKey(t *testing.T) string {
+	t.Helper()
+	peers, err := api.backend.ListPeers()
+	if err != nil || len(peers) != 1 {
+		t.Fatalf("DE peers: %v, %v", peers, err)
+	}
+	return peers[0].PublicKey
+}
+
+// sseStream reads server-sent events.
+type sseStream struct {
+	t    *testing.T
+	body *bufio.Reader
+}
+
+func openSSE(t *testing.T, url, token string) *sseStream {
+	t.Helper()
+	resp, err := getStream(url, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		resp.Body.Close()
+		t.Fatalf("stream: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return &sseStream{t: t, body: bufio.NewReader(resp.Body)}
+}
+
+// getStream requests a status stream with a bearer token.
+func getStream(url, token string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	client := &http.Client{Timeout: 10 * time.Second}
+	return client.Do(req)
+}
+
+// next returns the next event, skipping comments and the retry field. An
+// ended stream returns an empty name.
+func (s *sseStream) next() (string, []byte) {
+	s.t.Helper()
+	var event string
+	var data []byte
+	for {
+		line, err := s.body.ReadString('\n')
+		if err != nil {
+			return "", nil
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event != "":
+			return event, data
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = []byte(strings.TrimPrefix(line, "data: "))
+		}
+	}
+}
+
+// expect decodes the data of the next event, which must be called name,
+// into v.
+func (s *sseStream) expect(name string, v interface{}) {
+	s.t.Helper()
+	event, data := s.next()
+	if event != name {
+		s.t.Fatalf("got event %q %s, want %q", event, data, name)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		s.t.Fatalf("%s: %v", name, err)
+	}
+}
+
+func TestStreamStatusSSE(t *testing.T) {
+	api := newTestAPI(t)
+	srv := api.serve(t)
+	sessionID, token := api.connect(t)
+	handshake := time.Now().Add(-time.Minute).Truncate(time.Second)
+	api.backend.SetTraffic(api.peerKey(t), handshake, 100, 200)
+
+	stream := openSSE(t, srv.URL+"/api/v1/vpn/status/stream?sessionId="+sessionID, token)
+
+	var status domain.VPNStatus
+	stream.expect("status", &status)
+	if !status.Connected || status.SessionID != sessionID || status.Server != "DE" {
+		t.Errorf("status = %+v", status)
+	}
+	var shook domain.HandshakeEvent
+	stream.expect("handshake", &shook)
+	if shook.LatestHandshake != handshake.Unix() {
+		t.Errorf("handshake at %d, want %d", shook.LatestHandshake, handshake.Unix())
+	}
+	var transfer domain.TransferEvent
+	stream.expect("transfer", &transfer)
+	if transfer != (domain.TransferEvent{RxBytes: 100, TxBytes: 200}) {
+		t.Errorf("first transfer = %+v, want the counters without deltas", transfer)
+	}
+
+	api.backend.SetTraffic(api.peerKey(t), handshake, 150, 260)
+	stream.expect("transfer", &transfer)
+	if transfer != (domain.TransferEvent{RxBytes: 150, TxBytes: 260, RxDelta: 50, TxDelta: 60}) {
+		t.Errorf("transfer = %+v, want deltas of 50 and 60", transfer)
+	}
+
+	// A re-added peer starts counting from zero again
+	later := handshake.Add(30 * time.Second)
+	api.backend.SetTraffic(api.peerKey(t), later, 10, 20)
+	stream.expect("handshake", &shook)
+	if shook.LatestHandshake != later.Unix() {
+		t.Errorf("second handshake at %d, want %d", shook.LatestHandshake, later.Unix())
+	}
+	stream.expect("transfer", &transfer)
+	if transfer != (domain.TransferEvent{RxBytes: 10, TxBytes: 20, RxDelta: 10, TxDelta: 20}) {
+		t.Errorf("transfer after a reset = %+v", transfer)
+	}
+
+	if rec := api.do(t, "POST", "/api/v1/vpn/disconnect", token, `{"sessionId": "`+sessionID+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("disconnect: %d %s", rec.Code, rec.Body)
+	}
+	stream.expect("status", &status)
+	if status.Connected {
+		t.Errorf("status after disconnect = %+v", status)
+	}
+	if event, data := stream.next(); event != "" {
+		t.Errorf("stream went on after the session ended: %s %s", event, data)
+	}
+}
+
+func TestStreamStatusWebSocket(t *testing.T) {
+	api := newTestAPI(t)
+	srv := api.serve(t)
+	sessionID, token := api.connect(t)
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v1/vpn/status/stream?sessionId=" + sessionID
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer " + token}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	for _, want := range []string{"status", "transfer"} {
+		var event wsEvent
+		if err := conn.ReadJSON(&event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Event != want {
+			t.Fatalf("got %s %s, want %s", event.Event, event.Data, want)
+		}
+	}
+
+	api.do(t, "POST", "/api/v1/vpn/disconnect", token, `{"sessionId": "`+sessionID+`"}`)
+	var event wsEvent
+	if err := conn.ReadJSON(&event); err != nil || event.Event != "status" {
+		t.Fatalf("got %+v, %v; want the disconnected status", event, err)
+	}
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("got %v, want a normal close", err)
+	}
+}
+
+func TestCloseStreams(t *testing.T) {
+	api := newTestAPI(t)
+	srv := api.serve(t)
+	sessionID, token := api.connect(t)
+
+	stream := openSSE(t, srv.URL+"/api/v1/vpn/status/stream?sessionId="+sessionID, token)
+	var status domain.VPNStatus
+	stream.expect("status", &status)
+
+	done := make(chan struct{})
+	go func() {
+		api.handler.CloseStreams()
+		close(done)
+	}()
+	for {
+		event, _ := stream.next()
+		if event == "shutdown" {
+			break
+		}
+		if event == "" {
+			t.Fatal("stream ended without a shutdown event")
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("CloseStreams did not return")
+	}
+
+	rec := api.do(t, "GET", "/api/v1/vpn/status/stream?sessionId="+sessionID, token, "")
+	if rec.Code != http.StatusServiceUnavailable || errorCode(t, rec) != "shutting_down" {
+		t.Errorf("stream after shutdown: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestStreamLimitPerClient(t *testing.T) {
+	api := newTestAPI(t)
+	srv := api.serve(t)
+	sessionID, token := api.connect(t)
+	url := srv.URL + "/api/v1/vpn/status/stream?sessionId=" + sessionID
+
+	for i := 0; i < maxStreamsPerClient; i++ {
+		stream := openSSE(t, url, token)
+		var status domain.VPNStatus
+		stream.expect("status", &status)
+	}
+	resp, err := getStream(url, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("stream over the limit: %d", resp.StatusCode)
+	}
+}
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct{ prev, current, want int64 }{
+		{0, 0, 0},
+		{100, 150, 50},
+		{150, 150, 0},
+		{150, 40, 40},
+	}
+	for _, tt := range tests {
+		if got := counterDelta(tt.prev, tt.current); got != tt.want {
+			t.Errorf("counterDelta(%d, %d) = %d, want %d", tt.prev, tt.current, got, tt.want)
+		}
+	}
+}
@@ -1,51 +1,90 @@
 package handler
 
 import (
+	"net"
 	"net/http"
+	"strings"
 
 	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/internal/middleware"
 )
 
 func (h *Handler) Connect(w http.ResponseWriter, r *http.Request) {
 	var req domain.ConnectRequest
 	if err := DecodeJSON(r, &req); err != nil {
-		ErrorResponse(w, http.StatusBadRequest, "Invalid request")
+		ErrorResponse(w, err)
 		return
 	}
 
-	session, err := h.vpnService.Connect(req.ServerCode)
+	client := middleware.ClientFromContext(r.Context())
+	if client == nil {
+		client = &domain.Client{IP: remoteIP(r)}
+	}
+
+	tunnel := domain.TunnelRequest{
+		Plan:      req.Plan,
+		Platform:  strings.ToLower(req.Platform),
+		Overrides: req.Tunnel,
+	}
+	session, token, err := h.vpnService.Connect(req.ServerCode, tunnel, client)
+	if err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	_, secrets, err := h.vpnService.SessionConfig(session.SessionID, "")
 	if err != nil {
-		ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		ErrorResponse(w, err)
 		return
 	}
 
 	SuccessResponse(w, http.StatusOK, map[string]interface{}{
 		"sessionId": session.SessionID,
+		"token":     token,
+		"server":    session.ServerCode,
+		"selection": session.Selection,
+		"plan":      session.Plan,
+		"tunnel":    session.Params,
 		"ip":        session.ClientIP,
 		"startTime": session.StartTime,
-		"config":    session.PeerConfig,
+		"config":    secrets.PeerConfig,
 	})
 }
 
+// Disconnect ends a session. The caller authenticates with the session's
+// owner token from connect, or the admin token, as a bearer token.
 func (h *Handler) Disconnect(w http.ResponseWriter, r *http.Request) {
 	var req domain.DisconnectRequest
 	if err := DecodeJSON(r, &req); err != nil {
-		ErrorResponse(w, http.StatusBadRequest, "Invalid request")
+		ErrorResponse(w, err)
+		return
+	}
+	if err := h.vpnService.AuthorizeSession(req.SessionID, bearerToken(r)); err != nil {
+		ErrorResponse(w, err)
 		return
 	}
 
 	if err := h.vpnService.Disconnect(req.SessionID); err != nil {
-		ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		ErrorResponse(w, err)
 		return
 	}
 
 	SuccessResponse(w, http.StatusOK, map[string]string{"status": "disconnected"})
 }
 
+// GetStatus reports on the session ?sessionId=, to its owner or the admin,
+// authenticated like Disconnect. A migrated session's status carries its
+// new client config.
 func (h *Handler) GetStatus(w http.ResponseWriter, r *http.Request) {
-	status, err := h.vpnService.GetStatus()
+	sessionID := r.URL.Query().Get("sessionId")
+	if err := h.vpnService.AuthorizeSession(sessionID, bearerToken(r)); err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+
+	status, err := h.vpnService.GetStatus(sessionID)
 	if err != nil {
-		ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		ErrorResponse(w, err)
 		return
 	}
 
@@ -63,3 +102,11 @@ func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
 		"app":    "p2Nova VPN",
 	})
 }
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"p2nova-vpn/internal/domain"
+)
+
+func TestConnectByStrategy(t *testing.T) {
+	api := newTestAPI(t)
+
+	for _, strategy := range []string{domain.StrategyAuto, domain.StrategyFastest, domain.StrategyLeastLoaded, domain.StrategyNearest} {
+		rec := api.do(t, "POST", "/api/v1/vpn/connect", "", `{"serverCode": "`+strategy+`"}`)
+		var resp struct {
+			Data struct {
+				Server    string            `json:"server"`
+				Selection *domain.Selection `json:"selection"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", strategy, rec.Code, rec.Body)
+		}
+		if resp.Data.Server != "DE" || resp.Data.Selection == nil || resp.Data.Selection.Strategy != strategy || resp.Data.Selection.Reason == "" {
+			t.Errorf("%s: server %s, selection %+v", strategy, resp.Data.Server, resp.Data.Selection)
+		}
+	}
+
+	rec := api.do(t, "POST", "/api/v1/vpn/connect", "", `{"serverCode": "random"}`)
+	if rec.Code != http.StatusNotFound || errorCode(t, rec) != "server_not_found" {
+		t.Errorf("unknown strategy: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestConnectLocatesClientBehindProxy(t *testing.T) {
+	geoFile := filepath.Join(t.TempDir(), "geo.json")
+	if err := os.WriteFile(geoFile, []byte(`{"198.51.100.0/24": {"country": "KE", "loc": "-1.29,36.82"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GEO_STATIC_FILE", geoFile)
+	// httptest requests come from 192.0.2.1
+	t.Setenv("TRUSTED_PROXIES", "192.0.2.0/24")
+	api := newTestAPI(t)
+
+	reason := func(forwardedFor string) string {
+		req := httptest.NewRequest("POST", "/api/v1/vpn/connect", strings.NewReader(`{"serverCode": "nearest"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		api.router.ServeHTTP(rec, req)
+		var resp struct {
+			Data struct {
+				Selection domain.Selection `json:"selection"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("connect: %d %s", rec.Code, rec.Body)
+		}
+		return resp.Data.Selection.Reason
+	}
+
+	if got := reason("198.51.100.7"); !strings.Contains(got, "client in KE") {
+		t.Errorf("forwarded client: %s", got)
+	}
+	// The proxy itself cannot be located
+	if got := reason(""); got != "client location unknown, picked least-loaded server" {
+		t.Errorf("direct client: %s", got)
+	}
+}
+
+func TestConnectWithPlan(t *testing.T) {
+	api := newTestAPIWithConfig(t, `
+plans:
+  - name: standard
+    tunnel:
+      mtu: 1420
+  - name: pro
+    overrides: [mtu]
+defaultPlan: standard
+`)
+
+	connect := func(body string) *httptest.ResponseRecorder {
+		return api.do(t, "POST", "/api/v1/vpn/connect", "", body)
+	}
+	tunnel := func(rec *httptest.ResponseRecorder) (string, domain.TunnelParams) {
+		t.Helper()
+		var resp struct {
+			Data struct {
+				Plan   string              `json:"plan"`
+				Tunnel domain.TunnelParams `json:"tunnel"`
+				Config string              `json:"config"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("connect: %d %s", rec.Code, rec.Body)
+		}
+		if mtu := resp.Data.Tunnel.MTU; mtu != 0 && !strings.Contains(resp.Data.Config, "MTU = "+strconv.Itoa(mtu)) {
+			t.Errorf("config does not carry MTU %d:\n%s", mtu, resp.Data.Config)
+		}
+		return resp.Data.Plan, resp.Data.Tunnel
+	}
+
+	if plan, params := tunnel(connect(`{"serverCode": "DE"}`)); plan != "standard" || params.MTU != 1420 {
+		t.Errorf("default plan: %s %+v", plan, params)
+	}
+	if plan, params := tunnel(connect(`{"serverCode": "DE", "plan": "pro", "tunnel": {"mtu": 1380}}`)); plan != "pro" || params.MTU != 1380 {
+		t.Errorf("pro with an override: %s %+v", plan, params)
+	}
+
+	tests := []struct{ body, code string }{
+		{`{"serverCode": "DE", "plan": "gold"}`, "plan_not_found"},
+		{`{"serverCode": "DE", "tunnel": {"mtu": 1380}}`, "override_forbidden"},
+		{`{"serverCode": "DE", "plan": "pro", "tunnel": {"mtu": 9000}}`, "invalid_request"},
+	}
+	for _, tt := range tests {
+		rec := connect(tt.body)
+		if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != tt.code {
+			t.Errorf("%s: %d %s, want %s", tt.body, rec.Code, rec.Body, tt.code)
+		}
+	}
+}
+
+func TestGetStatusNeedsSession(t *testing.T) {
+	api := newTestAPI(t)
+	first, firstToken := api.connect(t)
+	second, secondToken := api.connect(t)
+
+	for _, path := range []string{"/api/v1/vpn/status", "/api/v1/vpn/status/stream"} {
+		rec := api.do(t, "GET", path, testAdminToken, "")
+		if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != "invalid_request" {
+			t.Errorf("%s without a session: %d %s", path, rec.Code, rec.Body)
+		}
+	}
+
+	tokens := map[string]string{first: firstToken, second: secondToken}
+	for sessionID, token := range tokens {
+		rec := api.do(t, "GET", "/api/v1/vpn/status?sessionId="+sessionID, token, "")
+		var resp struct {
+			Data domain.VPNStatus `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("status: %d %s", rec.Code, rec.Body)
+		}
+		if resp.Data.SessionID != sessionID || !resp.Data.Connected {
+			t.Errorf("status of %s = %+v", sessionID, resp.Data)
+		}
+	}
+}
+
+func TestSessionEndpointsNeedOwner(t *testing.T) {
+	api := newTestAPI(t)
+	sessionID, token := api.connect(t)
+	_, other := api.connect(t)
+
+	for _, tt := range []struct{ method, path, body string }{
+		{"GET", "/api/v1/vpn/status?sessionId=" + sessionID, ""},
+		{"GET", "/api/v1/vpn/status/stream?sessionId=" + sessionID, ""},
+		{"POST", "/api/v1/vpn/disconnect", `{"sessionId": "` + sessionID + `"}`},
+	} {
+		for _, wrong := range []string{"", other} {
+			rec := api.do(t, tt.method, tt.path, wrong, tt.body)
+			if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("%s %s with token %q: %d %s", tt.method, tt.path, wrong, rec.Code, rec.Body)
+			}
+		}
+	}
+
+	if rec := api.do(t, "GET", "/api/v1/vpn/status?sessionId="+sessionID, testAdminToken, ""); rec.Code != http.StatusOK {
+		t.Errorf("status for the admin: %d %s", rec.Code, rec.Body)
+	}
+	if rec := api.do(t, "POST", "/api/v1/vpn/disconnect", token, `{"sessionId": "`+sessionID+`"}`); rec.Code != http.StatusOK {
+		t.Errorf("disconnect by the owner: %d %s", rec.Code, rec.Body)
+	}
+}
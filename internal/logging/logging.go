@@ -0,0 +1,66 @@
+// Package logging gates log output by a level that can change at runtime.
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+type Level int32
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+var current atomic.Int32
+
+func init() {
+	current.Store(int32(Info))
+}
+
+func (l Level) String() string {
+	if l < Debug || l > Error {
+		return fmt.Sprintf("level(%d)", l)
+	}
+	return levelNames[l]
+}
+
+// ParseLevel accepts debug, info, warn or error.
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(name, n) {
+			return Level(i), nil
+		}
+	}
+	return Info, fmt.Errorf("unknown log level %q", name)
+}
+
+func SetLevel(l Level) {
+	current.Store(int32(l))
+}
+
+func CurrentLevel() Level {
+	return Level(current.Load())
+}
+
+func Enabled(l Level) bool {
+	return l >= CurrentLevel()
+}
+
+func Debugf(format string, args ...interface{}) { logf(Debug, format, args...) }
+func Infof(format string, args ...interface{})  { logf(Info, format, args...) }
+func Warnf(format string, args ...interface{})  { logf(Warn, format, args...) }
+func Errorf(format string, args ...interface{}) { logf(Error, format, args...) }
+
+func logf(l Level, format string, args ...interface{}) {
+	if Enabled(l) {
+		log.Printf(format, args...)
+	}
+}
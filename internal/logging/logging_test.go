@@ -0,0 +1,40 @@
+package logging
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestLevels(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	defer SetLevel(CurrentLevel())
+	var out bytes.Buffer
+	log.SetOutput(&out)
+
+	SetLevel(Warn)
+	Debugf("debug %d", 1)
+	Infof("info %d", 2)
+	Warnf("warn %d", 3)
+	Errorf("error %d", 4)
+
+	got := out.String()
+	if strings.Contains(got, "debug 1") || strings.Contains(got, "info 2") {
+		t.Errorf("messages below warn were logged:\n%s", got)
+	}
+	if !strings.Contains(got, "warn 3") || !strings.Contains(got, "error 4") {
+		t.Errorf("messages at or above warn are missing:\n%s", got)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]Level{"debug": Debug, "INFO": Info, "Warn": Warn, "error": Error} {
+		if got, err := ParseLevel(name); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v", name, got, err)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("unknown level accepted")
+	}
+}
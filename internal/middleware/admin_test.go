@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// decodeError returns the code of a JSON error response.
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp errorResponse
+	if rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Content-Type = %q", rec.Header().Get("Content-Type"))
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Success {
+		t.Fatalf("not a JSON error: %s", rec.Body)
+	}
+	return resp.Error.Code
+}
+
+func TestAdminAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name          string
+		token, header string
+		status        int
+		code          string
+	}{
+		{"disabled", "", "Bearer ", http.StatusForbidden, "forbidden"},
+		{"missing", "secret", "", http.StatusUnauthorized, "unauthorized"},
+		{"wrong", "secret", "Bearer nope", http.StatusUnauthorized, "unauthorized"},
+		{"not bearer", "secret", "secret", http.StatusUnauthorized, "unauthorized"},
+		{"right", "secret", "Bearer secret", http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/servers", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		AdminAuth(tt.token)(ok).ServeHTTP(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.status)
+			continue
+		}
+		if tt.code == "" {
+			continue
+		}
+		if code := decodeError(t, rec); code != tt.code {
+			t.Errorf("%s: code %s, want %s", tt.name, code, tt.code)
+		}
+		if challenge := rec.Header().Get("WWW-Authenticate"); (tt.status == http.StatusUnauthorized) != (challenge == "Bearer") {
+			t.Errorf("%s: WWW-Authenticate = %q", tt.name, challenge)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/internal/geo"
+)
+
+type clientKey struct{}
+
+// ClientInfo resolves the caller's real IP and location and stores them in
+// the request context. header names the forwarding header the proxies set,
+// X-Forwarded-For or Forwarded; it is only honoured when the connection
+// comes from a trusted proxy. Addresses that are not public are not looked
+// up.
+func ClientInfo(trusted []*net.IPNet, header string, locator geo.Provider) func(http.Handler) http.Handler {
+	header = http.CanonicalHeaderKey(header)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := &domain.Client{IP: clientIP(r, trusted, header)}
+
+			if geo.Public(net.ParseIP(client.IP)) {
+				if info, err := locator.Lookup(r.Context(), client.IP); err == nil {
+					client.Country = info.Country
+					client.Region = info.Region
+					client.Latitude, client.Longitude, _ = info.Coordinates()
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), clientKey{}, client)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClientFromContext returns the client stored by ClientInfo, or nil.
+func ClientFromContext(ctx context.Context) *domain.Client {
+	client, _ := ctx.Value(clientKey{}).(*domain.Client)
+	return client
+}
+
+// clientIP walks the forwarding chain from the nearest hop outwards and
+// returns the first address that is not a trusted proxy. Only the hops our
+// proxies appended can be believed: a malformed entry ends the walk at the
+// last proxy seen, since everything before it came from the client.
+func clientIP(r *http.Request, trusted []*net.IPNet, header string) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+
+	client := remote
+	if !isTrusted(client, trusted) {
+		return client
+	}
+
+	hops := forwardedFor(r, header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i]) == nil {
+			break
+		}
+		client = hops[i]
+		if !isTrusted(client, trusted) {
+			break
+		}
+	}
+	return client
+}
+
+// forwardedFor returns the client chain from the given header, in order
+// from the original client to the last proxy. Forwarded is parsed as in
+// RFC 7239, any other header as a comma separated list of addresses.
+func forwardedFor(r *http.Request, header string) []string {
+	var hops []string
+
+	if header == "Forwarded" {
+		for _, value := range r.Header.Values(header) {
+			for _, element := range strings.Split(value, ",") {
+				for _, pair := range strings.Split(element, ";") {
+					key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+					if ok && strings.EqualFold(key, "for") {
+						hops = append(hops, forwardedNode(val))
+					}
+				}
+			}
+		}
+		return hops
+	}
+
+	for _, value := range r.Header.Values(header) {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return hops
+}
+
+// forwardedNode strips quoting, brackets and the port from a Forwarded
+// node such as "[2001:db8::1]:4711" or 192.0.2.60:8080.
+func forwardedNode(node string) string {
+	node = strings.Trim(node, `"`)
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return host
+	}
+	return strings.Trim(node, "[]")
+}
+
+func isTrusted(ip string, trusted []*net.IPNet) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
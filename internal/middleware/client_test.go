@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/internal/geo"
+)
+
+func mustCIDRs(t *testing.T, cidrs ...string) []*net.IPNet {
+	t.Helper()
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nets = append(nets, network)
+	}
+	return nets
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := mustCIDRs(t, "10.0.0.0/8", "2001:db8:ffff::/48")
+
+	tests := []struct {
+		name    string
+		remote  string
+		header  string
+		headers map[string]string
+		want    string
+	}{
+		{"direct", "198.51.100.7:5000", "X-Forwarded-For", nil, "198.51.100.7"},
+		{"untrusted peer", "198.51.100.7:5000", "X-Forwarded-For",
+			map[string]string{"X-Forwarded-For": "203.0.113.9"}, "198.51.100.7"},
+		{"one proxy", "10.0.0.1:5000", "X-Forwarded-For",
+			map[string]string{"X-Forwarded-For": "203.0.113.9"}, "203.0.113.9"},
+		{"spoofed prefix", "10.0.0.1:5000", "X-Forwarded-For",
+			map[string]string{"X-Forwarded-For": "1.2.3.4, 203.0.113.9, 10.0.0.2"}, "203.0.113.9"},
+		{"malformed hop", "10.0.0.1:5000", "X-Forwarded-For",
+			map[string]string{"X-Forwarded-For": "1.2.3.4, garbage, 10.0.0.2"}, "10.0.0.2"},
+		{"malformed last hop", "10.0.0.1:5000", "X-Forwarded-For",
+			map[string]string{"X-Forwarded-For": "1.2.3.4, garbage"}, "10.0.0.1"},
+		{"no header", "10.0.0.1:5000", "X-Forwarded-For", nil, "10.0.0.1"},
+		{"only proxies", "10.0.0.1:5000", "X-Forwarded-For",
+			map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"Forwarded ignored", "10.0.0.1:5000", "X-Forwarded-For",
+			map[string]string{"Forwarded": "for=1.2.3.4", "X-Forwarded-For": "203.0.113.9"}, "203.0.113.9"},
+		{"X-Forwarded-For ignored", "10.0.0.1:5000", "Forwarded",
+			map[string]string{"Forwarded": "for=203.0.113.9", "X-Forwarded-For": "1.2.3.4"}, "203.0.113.9"},
+		{"Forwarded chain", "10.0.0.1:5000", "Forwarded",
+			map[string]string{"Forwarded": `for=1.2.3.4, for="[2001:db8::1]:4711";proto=https, for=10.0.0.2:80`}, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		for key, value := range tt.headers {
+			r.Header.Set(key, value)
+		}
+		if got := clientIP(r, trusted, tt.header); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// countingLocator answers every lookup with KE and counts them.
+type countingLocator struct{ calls int }
+
+func (l *countingLocator) Name() string { return "counting" }
+
+func (l *countingLocator) Lookup(ctx context.Context, ip string) (*geo.GeoInfo, error) {
+	l.calls++
+	return &geo.GeoInfo{IP: ip, Country: "KE", Loc: "-1.29,36.82"}, nil
+}
+
+func TestClientInfoLocatesPublicAddresses(t *testing.T) {
+	locator := &countingLocator{}
+	var client *domain.Client
+	handler := ClientInfo(nil, "X-Forwarded-For", locator)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client = ClientFromContext(r.Context())
+	}))
+
+	for _, remote := range []string{"127.0.0.1:5000", "10.1.2.3:5000", "[::1]:5000", "100.64.1.1:5000"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remote
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if client == nil || client.Located() {
+			t.Errorf("%s: client = %+v, want it unlocated", remote, client)
+		}
+	}
+	if locator.calls != 0 {
+		t.Errorf("%d lookups for non-public addresses", locator.calls)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "198.51.100.7:5000"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if locator.calls != 1 || client.Country != "KE" || client.Latitude != -1.29 {
+		t.Errorf("public client = %+v after %d lookups", client, locator.calls)
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	origins := []string{"https://app.example"}
+	reached := false
+	h := CORS(func() []string { return origins })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+
+	allowed := func(method, origin string) string {
+		t.Helper()
+		req := httptest.NewRequest(method, "/api/v1/servers", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s from %q: status %d", method, origin, rec.Code)
+		}
+		return rec.Header().Get("Access-Control-Allow-Origin")
+	}
+
+	if got := allowed("GET", "https://app.example"); got != "https://app.example" || !reached {
+		t.Errorf("listed origin: allowed %q, reached %v", got, reached)
+	}
+	if got := allowed("GET", "https://evil.example"); got != "" {
+		t.Errorf("unlisted origin allowed as %q", got)
+	}
+	if got := allowed("GET", ""); got != "" {
+		t.Errorf("request without an origin allowed as %q", got)
+	}
+
+	reached = false
+	if got := allowed("OPTIONS", "https://app.example"); got != "https://app.example" || reached {
+		t.Errorf("preflight: allowed %q, reached %v", got, reached)
+	}
+
+	// A reload takes effect on the next request
+	origins = []string{"*"}
+	if got := allowed("GET", "https://evil.example"); got != "*" {
+		t.Errorf("wildcard: allowed %q", got)
+	}
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Deprecated marks responses under prefix as deprecated since the given
+// time (RFC 9745) and links each to the same path under successor.
+func Deprecated(prefix, successor string, since time.Time) func(http.Handler) http.Handler {
+	deprecation := fmt.Sprintf("@%d", since.Unix())
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := successor + strings.TrimPrefix(r.URL.Path, prefix)
+			w.Header().Set("Deprecation", deprecation)
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, path))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
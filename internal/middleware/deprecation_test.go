@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeprecated(t *testing.T) {
+	since := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	h := Deprecated("/api", "/api/v1", since)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/vpn/status?sessionId=S1", nil))
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("status %d, want the handler's", rec.Code)
+	}
+	if got := rec.Header().Get("Deprecation"); got != "@1780272000" {
+		t.Errorf("Deprecation = %q", got)
+	}
+	if got := rec.Header().Get("Link"); got != `</api/v1/vpn/status>; rel="successor-version"` {
+		t.Errorf("Link = %q", got)
+	}
+}
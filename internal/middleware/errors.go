@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"p2nova-vpn/internal/domain"
+)
+
+// errorResponse is the JSON error body the handlers send. The handler
+// package imports this one, so the body is spelled out here.
+type errorResponse struct {
+	Success bool      `json:"success"`
+	Error   errorBody `json:"error"`
+}
+
+type errorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeError answers with err's code and message, as the handlers would.
+func writeError(w http.ResponseWriter, status int, err *domain.Error) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{
+		Error: errorBody{Code: err.Code, Message: err.Message},
+	})
+}
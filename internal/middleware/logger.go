@@ -1,9 +1,11 @@
 package middleware
 
 import (
-	"log"
 	"net/http"
+	"strings"
 	"time"
+
+	"p2nova-vpn/internal/logging"
 )
 
 func Logger(next http.Handler) http.Handler {
@@ -12,6 +14,31 @@ func Logger(next http.Handler) http.Handler {
 
 		next.ServeHTTP(w, r)
 
-		log.Printf("%s %s %s", r.Method, r.RequestURI, time.Since(start))
+		uri := redactURI(r.RequestURI)
+
+		if client := ClientFromContext(r.Context()); client != nil {
+			location := client.Country
+			if client.Region != "" {
+				location += "/" + client.Region
+			}
+			if location == "" {
+				location = "-"
+			}
+			logging.Infof("%s %s %s %s %s", client.IP, location, r.Method, uri, time.Since(start))
+			return
+		}
+
+		logging.Infof("%s %s %s", r.Method, uri, time.Since(start))
 	})
 }
+
+// linkPath precedes download link tokens, which grant access to a config
+// and are kept out of the log.
+const linkPath = "/vpn/links/"
+
+func redactURI(uri string) string {
+	if i := strings.Index(uri, linkPath); i >= 0 {
+		return uri[:i+len(linkPath)] + "[token]"
+	}
+	return uri
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import "testing"
+
+func TestRedactURI(t *testing.T) {
+	tests := []struct{ uri, want string }{
+		{"/api/v1/vpn/links/abc.def?format=png", "/api/v1/vpn/links/[token]"},
+		{"/vpn/links/abc.def", "/vpn/links/[token]"},
+		{"/api/v1/vpn/sessions/S1/links", "/api/v1/vpn/sessions/S1/links"},
+		{"/api/v1/servers?tag=p2p", "/api/v1/servers?tag=p2p"},
+	}
+	for _, tt := range tests {
+		if got := redactURI(tt.uri); got != tt.want {
+			t.Errorf("redactURI(%q) = %q, want %q", tt.uri, got, tt.want)
+		}
+	}
+}
@@ -3,14 +3,17 @@ package middleware
 import (
 	"log"
 	"net/http"
+
+	"p2nova-vpn/internal/domain"
 )
 
+// Recovery answers a request whose handler panicked with internal_error.
 func Recovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
 				log.Printf("Panic recovered: %v", err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, domain.ErrInternal)
 			}
 		}()
 
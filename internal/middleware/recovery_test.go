@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecovery(t *testing.T) {
+	panicky := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	rec := httptest.NewRecorder()
+	Recovery(panicky).ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/servers", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", rec.Code)
+	}
+	if code := decodeError(t, rec); code != "internal_error" {
+		t.Errorf("code %s, want internal_error", code)
+	}
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"p2nova-vpn/internal/domain"
+)
+
+// maxRedemptions bounds the audit trail kept in memory; the oldest records
+// go first.
+const maxRedemptions = 10000
+
+// LinkRepository remembers which download links were used, until they
+// expire, and keeps the audit trail of redemptions.
+type LinkRepository struct {
+	mu          sync.Mutex
+	used        map[string]int64 // link ID to expiry
+	redemptions []*domain.LinkRedemption
+}
+
+func NewLinkRepository() *LinkRepository {
+	return &LinkRepository{
+		used: make(map[string]int64),
+	}
+}
+
+// MarkUsed records a link as used. It returns false when it already was.
+func (r *LinkRepository) MarkUsed(id string, expiresAt int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Expired links are refused on their expiry alone
+	now := time.Now().Unix()
+	for usedID, exp := range r.used {
+		if exp < now {
+			delete(r.used, usedID)
+		}
+	}
+
+	if _, ok := r.used[id]; ok {
+		return false
+	}
+	r.used[id] = expiresAt
+	return true
+}
+
+// Used reports whether a link was used.
+func (r *LinkRepository) Used(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.used[id]
+	return ok
+}
+
+func (r *LinkRepository) Record(redemption *domain.LinkRedemption) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.redemptions) >= maxRedemptions {
+		r.redemptions = r.redemptions[1:]
+	}
+	r.redemptions = append(r.redemptions, redemption)
+}
+
+// ListRedemptions returns the redemptions of a session's links, or all of
+// them for an empty sessionID, oldest first.
+func (r *LinkRepository) ListRedemptions(sessionID string) []*domain.LinkRedemption {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	redemptions := []*domain.LinkRedemption{}
+	for _, redemption := range r.redemptions {
+		if sessionID == "" || redemption.SessionID == sessionID {
+			redemptions = append(redemptions, redemption)
+		}
+	}
+	return redemptions
+}
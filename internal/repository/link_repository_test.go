@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"p2nova-vpn/internal/domain"
+)
+
+func TestLinkRepositoryMarkUsed(t *testing.T) {
+	repo := NewLinkRepository()
+	later := time.Now().Add(time.Hour).Unix()
+
+	if repo.Used("a") {
+		t.Error("unused link reported used")
+	}
+	if !repo.MarkUsed("a", later) {
+		t.Fatal("first use refused")
+	}
+	if repo.MarkUsed("a", later) || !repo.Used("a") {
+		t.Error("second use accepted")
+	}
+
+	// Expired entries are dropped on the next use of any link
+	repo.MarkUsed("old", time.Now().Add(-time.Minute).Unix())
+	repo.MarkUsed("b", later)
+	if repo.Used("old") {
+		t.Error("expired link still remembered")
+	}
+	if !repo.Used("a") {
+		t.Error("unexpired link forgotten")
+	}
+}
+
+func TestLinkRepositoryRedemptions(t *testing.T) {
+	repo := NewLinkRepository()
+	if got := repo.ListRedemptions(""); got == nil || len(got) != 0 {
+		t.Errorf("empty audit trail = %#v, want an empty list", got)
+	}
+
+	for i, sessionID := range []string{"s1", "s2", "s1"} {
+		repo.Record(&domain.LinkRedemption{LinkID: string(rune('a' + i)), SessionID: sessionID})
+	}
+	if got := repo.ListRedemptions(""); len(got) != 3 || got[0].LinkID != "a" || got[2].LinkID != "c" {
+		t.Errorf("all redemptions = %+v", got)
+	}
+	if got := repo.ListRedemptions("s1"); len(got) != 2 || got[0].LinkID != "a" || got[1].LinkID != "c" {
+		t.Errorf("s1 redemptions = %+v", got)
+	}
+
+	// The oldest records make room
+	for i := 0; i < maxRedemptions; i++ {
+		repo.Record(&domain.LinkRedemption{LinkID: "filler", SessionID: "s3"})
+	}
+	if got := repo.ListRedemptions(""); len(got) != maxRedemptions || got[0].LinkID != "filler" {
+		t.Errorf("kept %d redemptions, first %s", len(got), got[0].LinkID)
+	}
+	if got := repo.ListRedemptions("s1"); len(got) != 0 {
+		t.Errorf("oldest redemptions kept: %+v", got)
+	}
+}
@@ -1,6 +1,12 @@
 package repository
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
 	"sync"
 
 	"p2nova-vpn/internal/domain"
@@ -9,6 +15,36 @@ import (
 type ServerRepository struct {
 	mu      sync.RWMutex
 	servers map[string]*domain.Server
+
+	// path is where the registry is persisted, empty for in-memory only.
+	path      string
+	lastSaved []byte
+}
+
+// serverRecord is the persisted form of a server. It keeps the registry
+// fields and leaves out runtime state such as health.
+type serverRecord struct {
+	Code        string              `json:"code"`
+	Name        string              `json:"name"`
+	IP          string              `json:"ip"`
+	Endpoint    string              `json:"endpoint"`
+	Port        int                 `json:"port"`
+	PublicKey   string              `json:"publicKey"`
+	Subnet      string              `json:"subnet"`
+	Interface   string              `json:"interface,omitempty"`
+	Agent       string              `json:"agent,omitempty"`
+	CanaryKey   string              `json:"canaryKey,omitempty"`
+	Country     string              `json:"country,omitempty"`
+	City        string              `json:"city,omitempty"`
+	Flag        string              `json:"flag,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Features    []string            `json:"features,omitempty"`
+	Latitude    float64             `json:"latitude,omitempty"`
+	Longitude   float64             `json:"longitude,omitempty"`
+	Capacity    int                 `json:"capacity,omitempty"`
+	Tunnel      domain.TunnelParams `json:"tunnel"`
+	State       domain.ServerState  `json:"state,omitempty"`
+	Maintenance *domain.Maintenance `json:"maintenance,omitempty"`
 }
 
 func NewServerRepository() *ServerRepository {
@@ -17,10 +53,68 @@ func NewServerRepository() *ServerRepository {
 	}
 }
 
-func (r *ServerRepository) Store(server *domain.Server) {
+// NewFileServerRepository loads the registry from path, if it exists, and
+// writes every change back to it.
+func NewFileServerRepository(path string) (*ServerRepository, error) {
+	r := NewServerRepository()
+	r.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server store: %w", err)
+	}
+
+	var records []serverRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse server store %s: %w", path, err)
+	}
+
+	for _, rec := range records {
+		if rec.State == "" {
+			rec.State = domain.ServerActive
+		}
+		r.servers[rec.Code] = rec.toServer()
+	}
+	r.lastSaved = data
+	return r, nil
+}
+
+// Store adds or replaces a server. When the registry cannot be saved it is
+// left as it was.
+func (r *ServerRepository) Store(server *domain.Server) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	previous, existed := r.servers[server.Code]
 	r.servers[server.Code] = server
+	if err := r.save(); err != nil {
+		r.restore(server.Code, previous, existed)
+		return err
+	}
+	return nil
+}
+
+func (r *ServerRepository) Delete(code string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previous, existed := r.servers[code]
+	delete(r.servers, code)
+	if err := r.save(); err != nil {
+		r.restore(code, previous, existed)
+		return err
+	}
+	return nil
+}
+
+// restore undoes a change that could not be saved. Callers hold r.mu.
+func (r *ServerRepository) restore(code string, previous *domain.Server, existed bool) {
+	if existed {
+		r.servers[code] = previous
+	} else {
+		delete(r.servers, code)
+	}
 }
 
 func (r *ServerRepository) Get(code string) *domain.Server {
@@ -39,3 +133,95 @@ func (r *ServerRepository) List() []*domain.Server {
 	}
 	return servers
 }
+
+func (r *ServerRepository) Count() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.servers)
+}
+
+// save writes the registry to disk. Runtime-only updates such as health
+// checks produce the same records and are skipped. Callers hold r.mu.
+func (r *ServerRepository) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	records := make([]serverRecord, 0, len(r.servers))
+	for _, server := range r.servers {
+		records = append(records, newServerRecord(server))
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Code < records[j].Code })
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(data, r.lastSaved) {
+		return nil
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write server store: %w", err)
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		return fmt.Errorf("failed to write server store: %w", err)
+	}
+
+	r.lastSaved = data
+	return nil
+}
+
+func newServerRecord(s *domain.Server) serverRecord {
+	return serverRecord{
+		Code:        s.Code,
+		Name:        s.Name,
+		IP:          s.IP,
+		Endpoint:    s.Endpoint,
+		Port:        s.Port,
+		PublicKey:   s.PublicKey,
+		Subnet:      s.Subnet,
+		Interface:   s.Interface,
+		Agent:       s.Agent,
+		CanaryKey:   s.CanaryKey,
+		Country:     s.Country,
+		City:        s.City,
+		Flag:        s.Flag,
+		Tags:        s.Tags,
+		Features:    s.Features,
+		Latitude:    s.Latitude,
+		Longitude:   s.Longitude,
+		Capacity:    s.Capacity,
+		Tunnel:      s.Tunnel,
+		State:       s.State,
+		Maintenance: s.Maintenance,
+	}
+}
+
+func (rec serverRecord) toServer() *domain.Server {
+	return &domain.Server{
+		Code:        rec.Code,
+		Name:        rec.Name,
+		IP:          rec.IP,
+		Endpoint:    rec.Endpoint,
+		Port:        rec.Port,
+		PublicKey:   rec.PublicKey,
+		Subnet:      rec.Subnet,
+		Interface:   rec.Interface,
+		Agent:       rec.Agent,
+		CanaryKey:   rec.CanaryKey,
+		Country:     rec.Country,
+		City:        rec.City,
+		Flag:        rec.Flag,
+		Tags:        rec.Tags,
+		Features:    rec.Features,
+		Latitude:    rec.Latitude,
+		Longitude:   rec.Longitude,
+		Capacity:    rec.Capacity,
+		Tunnel:      rec.Tunnel,
+		State:       rec.State,
+		Maintenance: rec.Maintenance,
+		Health:      domain.HealthUnknown,
+	}
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"p2nova-vpn/internal/domain"
+)
+
+func TestFileServerRepositoryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+
+	repo, err := NewFileServerRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &domain.Server{
+		Code:     "DE",
+		Name:     "Frankfurt",
+		Endpoint: "de.example.com",
+		Port:     51820,
+		Subnet:   "10.8.0.0/24",
+		Tags:     []string{"p2p"},
+		Tunnel:   domain.TunnelParams{MTU: 1380, DNS: []string{"9.9.9.9"}},
+		State:    domain.ServerMaintenance,
+		Maintenance: &domain.Maintenance{
+			Reason:   "kernel update",
+			Deadline: 1700000000,
+			Action:   domain.MaintenanceMigrate,
+		},
+		Health:    domain.HealthHealthy,
+		LatencyMs: 12,
+	}
+	if err := repo.Store(server); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Store(&domain.Server{Code: "FR", State: domain.ServerActive}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete("FR"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileServerRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Count() != 1 {
+		t.Fatalf("reopened registry has %d servers, want 1", reopened.Count())
+	}
+	got := reopened.Get("DE")
+	if got == nil || got.Name != "Frankfurt" || got.Endpoint != "de.example.com" || len(got.Tags) != 1 {
+		t.Fatalf("registry fields were not persisted: %+v", got)
+	}
+	if got.Tunnel.MTU != 1380 || len(got.Tunnel.DNS) != 1 || got.Tunnel.DNS[0] != "9.9.9.9" {
+		t.Errorf("tunnel settings were not persisted: %+v", got.Tunnel)
+	}
+	if got.State != domain.ServerMaintenance || got.Maintenance == nil || got.Maintenance.Reason != "kernel update" {
+		t.Errorf("lifecycle state was not persisted: %+v", got)
+	}
+	if got.Health != domain.HealthUnknown || got.LatencyMs != 0 {
+		t.Errorf("runtime state was persisted: health %s, latency %d", got.Health, got.LatencyMs)
+	}
+}
+
+func TestFileServerRepositorySkipsRuntimeOnlyWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+	repo, err := NewFileServerRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Store(&domain.Server{Code: "DE"}); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A health update changes nothing that is persisted
+	if err := repo.Store(&domain.Server{Code: "DE", Health: domain.HealthDown}); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(path)
+	if !after.ModTime().Equal(before.ModTime()) {
+		t.Error("store file changed on a runtime-only update")
+	}
+}
+
+func TestFileServerRepositoryRejectsCorruptStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileServerRepository(path); err == nil {
+		t.Error("corrupt store loaded")
+	}
+}
+
+func TestFileServerRepositoryKeepsStateOnFailedSave(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "store")
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := NewFileServerRepository(filepath.Join(dir, "servers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Store(&domain.Server{Code: "DE", Name: "Frankfurt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Store(&domain.Server{Code: "FR"}); err == nil {
+		t.Fatal("store succeeded without a directory")
+	}
+	if err := repo.Store(&domain.Server{Code: "DE", Name: "Berlin"}); err == nil {
+		t.Fatal("update succeeded without a directory")
+	}
+	if err := repo.Delete("DE"); err == nil {
+		t.Fatal("delete succeeded without a directory")
+	}
+
+	if repo.Get("FR") != nil || repo.Count() != 1 {
+		t.Error("unsaved server was kept")
+	}
+	if got := repo.Get("DE"); got == nil || got.Name != "Frankfurt" {
+		t.Errorf("DE = %+v, want the saved record", got)
+	}
+}
@@ -35,16 +35,61 @@ func (r *SessionRepository) Update(session *domain.Session) {
 	r.sessions[session.SessionID] = session
 }
 
-func (r *SessionRepository) GetActiveSession() *domain.Session {
+// ListActive returns the connected sessions on a server.
+func (r *SessionRepository) ListActive(serverCode string) []*domain.Session {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
+	var sessions []*domain.Session
+	for _, session := range r.sessions {
+		if session.Connected && session.ServerCode == serverCode {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+// ListConnected returns every connected session.
+func (r *SessionRepository) ListConnected() []*domain.Session {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var sessions []*domain.Session
 	for _, session := range r.sessions {
 		if session.Connected {
-			return session
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+// ListPendingRelease returns ended sessions still holding a peer and an
+// address on their server.
+func (r *SessionRepository) ListPendingRelease() []*domain.Session {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var sessions []*domain.Session
+	for _, session := range r.sessions {
+		if session.PendingRelease {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+// CountActive returns the number of connected sessions on a server.
+func (r *SessionRepository) CountActive(serverCode string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	count := 0
+	for _, session := range r.sessions {
+		if session.Connected && session.ServerCode == serverCode {
+			count++
 		}
 	}
-	return nil
+	return count
 }
 
 func (r *SessionRepository) Count() int {
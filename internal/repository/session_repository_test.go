@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"testing"
+
+	"p2nova-vpn/internal/domain"
+)
+
+func TestSessionRepositoryCountActive(t *testing.T) {
+	repo := NewSessionRepository()
+	repo.Store(&domain.Session{SessionID: "a", ServerCode: "DE", Connected: true})
+	repo.Store(&domain.Session{SessionID: "b", ServerCode: "DE", Connected: true})
+	repo.Store(&domain.Session{SessionID: "c", ServerCode: "DE"})
+	repo.Store(&domain.Session{SessionID: "d", ServerCode: "FR", Connected: true})
+
+	for code, want := range map[string]int{"DE": 2, "FR": 1, "NL": 0} {
+		if got := repo.CountActive(code); got != want {
+			t.Errorf("CountActive(%s) = %d, want %d", code, got, want)
+		}
+	}
+}
+
+func TestSessionRepositoryListActive(t *testing.T) {
+	repo := NewSessionRepository()
+	repo.Store(&domain.Session{SessionID: "a", ServerCode: "DE", Connected: true})
+	repo.Store(&domain.Session{SessionID: "b", ServerCode: "DE"})
+	repo.Store(&domain.Session{SessionID: "c", ServerCode: "FR", Connected: true})
+
+	active := repo.ListActive("DE")
+	if len(active) != 1 || active[0].SessionID != "a" {
+		t.Errorf("ListActive(DE) = %+v, want only a", active)
+	}
+	if active := repo.ListActive("NL"); len(active) != 0 {
+		t.Errorf("ListActive(NL) = %+v", active)
+	}
+}
+
+func TestSessionRepositoryFailoverListings(t *testing.T) {
+	repo := NewSessionRepository()
+	repo.Store(&domain.Session{SessionID: "a", ServerCode: "DE", Connected: true})
+	repo.Store(&domain.Session{SessionID: "b", ServerCode: "FR", Connected: true})
+	repo.Store(&domain.Session{SessionID: "c", ServerCode: "DE", PendingRelease: true})
+	repo.Store(&domain.Session{SessionID: "d", ServerCode: "DE"})
+
+	ids := func(sessions []*domain.Session) map[string]bool {
+		set := make(map[string]bool)
+		for _, session := range sessions {
+			set[session.SessionID] = true
+		}
+		return set
+	}
+	if got := ids(repo.ListConnected()); len(got) != 2 || !got["a"] || !got["b"] {
+		t.Errorf("ListConnected = %v, want a and b", got)
+	}
+	if got := ids(repo.ListPendingRelease()); len(got) != 1 || !got["c"] {
+		t.Errorf("ListPendingRelease = %v, want c", got)
+	}
+}
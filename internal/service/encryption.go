@@ -0,0 +1,66 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/pkg/envelope"
+)
+
+// sealSecrets encrypts a session's key material for storage.
+func (s *VPNService) sealSecrets(secrets *domain.SessionSecrets) (*envelope.Envelope, error) {
+	data, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.config.Live.Keyring().Seal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to seal session keys: %w", err)
+	}
+	return sealed, nil
+}
+
+// sessionSecrets decrypts a session's key material. Ended sessions have
+// none left.
+func (s *VPNService) sessionSecrets(session *domain.Session) (*domain.SessionSecrets, error) {
+	if session.Secrets == nil {
+		return nil, domain.ErrNotConnected
+	}
+	data, err := s.config.Live.Keyring().Open(session.Secrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session keys: %w", err)
+	}
+
+	var secrets domain.SessionSecrets
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, err
+	}
+	return &secrets, nil
+}
+
+// Reencrypt rewraps the key material of every session under the current
+// master key, so older keys can be retired. It returns the master key
+// version and the number of sessions rewrapped.
+func (s *VPNService) Reencrypt() (int, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyring := s.config.Live.Keyring()
+
+	count := 0
+	for _, session := range s.sessionRepo.ListConnected() {
+		sealed := session.Secrets
+		if sealed == nil || sealed.KeyVersion == keyring.Current() {
+			continue
+		}
+		rewrapped, err := keyring.Rewrap(sealed)
+		if err != nil {
+			return keyring.Current(), count, fmt.Errorf("session %s: %w", session.SessionID, err)
+		}
+		session.Secrets = rewrapped
+		s.sessionRepo.Update(session)
+		count++
+	}
+	return keyring.Current(), count, nil
+}
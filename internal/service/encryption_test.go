@@ -0,0 +1,110 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/pkg/envelope"
+)
+
+func masterKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, envelope.KeyLen)
+}
+
+func TestSessionSecretsSealed(t *testing.T) {
+	t.Setenv("ENCRYPTION_KEYS", "1:"+base64.StdEncoding.EncodeToString(masterKey(1)))
+	env := newTestEnv(t, testServer("DE", 1))
+
+	session, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, secrets, err := env.vpn.SessionConfig(session.SessionID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey := secrets.Tunnel.PrivateKey
+	if privateKey == "" || !strings.Contains(secrets.PeerConfig, privateKey) {
+		t.Fatalf("secrets = %+v", secrets)
+	}
+
+	stored := env.sessions.Get(session.SessionID)
+	if stored.Secrets == nil || stored.Secrets.KeyVersion != 1 {
+		t.Fatalf("stored secrets = %+v", stored.Secrets)
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), privateKey) || bytes.Contains(stored.Secrets.Ciphertext, []byte(privateKey)) {
+		t.Error("the private key is stored in the clear")
+	}
+
+	// Ended sessions keep no key material
+	if err := env.vpn.Disconnect(session.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if env.sessions.Get(session.SessionID).Secrets != nil {
+		t.Error("disconnected session kept its secrets")
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	t.Setenv("ENCRYPTION_KEYS", "1:"+base64.StdEncoding.EncodeToString(masterKey(1)))
+	env := newTestEnv(t, testServer("DE", 1))
+
+	var sessions []*domain.Session
+	for i := 0; i < 3; i++ {
+		session, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := env.vpn.Disconnect(sessions[2].SessionID); err != nil {
+		t.Fatal(err)
+	}
+	_, before, err := env.vpn.SessionConfig(sessions[0].SessionID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotate to version 2, keeping version 1 readable
+	keyring, err := envelope.NewKeyring(map[int][]byte{1: masterKey(1), 2: masterKey(2)}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.cfg.Keyring = keyring
+	env.cfg.Live.Apply(env.cfg)
+
+	version, count, err := env.vpn.Reencrypt()
+	if err != nil || version != 2 || count != 2 {
+		t.Fatalf("reencrypt = %d, %d, %v; want version 2, 2 sessions", version, count, err)
+	}
+	if _, count, _ := env.vpn.Reencrypt(); count != 0 {
+		t.Errorf("second reencrypt rewrapped %d sessions", count)
+	}
+
+	// Version 1 can now be retired
+	retired, err := envelope.NewKeyring(map[int][]byte{2: masterKey(2)}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, session := range sessions[:2] {
+		sealed := env.sessions.Get(session.SessionID).Secrets
+		if sealed.KeyVersion != 2 {
+			t.Errorf("session %s is sealed with version %d", session.SessionID, sealed.KeyVersion)
+		}
+		if _, err := retired.Open(sealed); err != nil {
+			t.Errorf("session %s: %v", session.SessionID, err)
+		}
+	}
+	_, after, err := env.vpn.SessionConfig(sessions[0].SessionID, "")
+	if err != nil || after.Tunnel.PrivateKey != before.Tunnel.PrivateKey {
+		t.Errorf("key material changed on reencrypt: %v", err)
+	}
+}
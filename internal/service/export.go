@@ -0,0 +1,301 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"strings"
+
+	"p2nova-vpn/internal/domain"
+)
+
+// Export renders a client's tunnel in the format of another client. It uses
+// the same data as the wg-quick config.
+func (s *WireguardService) Export(server *domain.Server, t *domain.TunnelConfig, format string, opts domain.ExportOptions) (*domain.ConfigExport, error) {
+	data := templateData(server, t, opts.Platform)
+	name := InterfaceName(server.Code)
+
+	switch format {
+	case domain.ConfigFormatUCI:
+		return &domain.ConfigExport{
+			Content:     exportUCI(data, uciName(server.Code)),
+			ContentType: "text/plain; charset=utf-8",
+			FileName:    name + ".uci",
+		}, nil
+
+	case domain.ConfigFormatNM:
+		return &domain.ConfigExport{
+			Content:     exportNetworkManager(data, name, s.newUUID()),
+			ContentType: "text/plain; charset=utf-8",
+			FileName:    name + ".nmconnection",
+		}, nil
+
+	case domain.ConfigFormatRouterOS:
+		return &domain.ConfigExport{
+			Content:     exportRouterOS(data, name),
+			ContentType: "text/plain; charset=utf-8",
+			FileName:    name + ".rsc",
+		}, nil
+
+	case domain.ConfigFormatMobileConfig:
+		// The profile carries a wg-quick config for the WireGuard app,
+		// rendered for the Apple platform
+		if opts.Platform != "macos" {
+			opts.Platform = "ios"
+		}
+		wgQuick, err := s.generatePeerConfig(server, t, opts.Platform)
+		if err != nil {
+			return nil, err
+		}
+		return &domain.ConfigExport{
+			Content:     exportMobileConfig(data, wgQuick, opts, s.newUUID),
+			ContentType: "application/x-apple-aspen-config",
+			FileName:    name + ".mobileconfig",
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown export format %q", domain.ErrInvalidRequest, format)
+}
+
+// maxExportName is the longest interface name Linux allows.
+const maxExportName = 15
+
+// InterfaceName names the tunnel interface on the client after the server
+// code, for exports and wg-quick downloads alike. A name that would be too
+// long keeps the start of the code and ends in a hash of all of it, so
+// codes that differ past the cut still get different interfaces.
+func InterfaceName(code string) string {
+	name := "p2nova-" + code
+	if len(name) > maxExportName {
+		return hashedName(name, code, "-")
+	}
+	return name
+}
+
+// uciName is InterfaceName for OpenWrt, whose section names allow no hyphens.
+// Hyphens become underscores, so a code with hyphens also gets the hash to
+// keep it apart from the same code spelt with underscores.
+func uciName(code string) string {
+	name := "p2nova_" + strings.ReplaceAll(code, "-", "_")
+	if len(name) > maxExportName || strings.Contains(code, "-") {
+		return hashedName(name, code, "_")
+	}
+	return name
+}
+
+// hashedName cuts name to fit a separator and four hex digits of the hash
+// of code within maxExportName, and appends them.
+func hashedName(name, code, sep string) string {
+	sum := sha256.Sum256([]byte(code))
+	suffix := sep + hex.EncodeToString(sum[:2])
+	if len(name) > maxExportName-len(suffix) {
+		name = name[:maxExportName-len(suffix)]
+	}
+	return strings.TrimRight(name, sep) + suffix
+}
+
+// exportUCI renders an OpenWrt network section for /etc/config/network.
+func exportUCI(d *domain.TemplateData, iface string) []byte {
+	var b bytes.Buffer
+	host, port, _ := net.SplitHostPort(d.Endpoint)
+
+	fmt.Fprintf(&b, "config interface '%s'\n", iface)
+	fmt.Fprintf(&b, "\toption proto 'wireguard'\n")
+	fmt.Fprintf(&b, "\toption private_key '%s'\n", d.PrivateKey)
+	fmt.Fprintf(&b, "\tlist addresses '%s'\n", d.Address)
+	fmt.Fprintf(&b, "\toption mtu '%d'\n", d.MTU)
+	for _, dns := range d.DNS {
+		fmt.Fprintf(&b, "\tlist dns '%s'\n", dns)
+	}
+
+	fmt.Fprintf(&b, "\nconfig wireguard_%s\n", iface)
+	fmt.Fprintf(&b, "\toption description '%s'\n", uciQuote(d.Server.Name))
+	fmt.Fprintf(&b, "\toption public_key '%s'\n", d.PublicKey)
+	fmt.Fprintf(&b, "\toption endpoint_host '%s'\n", host)
+	fmt.Fprintf(&b, "\toption endpoint_port '%s'\n", port)
+	if d.PersistentKeepalive > 0 {
+		fmt.Fprintf(&b, "\toption persistent_keepalive '%d'\n", d.PersistentKeepalive)
+	}
+	fmt.Fprintf(&b, "\toption route_allowed_ips '1'\n")
+	for _, allowed := range d.AllowedIPs {
+		fmt.Fprintf(&b, "\tlist allowed_ips '%s'\n", allowed)
+	}
+	return b.Bytes()
+}
+
+// uciQuote escapes a value for a single-quoted UCI option.
+func uciQuote(s string) string {
+	return strings.ReplaceAll(s, "'", `'\''`)
+}
+
+// exportNetworkManager renders a keyfile for
+// /etc/NetworkManager/system-connections. The tunnel takes all DNS queries.
+func exportNetworkManager(d *domain.TemplateData, name, uuid string) []byte {
+	var b bytes.Buffer
+	var dns4, dns6 []string
+	for _, dns := range d.DNS {
+		if ip := net.ParseIP(dns); ip != nil && ip.To4() == nil {
+			dns6 = append(dns6, dns)
+		} else {
+			dns4 = append(dns4, dns)
+		}
+	}
+
+	fmt.Fprintf(&b, "[connection]\n")
+	fmt.Fprintf(&b, "id=%s\n", name)
+	fmt.Fprintf(&b, "uuid=%s\n", uuid)
+	fmt.Fprintf(&b, "type=wireguard\n")
+	fmt.Fprintf(&b, "interface-name=%s\n", name)
+	fmt.Fprintf(&b, "autoconnect=false\n")
+
+	fmt.Fprintf(&b, "\n[wireguard]\n")
+	fmt.Fprintf(&b, "private-key=%s\n", d.PrivateKey)
+	fmt.Fprintf(&b, "mtu=%d\n", d.MTU)
+
+	fmt.Fprintf(&b, "\n[wireguard-peer.%s]\n", d.PublicKey)
+	fmt.Fprintf(&b, "endpoint=%s\n", d.Endpoint)
+	fmt.Fprintf(&b, "allowed-ips=%s;\n", strings.Join(d.AllowedIPs, ";"))
+	if d.PersistentKeepalive > 0 {
+		fmt.Fprintf(&b, "persistent-keepalive=%d\n", d.PersistentKeepalive)
+	}
+
+	fmt.Fprintf(&b, "\n[ipv4]\n")
+	fmt.Fprintf(&b, "method=manual\n")
+	fmt.Fprintf(&b, "address1=%s\n", d.Address)
+	if len(dns4) > 0 {
+		fmt.Fprintf(&b, "dns=%s;\n", strings.Join(dns4, ";"))
+		fmt.Fprintf(&b, "dns-search=~;\n")
+		fmt.Fprintf(&b, "dns-priority=-50\n")
+	}
+
+	fmt.Fprintf(&b, "\n[ipv6]\n")
+	if len(dns6) > 0 {
+		fmt.Fprintf(&b, "method=ignore\n")
+		fmt.Fprintf(&b, "dns=%s;\n", strings.Join(dns6, ";"))
+	} else {
+		fmt.Fprintf(&b, "method=disabled\n")
+	}
+	return b.Bytes()
+}
+
+// exportRouterOS renders a RouterOS 7 script. The default routes and the
+// DNS servers are left as comments: /ip dns set replaces the router's own
+// resolvers, and sending everything into the tunnel needs policy the
+// operator of that router has to choose.
+func exportRouterOS(d *domain.TemplateData, name string) []byte {
+	var b bytes.Buffer
+	host, port, _ := net.SplitHostPort(d.Endpoint)
+
+	fmt.Fprintf(&b, "# %s (%s)\n", d.Server.Name, d.Server.Code)
+	fmt.Fprintf(&b, "/interface wireguard add name=%s mtu=%d private-key=\"%s\"\n", name, d.MTU, d.PrivateKey)
+
+	fmt.Fprintf(&b, "/interface wireguard peers add interface=%s public-key=\"%s\" endpoint-address=%s endpoint-port=%s allowed-address=%s",
+		name, d.PublicKey, host, port, strings.Join(d.AllowedIPs, ","))
+	if d.PersistentKeepalive > 0 {
+		fmt.Fprintf(&b, " persistent-keepalive=%ds", d.PersistentKeepalive)
+	}
+	b.WriteString("\n")
+
+	fmt.Fprintf(&b, "/ip address add address=%s interface=%s\n", d.Address, name)
+	if len(d.DNS) > 0 {
+		fmt.Fprintf(&b, "# To resolve through the tunnel, replacing the router's DNS servers:\n")
+		fmt.Fprintf(&b, "# /ip dns set servers=%s\n", strings.Join(d.DNS, ","))
+	}
+
+	for _, allowed := range d.AllowedIPs {
+		switch allowed {
+		case "0.0.0.0/0", "::/0":
+			fmt.Fprintf(&b, "# Route %s through %s as your routing policy requires\n", allowed, name)
+		default:
+			command := "/ip route"
+			if strings.Contains(allowed, ":") {
+				command = "/ipv6 route"
+			}
+			fmt.Fprintf(&b, "%s add dst-address=%s gateway=%s\n", command, allowed, name)
+		}
+	}
+	return b.Bytes()
+}
+
+// exportMobileConfig renders an Apple configuration profile with a VPN
+// payload for the WireGuard app. newUUID names the profile and the payload.
+func exportMobileConfig(d *domain.TemplateData, wgQuick string, opts domain.ExportOptions, newUUID func() string) []byte {
+	subType := "com.wireguard.ios"
+	if opts.Platform == "macos" {
+		subType = "com.wireguard.macos"
+	}
+	identifier := "com.p2nova.vpn." + d.Server.Code
+	displayName := "P2Nova " + d.Server.Name
+
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString(`<plist version="1.0">` + "\n<dict>\n")
+	plistString(&b, "PayloadDisplayName", displayName)
+	plistString(&b, "PayloadIdentifier", identifier)
+	plistString(&b, "PayloadType", "Configuration")
+	plistString(&b, "PayloadUUID", newUUID())
+	b.WriteString("<key>PayloadVersion</key><integer>1</integer>\n")
+
+	b.WriteString("<key>PayloadContent</key>\n<array>\n<dict>\n")
+	plistString(&b, "PayloadDisplayName", displayName)
+	plistString(&b, "PayloadIdentifier", identifier+".vpn")
+	plistString(&b, "PayloadType", "com.apple.vpn.managed")
+	plistString(&b, "PayloadUUID", newUUID())
+	b.WriteString("<key>PayloadVersion</key><integer>1</integer>\n")
+	plistString(&b, "UserDefinedName", displayName)
+	plistString(&b, "VPNType", "VPN")
+	plistString(&b, "VPNSubType", subType)
+
+	b.WriteString("<key>VendorConfig</key>\n<dict>\n")
+	plistString(&b, "WgQuickConfig", wgQuick)
+	b.WriteString("</dict>\n")
+
+	b.WriteString("<key>VPN</key>\n<dict>\n")
+	plistString(&b, "RemoteAddress", d.Endpoint)
+	plistString(&b, "AuthenticationMethod", "Password")
+	if opts.OnDemand {
+		b.WriteString("<key>OnDemandEnabled</key><integer>1</integer>\n")
+		b.WriteString("<key>OnDemandRules</key>\n<array>\n")
+		if len(opts.TrustedSSIDs) > 0 {
+			b.WriteString("<dict>\n")
+			plistString(&b, "Action", "Disconnect")
+			plistString(&b, "InterfaceTypeMatch", "WiFi")
+			b.WriteString("<key>SSIDMatch</key>\n<array>\n")
+			for _, ssid := range opts.TrustedSSIDs {
+				b.WriteString("<string>" + xmlEscape(ssid) + "</string>\n")
+			}
+			b.WriteString("</array>\n</dict>\n")
+		}
+		b.WriteString("<dict>\n")
+		plistString(&b, "Action", "Connect")
+		b.WriteString("</dict>\n</array>\n")
+	}
+	b.WriteString("</dict>\n")
+
+	b.WriteString("</dict>\n</array>\n</dict>\n</plist>\n")
+	return b.Bytes()
+}
+
+func plistString(b *bytes.Buffer, key, value string) {
+	fmt.Fprintf(b, "<key>%s</key><string>%s</string>\n", key, xmlEscape(value))
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// randomUUID returns a random version 4 UUID.
+func randomUUID() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"p2nova-vpn/internal/domain"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestExportGolden(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+	var n int
+	env.wg.newUUID = func() string {
+		n++
+		return fmt.Sprintf("00000000-0000-4000-8000-%012d", n)
+	}
+
+	server := &domain.Server{Code: "DE", Name: "Frankfurt & Co's", Endpoint: "de.example.com", Port: 51820}
+	tunnel := &domain.TunnelConfig{
+		PrivateKey:          testKey(7),
+		Address:             "10.8.1.2/32",
+		DNS:                 []string{"10.8.1.1", "fd00:8::1"},
+		MTU:                 1380,
+		PublicKey:           testKey(1),
+		Endpoint:            "de.example.com:51820",
+		AllowedIPs:          []string{"0.0.0.0/0", "::/0", "10.20.0.0/16", "fd00:20::/64"},
+		PersistentKeepalive: 25,
+	}
+	opts := domain.ExportOptions{OnDemand: true, TrustedSSIDs: []string{"Home <5G>", "Office"}}
+
+	for _, format := range []string{domain.ConfigFormatUCI, domain.ConfigFormatNM, domain.ConfigFormatRouterOS, domain.ConfigFormatMobileConfig} {
+		n = 0
+		export, err := env.wg.Export(server, tunnel, format, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		golden := filepath.Join("testdata", "export", format+".golden")
+		if *update {
+			if err := os.WriteFile(golden, export.Content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(export.Content, want) {
+			t.Errorf("%s export differs from %s:\n%s", format, golden, export.Content)
+		}
+	}
+
+	if _, err := env.wg.Export(server, tunnel, "ovpn", opts); err == nil {
+		t.Error("unknown format exported")
+	}
+}
+
+func TestExportServerNameOnOneLine(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+	server := &domain.Server{Code: "DE", Name: "Frankfurt\r\n/system reset-configuration\u2028x", City: "a\nb", Endpoint: "de.example.com", Port: 51820}
+	tunnel := &domain.TunnelConfig{
+		PrivateKey: testKey(7),
+		Address:    "10.8.1.2/32",
+		PublicKey:  testKey(1),
+		Endpoint:   "de.example.com:51820",
+		AllowedIPs: []string{"0.0.0.0/0"},
+	}
+
+	for _, format := range []string{domain.ConfigFormatUCI, domain.ConfigFormatRouterOS} {
+		export, err := env.wg.Export(server, tunnel, format, domain.ExportOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		for _, line := range strings.Split(string(export.Content), "\n") {
+			if strings.HasPrefix(line, "/system") || strings.HasSuffix(line, "\r") {
+				t.Errorf("%s: the server name broke the line:\n%s", format, export.Content)
+			}
+		}
+		if !strings.Contains(string(export.Content), "Frankfurt  /system reset-configuration x") {
+			t.Errorf("%s: server name missing:\n%s", format, export.Content)
+		}
+	}
+
+	if data := templateData(server, tunnel, ""); data.Server.City != "a b" {
+		t.Errorf("city = %q", data.Server.City)
+	}
+}
+
+func TestExportName(t *testing.T) {
+	tests := map[string]string{
+		"DE":       "p2nova-DE",
+		"de":       "p2nova-de",
+		"eu-west1": "p2nova-eu-west1",
+	}
+	for code, want := range tests {
+		if got := InterfaceName(code); got != want {
+			t.Errorf("InterfaceName(%s) = %s, want %s", code, got, want)
+		}
+	}
+	if got := uciName("lab_1"); got != "p2nova_lab_1" {
+		t.Errorf("uciName(lab_1) = %s", got)
+	}
+
+	// Names stay within the interface limit and apart from each other
+	codes := []string{"DE", "de", "frankfurt-1", "frankfurt-2", "frankfurt_1", "eu-west", "eu_west", strings.Repeat("a", 32), strings.Repeat("a", 31) + "b"}
+	for _, name := range []func(string) string{InterfaceName, uciName} {
+		seen := make(map[string]string)
+		for _, code := range codes {
+			got := name(code)
+			if len(got) > maxExportName {
+				t.Errorf("%s: %s is longer than %d", code, got, maxExportName)
+			}
+			if other, ok := seen[got]; ok {
+				t.Errorf("%s and %s are both named %s", other, code, got)
+			}
+			seen[got] = code
+		}
+	}
+	for _, code := range codes {
+		if got := uciName(code); strings.Contains(got, "-") {
+			t.Errorf("UCI name %s has a hyphen", got)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"p2nova-vpn/internal/config"
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/internal/logging"
+	"p2nova-vpn/pkg/wireguard"
+)
+
+// HealthChecker periodically probes every server and records the result on
+// the server through ServerService.
+type HealthChecker struct {
+	serverService *ServerService
+	wgService     *WireguardService
+	interval      time.Duration
+}
+
+func NewHealthChecker(serverService *ServerService, wgService *WireguardService, cfg *config.Config) *HealthChecker {
+	return &HealthChecker{
+		serverService: serverService,
+		wgService:     wgService,
+		interval:      cfg.HealthCheckInterval,
+	}
+}
+
+// Run checks all servers immediately and then on every tick until ctx is
+// cancelled.
+func (c *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.CheckAll()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *HealthChecker) CheckAll() {
+	servers, _ := c.serverService.ListServers(domain.ServerFilter{})
+
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *domain.Server) {
+			defer wg.Done()
+			state, detail, latency := c.probe(server)
+			if state != server.Health {
+				logging.Infof("Server %s health changed: %s -> %s %s", server.Code, server.Health, state, detail)
+			}
+			c.serverService.SetHealth(server.Code, state, detail, latency)
+		}(server)
+	}
+	wg.Wait()
+}
+
+// probe runs the checks from cheapest to most specific. An unreachable agent
+// or a closed WireGuard port means the node is down; a stale canary means
+// tunnels may not be passing traffic even though the node answers. The
+// round trip of the peer API call is reported as the server's latency: for
+// an agent that is the control plane's distance to the node, for a local
+// interface merely the time wg takes. Neither is the client's latency.
+func (c *HealthChecker) probe(server *domain.Server) (domain.HealthState, string, time.Duration) {
+	start := time.Now()
+	peers, err := c.wgService.ListPeers(server)
+	latency := time.Since(start)
+	if err != nil {
+		return domain.HealthDown, fmt.Sprintf("peer API failed: %v", err), 0
+	}
+
+	if err := probeUDP(server.Endpoint, server.Port); err != nil {
+		return domain.HealthDown, fmt.Sprintf("WireGuard port unreachable: %v", err), latency
+	}
+
+	if server.CanaryKey != "" {
+		canary := findPeer(peers, server.CanaryKey)
+		if canary == nil {
+			return domain.HealthDegraded, "canary peer not configured on node", latency
+		}
+		if canary.LatestHandshake.IsZero() || time.Since(canary.LatestHandshake) > wireguard.ActiveHandshakeWindow {
+			return domain.HealthDegraded, "canary handshake is stale", latency
+		}
+	}
+
+	return domain.HealthHealthy, "", latency
+}
+
+// probeUDP sends a junk datagram to the WireGuard port. WireGuard silently
+// drops it, so only an ICMP port-unreachable (seen as ECONNREFUSED on the
+// next read) tells us nothing is listening.
+func probeUDP(host string, port int) error {
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(host, fmt.Sprint(port)), 2*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte{0}); err != nil {
+		return err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+	return nil
+}
+
+func findPeer(peers []wireguard.Peer, publicKey string) *wireguard.Peer {
+	for i := range peers {
+		if peers[i].PublicKey == publicKey {
+			return &peers[i]
+		}
+	}
+	return nil
+}
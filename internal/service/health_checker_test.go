@@ -0,0 +1,108 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/pkg/wireguard"
+)
+
+// udpPort returns a local UDP port, listening for the test's duration when
+// open, otherwise closed again so probes are refused.
+func udpPort(t *testing.T, open bool) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	if open {
+		t.Cleanup(func() { conn.Close() })
+	} else {
+		conn.Close()
+	}
+	return port
+}
+
+type failingBackend struct{}
+
+func (failingBackend) AddPeer(string, string) error { return errors.New("node unreachable") }
+func (failingBackend) RemovePeer(string) error      { return errors.New("node unreachable") }
+func (failingBackend) ListPeers() ([]wireguard.Peer, error) {
+	return nil, errors.New("node unreachable")
+}
+
+func TestHealthCheckStates(t *testing.T) {
+	healthy := testServer("OK", 1)
+	healthy.Endpoint, healthy.Port = "127.0.0.1", udpPort(t, true)
+
+	closed := testServer("CLOSED", 2)
+	closed.Endpoint, closed.Port = "127.0.0.1", udpPort(t, false)
+
+	unreachable := testServer("AGENT", 3)
+	unreachable.Endpoint, unreachable.Port = "127.0.0.1", udpPort(t, true)
+
+	noCanary := testServer("NOCANARY", 4)
+	noCanary.Endpoint, noCanary.Port = "127.0.0.1", udpPort(t, true)
+	noCanary.CanaryKey = testKey(40)
+
+	stale := testServer("STALE", 5)
+	stale.Endpoint, stale.Port = "127.0.0.1", udpPort(t, true)
+	stale.CanaryKey = testKey(50)
+
+	fresh := testServer("FRESH", 6)
+	fresh.Endpoint, fresh.Port = "127.0.0.1", udpPort(t, true)
+	fresh.CanaryKey = testKey(60)
+
+	env := newTestEnv(t, healthy, closed, unreachable, noCanary, stale, fresh)
+	env.backends["STALE"].SetTraffic(stale.CanaryKey, time.Now().Add(-time.Hour), 0, 0)
+	env.backends["FRESH"].SetTraffic(fresh.CanaryKey, time.Now(), 0, 0)
+	local := env.wg.local
+	env.wg.local = func(iface string) wireguard.Backend {
+		if iface == unreachable.Interface {
+			return failingBackend{}
+		}
+		return local(iface)
+	}
+
+	NewHealthChecker(env.servers, env.wg, env.cfg).CheckAll()
+
+	want := map[string]domain.HealthState{
+		"OK":       domain.HealthHealthy,
+		"CLOSED":   domain.HealthDown,
+		"AGENT":    domain.HealthDown,
+		"NOCANARY": domain.HealthDegraded,
+		"STALE":    domain.HealthDegraded,
+		"FRESH":    domain.HealthHealthy,
+	}
+	servers, err := env.servers.ListServers(domain.ServerFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, server := range servers {
+		if server.Health != want[server.Code] {
+			t.Errorf("%s is %s (%s), want %s", server.Code, server.Health, server.HealthDetail, want[server.Code])
+		}
+		if server.LastChecked == 0 {
+			t.Errorf("%s has no last-checked time", server.Code)
+		}
+		if server.Health == domain.HealthHealthy && server.LatencyMs == 0 {
+			t.Errorf("%s has no latency", server.Code)
+		}
+	}
+}
+
+func TestConnectRefusesDownServer(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+	env.servers.SetHealth("DE", domain.HealthDown, "test", 0)
+
+	if _, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil); err != domain.ErrServerDown {
+		t.Errorf("got %v, want ErrServerDown", err)
+	}
+	if _, _, err := env.vpn.Connect(domain.StrategyAuto, domain.TunnelRequest{}, nil); err != domain.ErrNoServerAvailable {
+		t.Errorf("auto selection got %v, want ErrNoServerAvailable", err)
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"p2nova-vpn/internal/config"
+	"p2nova-vpn/internal/repository"
+	"p2nova-vpn/pkg/wireguard"
+)
+
+// testKey returns a valid base64 WireGuard key made of one repeated byte.
+func testKey(b byte) string {
+	key := make([]byte, wireguard.KeyLen)
+	for i := range key {
+		key[i] = b
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// testServer returns a fleet entry for a server with its own endpoint, key,
+// subnet and interface.
+func testServer(code string, n byte) config.ServerConfig {
+	return config.ServerConfig{
+		Code:      code,
+		Endpoint:  "192.0.2." + string('0'+n),
+		PublicKey: testKey(n),
+		Subnet:    "10.8." + string('0'+n) + ".0/24",
+		Interface: "wg-" + code,
+	}
+}
+
+// testEnv wires the services together the way cmd/api does, with every
+// server's interface replaced by an in-memory backend.
+type testEnv struct {
+	cfg      *config.Config
+	sessions *repository.SessionRepository
+	servers  *ServerService
+	wg       *WireguardService
+	vpn      *VPNService
+	backends map[string]*wireguard.FakeBackend // by server code
+}
+
+func newTestEnv(t *testing.T, servers ...config.ServerConfig) *testEnv {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]interface{}{"servers": servers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fleet := filepath.Join(t.TempDir(), "fleet.json")
+	if err := os.WriteFile(fleet, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FLEET_FILE", fleet)
+	// No lookups leave the machine
+	t.Setenv("GEO_PROVIDERS", "static")
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := &testEnv{
+		cfg:      cfg,
+		sessions: repository.NewSessionRepository(),
+		backends: make(map[string]*wireguard.FakeBackend),
+	}
+	var mu sync.Mutex
+	interfaces := make(map[string]*wireguard.FakeBackend)
+	for _, srv := range cfg.Servers {
+		backend := wireguard.NewFakeBackend()
+		env.backends[srv.Code] = backend
+		interfaces[srv.Interface] = backend
+	}
+
+	if env.servers, err = NewServerService(repository.NewServerRepository(), env.sessions, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if env.wg, err = NewWireguardService(cfg); err != nil {
+		t.Fatal(err)
+	}
+	// Servers added later get an interface of their own on first use
+	env.wg.UseLocalBackends(func(iface string) wireguard.Backend {
+		mu.Lock()
+		defer mu.Unlock()
+		backend, ok := interfaces[iface]
+		if !ok {
+			backend = wireguard.NewFakeBackend()
+			interfaces[iface] = backend
+		}
+		return backend
+	})
+	env.vpn = NewVPNService(env.sessions, env.servers, env.wg, cfg)
+	return env
+}
+
+// allocated reports whether ip is taken in a server's address pool.
+func (env *testEnv) allocated(t *testing.T, code, ip string) bool {
+	t.Helper()
+	server, err := env.servers.GetServer(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := env.vpn.poolFor(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return pool.allocated[ip]
+}
+
+// peers returns the peers on a server's backend.
+func (env *testEnv) peers(t *testing.T, code string) []wireguard.Peer {
+	t.Helper()
+	peers, err := env.backends[code].ListPeers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return peers
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/internal/logging"
+)
+
+// lifecycleInterval is how often maintenance deadlines are enforced.
+const lifecycleInterval = 5 * time.Second
+
+// Run enforces server lifecycle deadlines, fails sessions over from down
+// servers and cleans up after recovered ones until ctx is cancelled.
+func (s *VPNService) Run(ctx context.Context) {
+	ticker := time.NewTicker(lifecycleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.enforceMaintenance()
+			s.failover()
+			s.releaseRecovered()
+		}
+	}
+}
+
+// failover moves sessions off servers the health checker found down. The
+// dead node's peer and address are left for releaseRecovered. Like every
+// function here, it takes s.mu only around session changes, never across
+// peer changes.
+func (s *VPNService) failover() {
+	s.mu.RLock()
+	sessions := s.sessionRepo.ListConnected()
+	s.mu.RUnlock()
+
+	for _, session := range sessions {
+		server, err := s.serverService.GetServer(session.ServerCode)
+		if err != nil || server.Health != domain.HealthDown {
+			continue
+		}
+
+		reason := fmt.Sprintf("failed over from %s: server down", server.Code)
+		if _, err := s.migrate(session, reason, false); err != nil {
+			// Try again on the next tick; a healthy server may appear.
+			logging.Warnf("Failover of session %s off %s failed: %v", session.SessionID, server.Code, err)
+		}
+	}
+}
+
+// releaseRecovered removes the leftover peers of failed-over sessions once
+// their server is reachable again.
+func (s *VPNService) releaseRecovered() {
+	s.mu.RLock()
+	pending := s.sessionRepo.ListPendingRelease()
+	s.mu.RUnlock()
+
+	for _, session := range pending {
+		server, err := s.serverService.GetServer(session.ServerCode)
+		if err != nil {
+			// The server was deleted along with its peers and pool.
+			s.released(session)
+			continue
+		}
+		if server.Health != domain.HealthHealthy && server.Health != domain.HealthDegraded {
+			continue
+		}
+
+		if err := s.wgService.RemovePeer(server, session.ClientKey); err != nil {
+			logging.Warnf("Failed to release peer of session %s on %s: %v", session.SessionID, server.Code, err)
+			continue
+		}
+		if pool, err := s.poolFor(server); err == nil {
+			pool.Release(session.ClientIP)
+		}
+
+		s.released(session)
+		logging.Infof("Released resources of session %s on recovered server %s", session.SessionID, server.Code)
+	}
+}
+
+// released clears a session's pending release.
+func (s *VPNService) released(session *domain.Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session.PendingRelease = false
+	s.sessionRepo.Update(session)
+}
+
+// enforceMaintenance moves or disconnects the sessions left on servers whose
+// maintenance deadline has passed.
+func (s *VPNService) enforceMaintenance() {
+	servers, _ := s.serverService.ListServers(domain.ServerFilter{})
+	now := time.Now().Unix()
+
+	for _, server := range servers {
+		if server.State != domain.ServerMaintenance || server.Maintenance == nil || now < server.Maintenance.Deadline {
+			continue
+		}
+
+		s.mu.RLock()
+		sessions := s.sessionRepo.ListActive(server.Code)
+		s.mu.RUnlock()
+
+		for _, session := range sessions {
+			if server.Maintenance.Action == domain.MaintenanceMigrate {
+				reason := fmt.Sprintf("moved from %s for maintenance", server.Code)
+				_, err := s.migrate(session, reason, true)
+				if err == nil {
+					continue
+				}
+				logging.Warnf("Failed to migrate session %s off %s, disconnecting: %v", session.SessionID, server.Code, err)
+			}
+
+			if err := s.disconnect(session); err != nil {
+				logging.Errorf("Failed to disconnect session %s from %s: %v", session.SessionID, server.Code, err)
+			}
+		}
+	}
+}
+
+// migrate opens a replacement session on the best available server and
+// closes the old one. The new session carries the config the client needs
+// to switch tunnels. Without release the old peer is kept until its server
+// can be reached again. A session that ends while its replacement is
+// opened is not moved.
+func (s *VPNService) migrate(session *domain.Session, reason string, release bool) (*domain.Session, error) {
+	server, _, err := s.serverService.Select(domain.StrategyAuto, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The client keeps its owner token across the move
+	replacement, err := s.openSession(server, &domain.Selection{Strategy: domain.StrategyAuto, Reason: reason}, session.Request, session.TokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if !session.Connected || s.closing[session.SessionID] {
+		s.mu.Unlock()
+		if err := s.disconnect(replacement); err != nil {
+			logging.Warnf("Failed to close replacement %s of ended session %s: %v", replacement.SessionID, session.SessionID, err)
+		}
+		return nil, domain.ErrNotConnected
+	}
+	replacement.MigratedFrom = session.SessionID
+	s.sessionRepo.Update(replacement)
+	session.ReplacedBy = replacement.SessionID
+
+	var from *domain.Server
+	var pool *IPPool
+	if release {
+		if from, pool, err = s.beginClose(session); err != nil {
+			logging.Warnf("Failed to release migrated session %s: %v", session.SessionID, err)
+		}
+	}
+	if from == nil {
+		s.deferRelease(session)
+	}
+	s.mu.Unlock()
+
+	if from != nil {
+		if err := s.finishClose(session, from, pool); err != nil {
+			logging.Warnf("Failed to release migrated session %s: %v", session.SessionID, err)
+			s.mu.Lock()
+			if session.Connected && !s.closing[session.SessionID] {
+				s.deferRelease(session)
+			}
+			s.mu.Unlock()
+		}
+	}
+
+	logging.Infof("Session %s migrated to %s as %s", session.SessionID, server.Code, replacement.SessionID)
+	return replacement, nil
+}
+
+// deferRelease ends a session but keeps its peer and address allocated
+// until releaseRecovered can remove them. Callers hold s.mu.
+func (s *VPNService) deferRelease(session *domain.Session) {
+	session.Connected = false
+	session.EndTime = time.Now().Unix()
+	session.PendingRelease = true
+	session.Secrets = nil
+	s.sessionRepo.Update(session)
+}
+
+// serverNotice describes a server's lifecycle state to the sessions on it.
+func serverNotice(server *domain.Server) *domain.Notice {
+	switch server.State {
+	case domain.ServerMaintenance:
+		notice := &domain.Notice{
+			Type:    domain.NoticeMaintenance,
+			Message: fmt.Sprintf("server %s is going into maintenance", server.Code),
+		}
+		if server.Maintenance != nil {
+			notice.Deadline = server.Maintenance.Deadline
+			if server.Maintenance.Reason != "" {
+				notice.Message += ": " + server.Maintenance.Reason
+			}
+		}
+		return notice
+	case domain.ServerDraining:
+		return &domain.Notice{
+			Type:    domain.NoticeDraining,
+			Message: fmt.Sprintf("server %s is being retired", server.Code),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"p2nova-vpn/internal/domain"
+)
+
+func TestMaintenanceNoticeAndRefusal(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1), testServer("FR", 2))
+	session, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Hour).Unix()
+	if _, err := env.servers.StartMaintenance("DE", domain.MaintenanceRequest{Reason: "kernel update", Deadline: deadline}); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := env.vpn.GetStatus(session.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Notice == nil || status.Notice.Type != domain.NoticeMaintenance || status.Notice.Deadline != deadline ||
+		status.Notice.Message != "server DE is going into maintenance: kernel update" {
+		t.Errorf("notice = %+v", status.Notice)
+	}
+
+	if _, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil); err != domain.ErrServerMaintenance {
+		t.Errorf("connect during maintenance: got %v, want ErrServerMaintenance", err)
+	}
+	for i := 0; i < 3; i++ {
+		server, _, err := env.servers.Select(domain.StrategyAuto, nil)
+		if err != nil || server.Code != "FR" {
+			t.Fatalf("auto selection got %v, %v; want FR", server, err)
+		}
+	}
+
+	// Nothing happens before the deadline
+	env.vpn.enforceMaintenance()
+	if !env.sessions.Get(session.SessionID).Connected {
+		t.Error("session ended before the maintenance deadline")
+	}
+
+	if _, err := env.servers.EndMaintenance("DE"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil); err != nil {
+		t.Errorf("connect after maintenance: %v", err)
+	}
+}
+
+func TestMaintenanceDeadlineMigrates(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1), testServer("FR", 2))
+	session, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Now().Add(-time.Second).Unix()
+	if _, err := env.servers.StartMaintenance("DE", domain.MaintenanceRequest{Deadline: past}); err != nil {
+		t.Fatal(err)
+	}
+	env.vpn.enforceMaintenance()
+
+	old := env.sessions.Get(session.SessionID)
+	if old.Connected || old.ReplacedBy == "" || old.PendingRelease {
+		t.Fatalf("old session = %+v, want it replaced and released", old)
+	}
+	if peers := env.peers(t, "DE"); len(peers) != 0 {
+		t.Errorf("DE kept %d peers after migration", len(peers))
+	}
+
+	replacement := env.sessions.Get(old.ReplacedBy)
+	if replacement == nil || !replacement.Connected || replacement.ServerCode != "FR" || replacement.MigratedFrom != session.SessionID {
+		t.Fatalf("replacement = %+v", replacement)
+	}
+
+	status, err := env.vpn.GetStatus(replacement.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Config == "" || status.Notice == nil || status.Notice.Type != domain.NoticeMigrated {
+		t.Errorf("replacement status carries no new config: %+v", status)
+	}
+
+	status, err = env.vpn.GetStatus(session.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Connected || status.Notice == nil || status.Notice.SessionID != replacement.SessionID {
+		t.Errorf("old status does not point at the replacement: %+v", status)
+	}
+}
+
+func TestMaintenanceDeadlineDisconnects(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1), testServer("FR", 2))
+	session, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := domain.MaintenanceRequest{Deadline: time.Now().Add(-time.Second).Unix(), Action: domain.MaintenanceDisconnect}
+	if _, err := env.servers.StartMaintenance("DE", req); err != nil {
+		t.Fatal(err)
+	}
+	env.vpn.enforceMaintenance()
+
+	old := env.sessions.Get(session.SessionID)
+	if old.Connected || old.ReplacedBy != "" {
+		t.Errorf("session = %+v, want it disconnected without a replacement", old)
+	}
+	if n := env.sessions.CountActive("FR"); n != 0 {
+		t.Errorf("%d sessions were opened on FR", n)
+	}
+}
+
+func TestStartMaintenanceValidation(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+
+	for _, req := range []domain.MaintenanceRequest{
+		{Action: "reboot"},
+		{Minutes: -5},
+	} {
+		if _, err := env.servers.StartMaintenance("DE", req); err == nil {
+			t.Errorf("%+v was accepted", req)
+		}
+	}
+	if _, err := env.servers.StartMaintenance("XX", domain.MaintenanceRequest{}); err != domain.ErrServerNotFound {
+		t.Errorf("unknown server: got %v", err)
+	}
+
+	server, err := env.servers.StartMaintenance("DE", domain.MaintenanceRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Now().Add(30 * time.Minute).Unix()
+	if server.Maintenance.Action != domain.MaintenanceMigrate || server.Maintenance.Deadline < want-5 || server.Maintenance.Deadline > want+5 {
+		t.Errorf("defaults = %+v, want migrate in 30 minutes", server.Maintenance)
+	}
+}
+
+func TestFailoverReleasesOnceAfterRecovery(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1), testServer("FR", 2))
+	session, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.servers.SetHealth("DE", domain.HealthDown, "test", 0)
+	env.vpn.failover()
+
+	old := env.sessions.Get(session.SessionID)
+	if old.Connected || !old.PendingRelease || old.ReplacedBy == "" {
+		t.Fatalf("old session = %+v, want it replaced and pending release", old)
+	}
+	if replacement := env.sessions.Get(old.ReplacedBy); replacement == nil || replacement.ServerCode != "FR" {
+		t.Fatalf("replacement = %+v, want a session on FR", replacement)
+	}
+	if n := len(env.peers(t, "DE")); n != 1 {
+		t.Fatalf("DE has %d peers, want the failed-over one kept", n)
+	}
+
+	// The client disconnecting the old session must not free its address early
+	if err := env.vpn.Disconnect(session.SessionID); err != domain.ErrNotConnected {
+		t.Errorf("disconnect of a failed-over session: got %v, want ErrNotConnected", err)
+	}
+	if !env.sessions.Get(session.SessionID).PendingRelease || !env.allocated(t, "DE", session.ClientIP) {
+		t.Fatal("disconnect released the failed-over session")
+	}
+
+	// Still down: nothing is released
+	env.vpn.releaseRecovered()
+	if n := len(env.peers(t, "DE")); n != 1 {
+		t.Fatalf("peer released while DE is down")
+	}
+
+	env.servers.SetHealth("DE", domain.HealthHealthy, "", time.Millisecond)
+	env.vpn.releaseRecovered()
+	env.vpn.releaseRecovered()
+	if old := env.sessions.Get(session.SessionID); old.PendingRelease {
+		t.Error("release still pending after recovery")
+	}
+	if n := len(env.peers(t, "DE")); n != 0 {
+		t.Errorf("DE kept %d peers after recovery", n)
+	}
+
+	if env.allocated(t, "DE", session.ClientIP) {
+		t.Errorf("%s still allocated after recovery", session.ClientIP)
+	}
+}
+
+func TestDisconnectTwice(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+	session, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.vpn.Disconnect(session.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.vpn.Disconnect(session.SessionID); err != domain.ErrNotConnected {
+		t.Errorf("second disconnect: got %v, want ErrNotConnected", err)
+	}
+}
+
+func TestLifecycleRacesHandlers(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1), testServer("FR", 2))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				session, _, err := env.vpn.Connect(domain.StrategyAuto, domain.TunnelRequest{}, nil)
+				if err != nil {
+					continue
+				}
+				env.vpn.GetStatus(session.SessionID)
+				env.vpn.Disconnect(session.SessionID)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			env.vpn.failover()
+			env.vpn.releaseRecovered()
+			env.vpn.Reencrypt()
+		}
+	}()
+	env.servers.SetHealth("DE", domain.HealthDown, "test", 0)
+
+	done := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		close(done)
+	}()
+	<-done
+	wg.Wait()
+}
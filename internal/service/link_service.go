@@ -0,0 +1,168 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"p2nova-vpn/internal/config"
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/internal/logging"
+	"p2nova-vpn/internal/repository"
+)
+
+// LinkService issues and redeems one-time config download links. A link is
+// a token carrying the session, format and expiry, sealed with AES-GCM
+// under a key derived from LINK_SECRET, so it reveals nothing to its holder
+// and nothing is stored until it is used.
+type LinkService struct {
+	aead       cipher.AEAD
+	ttl        time.Duration
+	linkRepo   *repository.LinkRepository
+	vpnService *VPNService
+}
+
+func NewLinkService(linkRepo *repository.LinkRepository, vpnService *VPNService, cfg *config.Config) (*LinkService, error) {
+	secret := []byte(cfg.LinkSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, sha256.Size)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	key := sha256.Sum256(secret)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LinkService{
+		aead:       aead,
+		ttl:        cfg.LinkTTL,
+		linkRepo:   linkRepo,
+		vpnService: vpnService,
+	}, nil
+}
+
+// CreateLink issues a link to a connected session's config.
+func (s *LinkService) CreateLink(sessionID string, req domain.LinkRequest) (string, *domain.ConfigLink, error) {
+	if _, err := s.vpnService.GetSession(sessionID); err != nil {
+		return "", nil, err
+	}
+
+	if req.Format == "" {
+		req.Format = domain.ConfigFormatINI
+	}
+	if !domain.IsConfigFormat(req.Format) {
+		return "", nil, fmt.Errorf("%w: unknown format %q", domain.ErrInvalidRequest, req.Format)
+	}
+
+	ttl := s.ttl
+	if req.ExpiresIn != 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Minute
+		if ttl <= 0 || ttl > domain.MaxLinkTTL {
+			return "", nil, fmt.Errorf("%w: expiresIn must be 1 to %d minutes", domain.ErrInvalidRequest, int(domain.MaxLinkTTL.Minutes()))
+		}
+	}
+
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+
+	link := &domain.ConfigLink{
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		SessionID: sessionID,
+		Format:    req.Format,
+		Platform:  strings.ToLower(req.Platform),
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	}
+
+	payload, err := json.Marshal(link)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(payload)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(s.aead.Seal(nonce, nonce, payload, nil))
+	return token, link, nil
+}
+
+// Open checks a link without using it up. It fails once the link has
+// expired or been used, and once its session has ended; refused attempts
+// are logged.
+func (s *LinkService) Open(token string, client *domain.Client) (*domain.ConfigLink, error) {
+	link, err := s.open(token)
+	if err != nil {
+		logging.Warnf("Config link refused for %s: %v", client.IP, err)
+		return nil, err
+	}
+	return link, nil
+}
+
+// Redeem uses up a link whose config has been rendered, and records the
+// redemption. It fails when another request used the link first.
+func (s *LinkService) Redeem(link *domain.ConfigLink, client *domain.Client) error {
+	if !s.linkRepo.MarkUsed(link.ID, link.ExpiresAt) {
+		logging.Warnf("Config link refused for %s: %v", client.IP, domain.ErrLinkUsed)
+		return domain.ErrLinkUsed
+	}
+
+	redemption := &domain.LinkRedemption{
+		LinkID:    link.ID,
+		SessionID: link.SessionID,
+		Format:    link.Format,
+		IP:        client.IP,
+		Country:   client.Country,
+		Time:      time.Now().Unix(),
+	}
+	s.linkRepo.Record(redemption)
+	logging.Infof("Config link %s redeemed: session %s, format %s, client %s %s", link.ID, link.SessionID, link.Format, redemption.IP, redemption.Country)
+
+	return nil
+}
+
+func (s *LinkService) open(token string) (*domain.ConfigLink, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return nil, domain.ErrLinkInvalid
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	payload, err := s.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, domain.ErrLinkInvalid
+	}
+
+	var link domain.ConfigLink
+	if err := json.Unmarshal(payload, &link); err != nil {
+		return nil, domain.ErrLinkInvalid
+	}
+	if time.Now().Unix() > link.ExpiresAt {
+		return nil, domain.ErrLinkExpired
+	}
+	if _, err := s.vpnService.GetSession(link.SessionID); err != nil {
+		return nil, err
+	}
+	if s.linkRepo.Used(link.ID) {
+		return nil, domain.ErrLinkUsed
+	}
+	return &link, nil
+}
+
+// Redemptions returns the audit trail of a session's links, or of all links
+// for an empty sessionID.
+func (s *LinkService) Redemptions(sessionID string) []*domain.LinkRedemption {
+	return s.linkRepo.ListRedemptions(sessionID)
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/internal/repository"
+)
+
+func newTestLinks(t *testing.T, env *testEnv) *LinkService {
+	t.Helper()
+	links, err := NewLinkService(repository.NewLinkRepository(), env.vpn, env.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return links
+}
+
+func TestLinkTokenIsOpaque(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+	links := newTestLinks(t, env)
+	session, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, link, err := links.CreateLink(session.SessionID, domain.LinkRequest{Format: domain.ConfigFormatPNG, Platform: "iOS"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.SessionID != session.SessionID || link.Format != domain.ConfigFormatPNG || link.Platform != "ios" {
+		t.Errorf("link = %+v", link)
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		t.Fatalf("token is not URL-safe base64: %v", err)
+	}
+	for _, leak := range []string{session.SessionID, link.ID, `"sid"`, "png"} {
+		if strings.Contains(token, leak) || strings.Contains(string(raw), leak) {
+			t.Errorf("token reveals %q", leak)
+		}
+	}
+
+	other, _, _ := links.CreateLink(session.SessionID, domain.LinkRequest{})
+	if other == token {
+		t.Error("two links share a token")
+	}
+}
+
+func TestLinkRedeemOnce(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+	links := newTestLinks(t, env)
+	session, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := links.CreateLink(session.SessionID, domain.LinkRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &domain.Client{IP: "198.51.100.7", Country: "DE"}
+
+	// Opening does not use the link up
+	for i := 0; i < 2; i++ {
+		link, err := links.Open(token, client)
+		if err != nil || link.SessionID != session.SessionID || link.Format != domain.ConfigFormatINI {
+			t.Fatalf("open %d: %+v, %v", i, link, err)
+		}
+	}
+	if n := len(links.Redemptions("")); n != 0 {
+		t.Errorf("%d redemptions recorded before use", n)
+	}
+
+	link, _ := links.Open(token, client)
+	if err := links.Redeem(link, client); err != nil {
+		t.Fatal(err)
+	}
+	if err := links.Redeem(link, client); err != domain.ErrLinkUsed {
+		t.Errorf("second redeem: got %v, want ErrLinkUsed", err)
+	}
+	if _, err := links.Open(token, client); err != domain.ErrLinkUsed {
+		t.Errorf("open after use: got %v, want ErrLinkUsed", err)
+	}
+
+	redemptions := links.Redemptions(session.SessionID)
+	if len(redemptions) != 1 || redemptions[0].LinkID != link.ID || redemptions[0].IP != client.IP || redemptions[0].Country != "DE" {
+		t.Errorf("redemptions = %+v", redemptions)
+	}
+	if n := len(links.Redemptions("other")); n != 0 {
+		t.Errorf("%d redemptions for another session", n)
+	}
+}
+
+func TestLinkRefused(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+	links := newTestLinks(t, env)
+	session, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &domain.Client{IP: "198.51.100.7"}
+
+	token, _, err := links.CreateLink(session.SessionID, domain.LinkRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := base64.RawURLEncoding.DecodeString(token)
+	raw[len(raw)-1] ^= 1
+	for _, bad := range []string{"", "not-a-link", token[:20], base64.RawURLEncoding.EncodeToString(raw), token + "."} {
+		if _, err := links.Open(bad, client); err != domain.ErrLinkInvalid {
+			t.Errorf("%q: got %v, want ErrLinkInvalid", bad, err)
+		}
+	}
+
+	// Another process's links do not open
+	if _, err := newTestLinks(t, env).Open(token, client); err != domain.ErrLinkInvalid {
+		t.Errorf("link of another key: got %v", err)
+	}
+
+	links.ttl = -time.Second
+	expired, _, err := links.CreateLink(session.SessionID, domain.LinkRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := links.Open(expired, client); err != domain.ErrLinkExpired {
+		t.Errorf("expired link: got %v, want ErrLinkExpired", err)
+	}
+
+	if err := env.vpn.Disconnect(session.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := links.Open(token, client); err == nil {
+		t.Error("link to an ended session opened")
+	}
+	if _, _, err := links.CreateLink(session.SessionID, domain.LinkRequest{}); err == nil {
+		t.Error("link created for an ended session")
+	}
+}
+
+func TestLinkExpiresIn(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+	env.cfg.LinkTTL = 15 * time.Minute
+	links := newTestLinks(t, env)
+	session, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for expiresIn, want := range map[int]time.Duration{0: 15 * time.Minute, 1: time.Minute, 60: time.Hour, 1440: 24 * time.Hour} {
+		_, link, err := links.CreateLink(session.SessionID, domain.LinkRequest{ExpiresIn: expiresIn})
+		if err != nil {
+			t.Fatalf("expiresIn %d: %v", expiresIn, err)
+		}
+		if got := time.Until(time.Unix(link.ExpiresAt, 0)); got < want-5*time.Second || got > want+5*time.Second {
+			t.Errorf("expiresIn %d: link lasts %s, want %s", expiresIn, got, want)
+		}
+	}
+
+	for _, req := range []domain.LinkRequest{{ExpiresIn: -1}, {ExpiresIn: 1441}, {Format: "pdf"}} {
+		if _, _, err := links.CreateLink(session.SessionID, req); err == nil || !strings.Contains(err.Error(), "invalid") {
+			t.Errorf("%+v: got %v", req, err)
+		}
+	}
+	if _, _, err := links.CreateLink("missing", domain.LinkRequest{}); err != domain.ErrSessionNotFound {
+		t.Errorf("unknown session: got %v", err)
+	}
+}
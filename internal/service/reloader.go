@@ -0,0 +1,172 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"p2nova-vpn/internal/config"
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/internal/logging"
+)
+
+// Reloader re-reads the configuration and applies the changes that are safe
+// while tunnels are up: DNS servers, CORS origins, plans, config templates,
+// encryption keys, the log level and new servers. Sessions and WireGuard
+// peers are never touched.
+type Reloader struct {
+	mu            sync.Mutex
+	opts          *config.Options
+	current       *config.Config
+	live          *config.Live
+	serverService *ServerService
+}
+
+func NewReloader(opts *config.Options, cfg *config.Config, serverService *ServerService) *Reloader {
+	logging.SetLevel(cfg.LogLevel)
+	return &Reloader{
+		opts:          opts,
+		current:       cfg,
+		live:          cfg.Live,
+		serverService: serverService,
+	}
+}
+
+// restartOnly lists the settings that are read once at startup.
+var restartOnly = []struct {
+	name  string
+	value func(*config.Config) interface{}
+}{
+	{"PORT", func(c *config.Config) interface{} { return c.Port }},
+	{"ADMIN_TOKEN", func(c *config.Config) interface{} { return c.AdminToken }},
+	{"SERVER_STORE_FILE", func(c *config.Config) interface{} { return c.ServerStoreFile }},
+	{"TRUSTED_PROXIES", func(c *config.Config) interface{} { return c.TrustedProxies }},
+	{"TRUSTED_PROXY_HEADER", func(c *config.Config) interface{} { return c.ForwardedHeader }},
+	{"LINK_SECRET", func(c *config.Config) interface{} { return c.LinkSecret }},
+	{"LINK_TTL", func(c *config.Config) interface{} { return c.LinkTTL }},
+	{"HEALTH_CHECK_INTERVAL", func(c *config.Config) interface{} { return c.HealthCheckInterval }},
+	{"WG_INTERFACE", func(c *config.Config) interface{} { return c.WGInterface }},
+	{"WG_PORT", func(c *config.Config) interface{} { return c.WGPort }},
+	{"VPN_SUBNET", func(c *config.Config) interface{} { return c.VPNSubnet }},
+	{"AGENT_CA_FILE", func(c *config.Config) interface{} { return c.AgentCAFile }},
+	{"AGENT_CERT_FILE", func(c *config.Config) interface{} { return c.AgentCertFile }},
+	{"AGENT_KEY_FILE", func(c *config.Config) interface{} { return c.AgentKeyFile }},
+	{"GEO_PROVIDERS", func(c *config.Config) interface{} { return c.GeoProviders }},
+	{"GEO_TIMEOUT", func(c *config.Config) interface{} { return c.GeoTimeout }},
+	{"GEO_CACHE_SIZE", func(c *config.Config) interface{} { return c.GeoCacheSize }},
+	{"GEO_CACHE_TTL", func(c *config.Config) interface{} { return c.GeoCacheTTL }},
+	{"GEO_NEGATIVE_TTL", func(c *config.Config) interface{} { return c.GeoNegativeTTL }},
+	{"GEO_STATIC_FILE", func(c *config.Config) interface{} { return c.GeoStaticFile }},
+	{"GEOIP_DB", func(c *config.Config) interface{} { return c.GeoIPFile }},
+	{"GEOIP_ASN_DB", func(c *config.Config) interface{} { return c.GeoIPASNFile }},
+	{"GEOIP_RELOAD_INTERVAL", func(c *config.Config) interface{} { return c.GeoIPReloadInterval }},
+	{"IPINFO_URL", func(c *config.Config) interface{} { return c.IPInfoURL }},
+	{"IPINFO_TOKEN", func(c *config.Config) interface{} { return c.IPInfoToken }},
+}
+
+// Reload loads the configuration again and applies it. Nothing is applied
+// unless every change can be; otherwise the returned error wraps
+// domain.ErrRestartRequired and names each offending setting. It returns a
+// description of each change made.
+func (r *Reloader) Reload() ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := config.Reload(r.opts, r.current)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidRequest, err)
+	}
+	// The running server keeps its geo database; the one just opened to
+	// validate the new configuration is not needed.
+	if next.GeoDB != nil {
+		next.GeoDB.Close()
+	}
+
+	added, err := r.check(next)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []string
+	if next.DNSServers != r.current.DNSServers {
+		changes = append(changes, fmt.Sprintf("DNS servers: %s -> %s", r.current.DNSServers, next.DNSServers))
+	}
+	if !reflect.DeepEqual(next.CORSOrigins, r.current.CORSOrigins) {
+		changes = append(changes, fmt.Sprintf("CORS origins: %v -> %v", r.current.CORSOrigins, next.CORSOrigins))
+	}
+	if !reflect.DeepEqual(next.Plans, r.current.Plans) {
+		changes = append(changes, fmt.Sprintf("plans: %d defined", len(next.Plans)))
+	}
+	if next.DefaultPlan != r.current.DefaultPlan {
+		changes = append(changes, fmt.Sprintf("default plan: %q -> %q", r.current.DefaultPlan, next.DefaultPlan))
+	}
+	if next.LogLevel != r.current.LogLevel {
+		changes = append(changes, fmt.Sprintf("log level: %s -> %s", r.current.LogLevel, next.LogLevel))
+	}
+
+	// Adding servers is the only step that can fail, so it goes first and
+	// a failure leaves the running configuration untouched
+	codes, existing, err := r.serverService.AddConfigured(added)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		changes = append(changes, fmt.Sprintf("server %s: added", code))
+	}
+	for _, code := range existing {
+		changes = append(changes, fmt.Sprintf("server %s: already registered, left unchanged", code))
+	}
+
+	before := r.live.Keyring()
+	r.live.Apply(next)
+	if after := r.live.Keyring(); after.Current() != before.Current() || !reflect.DeepEqual(after.Versions(), before.Versions()) {
+		changes = append(changes, fmt.Sprintf("encryption keys: version %d of %v -> version %d of %v", before.Current(), before.Versions(), after.Current(), after.Versions()))
+	}
+	logging.SetLevel(next.LogLevel)
+
+	next.Live = r.live
+	r.current = next
+
+	for _, change := range changes {
+		logging.Infof("Config reload: %s", change)
+	}
+	return changes, nil
+}
+
+// check reports every setting in next that cannot be applied live, and
+// returns the servers that are new.
+func (r *Reloader) check(next *config.Config) ([]config.ServerConfig, error) {
+	var errs []error
+	for _, setting := range restartOnly {
+		if !reflect.DeepEqual(setting.value(r.current), setting.value(next)) {
+			errs = append(errs, fmt.Errorf("%w: %s changed", domain.ErrRestartRequired, setting.name))
+		}
+	}
+
+	// Existing servers are managed through the admin API once running;
+	// the configuration may only add new ones.
+	known := make(map[string]config.ServerConfig)
+	for _, srv := range next.Servers {
+		known[srv.Code] = srv
+	}
+	for _, old := range r.current.Servers {
+		srv, ok := known[old.Code]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("%w: server %s removed, delete it with DELETE /api/v1/servers/%s", domain.ErrRestartRequired, old.Code, old.Code))
+		case !reflect.DeepEqual(old, srv):
+			errs = append(errs, fmt.Errorf("%w: server %s changed, update it with PUT /api/v1/servers/%s", domain.ErrRestartRequired, old.Code, old.Code))
+		}
+		delete(known, old.Code)
+	}
+
+	var added []config.ServerConfig
+	for _, srv := range next.Servers {
+		if _, ok := known[srv.Code]; ok {
+			added = append(added, srv)
+		}
+	}
+
+	return added, errors.Join(errs...)
+}
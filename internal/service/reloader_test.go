@@ -0,0 +1,175 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"p2nova-vpn/internal/config"
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/internal/logging"
+	"p2nova-vpn/internal/repository"
+)
+
+// writeFleet replaces the fleet file of a test environment.
+func writeFleet(t *testing.T, servers ...config.ServerConfig) {
+	t.Helper()
+	data, err := json.Marshal(map[string]interface{}{"servers": servers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(os.Getenv("FLEET_FILE"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadAppliesLiveSettings(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+	reloader := NewReloader(nil, env.cfg, env.servers)
+	t.Cleanup(func() { logging.SetLevel(logging.Info) })
+
+	t.Setenv("DNS_SERVERS", "9.9.9.9")
+	t.Setenv("LOG_LEVEL", "debug")
+	writeFleet(t, testServer("DE", 1), testServer("FR", 2))
+
+	changes, err := reloader.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(changes, "; "); !strings.Contains(got, "DNS servers") ||
+		!strings.Contains(got, "log level: info -> debug") || !strings.Contains(got, "server FR: added") {
+		t.Errorf("changes = %s", got)
+	}
+	if env.cfg.Live.DNSServers() != "9.9.9.9" || logging.CurrentLevel() != logging.Debug {
+		t.Errorf("DNS %s, log level %s after reload", env.cfg.Live.DNSServers(), logging.CurrentLevel())
+	}
+	if _, err := env.servers.GetServer("FR"); err != nil {
+		t.Errorf("FR not registered: %v", err)
+	}
+}
+
+func TestReloadRejectsRestartOnlyChanges(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+	reloader := NewReloader(nil, env.cfg, env.servers)
+
+	t.Setenv("DNS_SERVERS", "9.9.9.9")
+	t.Setenv("PORT", "9999")
+	changed := testServer("DE", 1)
+	changed.Port = 51000
+	writeFleet(t, changed)
+
+	_, err := reloader.Reload()
+	if !errors.Is(err, domain.ErrRestartRequired) || !strings.Contains(err.Error(), "PORT changed") ||
+		!strings.Contains(err.Error(), "server DE changed, update it with PUT /api/v1/servers/DE") {
+		t.Errorf("got %v", err)
+	}
+	if env.cfg.Live.DNSServers() == "9.9.9.9" {
+		t.Error("DNS servers applied despite the rejected reload")
+	}
+}
+
+func TestReloadRejectsProxyChanges(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+	reloader := NewReloader(nil, env.cfg, env.servers)
+
+	for key, value := range map[string]string{
+		"TRUSTED_PROXIES":      "10.0.0.0/8",
+		"TRUSTED_PROXY_HEADER": "Forwarded",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := reloader.Reload(); !errors.Is(err, domain.ErrRestartRequired) || !strings.Contains(err.Error(), key+" changed") {
+				t.Errorf("got %v", err)
+			}
+		})
+	}
+}
+
+func TestReloadIsAllOrNothing(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+	store := filepath.Join(t.TempDir(), "store")
+	if err := os.Mkdir(store, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := repository.NewFileServerRepository(filepath.Join(store, "servers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers, err := NewServerService(repo, env.sessions, env.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader := NewReloader(nil, env.cfg, servers)
+	t.Cleanup(func() { logging.SetLevel(logging.Info) })
+
+	// The store can no longer be written, so new servers cannot be added
+	if err := os.RemoveAll(store); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DNS_SERVERS", "9.9.9.9")
+	t.Setenv("LOG_LEVEL", "debug")
+	writeFleet(t, testServer("DE", 1), testServer("FR", 2), testServer("NL", 3))
+
+	if _, err := reloader.Reload(); err == nil {
+		t.Fatal("reload succeeded without a server store")
+	}
+	if env.cfg.Live.DNSServers() == "9.9.9.9" || logging.CurrentLevel() != logging.Info {
+		t.Error("live settings applied by a failed reload")
+	}
+	if list, _ := servers.ListServers(domain.ServerFilter{}); len(list) != 1 {
+		t.Errorf("%d servers registered after a failed reload, want 1", len(list))
+	}
+}
+
+func TestReloadKeepsSingleServerLocation(t *testing.T) {
+	overrides := filepath.Join(t.TempDir(), "geo.json")
+	writeOverrides := func(country string) {
+		data := `{"192.0.2.1": {"ip": "192.0.2.1", "country": "` + country + `", "city": "Somewhere"}}`
+		if err := os.WriteFile(overrides, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeOverrides("KE")
+	t.Setenv("SERVER_PUBLIC_KEY", testKey(1))
+	t.Setenv("SERVER_ENDPOINT", "192.0.2.1")
+	t.Setenv("GEO_PROVIDERS", "static")
+	t.Setenv("GEO_STATIC_FILE", overrides)
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Servers[0].Code != "KE" {
+		t.Fatalf("single server code = %s, want KE", cfg.Servers[0].Code)
+	}
+	servers, err := NewServerService(repository.NewServerRepository(), repository.NewSessionRepository(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader := NewReloader(nil, cfg, servers)
+
+	// The provider now places the address elsewhere; the server stays KE
+	writeOverrides("DE")
+
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	_, err = reloader.Reload()
+	os.Stdout = stdout
+	w.Close()
+	printed, _ := io.ReadAll(r)
+
+	if err != nil {
+		t.Errorf("reload: %v", err)
+	}
+	if len(printed) != 0 {
+		t.Errorf("reload printed:\n%s", printed)
+	}
+}
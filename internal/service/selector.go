@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/internal/geo"
+	"p2nova-vpn/pkg/country"
+)
+
+// candidate is a server considered for selection along with the inputs the
+// strategies score it on.
+type candidate struct {
+	server   *domain.Server
+	active   int
+	load     float64 // active peers / capacity
+	distance float64 // km to the client, -1 when unknown
+}
+
+// Select picks a server for the given strategy. Down servers and servers at
+// capacity are never picked; degraded servers only when nothing better is
+// available.
+func (s *ServerService) Select(strategy string, client *domain.Client) (*domain.Server, *domain.Selection, error) {
+	if strategy == domain.StrategyNearest || strategy == domain.StrategyAuto {
+		s.locateClient(client)
+	}
+
+	candidates := s.candidates(client)
+	if len(candidates) == 0 {
+		return nil, nil, domain.ErrNoServerAvailable
+	}
+
+	var best candidate
+	var reason string
+
+	switch strategy {
+	case domain.StrategyFastest:
+		best = pick(candidates, func(c candidate) float64 {
+			if c.server.LatencyMs == 0 {
+				return math.MaxFloat64
+			}
+			return float64(c.server.LatencyMs)
+		})
+		if best.server.LatencyMs == 0 {
+			reason = "no latency measurements yet, picked first available server"
+		} else {
+			reason = fmt.Sprintf("lowest latency from the API server (%d ms)", best.server.LatencyMs)
+		}
+
+	case domain.StrategyLeastLoaded:
+		best = pick(candidates, func(c candidate) float64 { return c.load })
+		reason = fmt.Sprintf("lowest load (%d/%d peers)", best.active, best.server.Capacity)
+
+	case domain.StrategyNearest:
+		if !client.Located() {
+			best = pick(candidates, func(c candidate) float64 { return c.load })
+			reason = "client location unknown, picked least-loaded server"
+			break
+		}
+		best = pick(candidates, func(c candidate) float64 {
+			if c.distance >= 0 {
+				return c.distance
+			}
+			if c.server.Country == client.Country {
+				return 0
+			}
+			return math.MaxFloat64
+		})
+		if best.distance >= 0 {
+			reason = fmt.Sprintf("nearest to client in %s (~%.0f km)", client.Country, best.distance)
+		} else {
+			reason = fmt.Sprintf("closest match for client in %s", client.Country)
+		}
+
+	default:
+		best = pick(candidates, autoScore)
+		reason = fmt.Sprintf("best overall: %s, load %.0f%%", best.server.Health, best.load*100)
+		if best.server.LatencyMs > 0 {
+			reason += fmt.Sprintf(", %d ms", best.server.LatencyMs)
+		}
+		if best.distance >= 0 {
+			reason += fmt.Sprintf(", ~%.0f km away", best.distance)
+		}
+	}
+
+	return best.server, &domain.Selection{Strategy: strategy, Reason: reason}, nil
+}
+
+func (s *ServerService) candidates(client *domain.Client) []candidate {
+	var healthy, degraded []candidate
+
+	for _, server := range s.serverRepo.List() {
+		if server.Health == domain.HealthDown || !server.AcceptsConnections() {
+			continue
+		}
+
+		c := candidate{server: server, distance: -1}
+		c.active = s.sessionRepo.CountActive(server.Code)
+		if server.Capacity > 0 {
+			if c.active >= server.Capacity {
+				continue
+			}
+			c.load = float64(c.active) / float64(server.Capacity)
+		}
+
+		if client.Located() && (client.Latitude != 0 || client.Longitude != 0) &&
+			(server.Latitude != 0 || server.Longitude != 0) {
+			c.distance = haversine(client.Latitude, client.Longitude, server.Latitude, server.Longitude)
+		}
+
+		if server.Health == domain.HealthDegraded {
+			degraded = append(degraded, c)
+		} else {
+			healthy = append(healthy, c)
+		}
+	}
+
+	if len(healthy) > 0 {
+		return healthy
+	}
+	return degraded
+}
+
+// pick returns the candidate with the lowest score, breaking ties by server
+// code so the choice is stable.
+func pick(candidates []candidate, score func(candidate) float64) candidate {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		si, sj := score(candidates[i]), score(candidates[j])
+		if si != sj {
+			return si < sj
+		}
+		return candidates[i].server.Code < candidates[j].server.Code
+	})
+	return candidates[0]
+}
+
+// autoScore weighs load, latency and distance, each normalised to 0..1.
+// Unknown latency or distance counts as average.
+func autoScore(c candidate) float64 {
+	latency := 0.5
+	if c.server.LatencyMs > 0 {
+		latency = math.Min(float64(c.server.LatencyMs)/300, 1)
+	}
+
+	distance := 0.5
+	if c.distance >= 0 {
+		distance = math.Min(c.distance/10000, 1)
+	}
+
+	return 0.5*c.load + 0.3*latency + 0.2*distance
+}
+
+// locateClient fills in the client's location from its IP when the caller
+// did not already provide it. Private addresses cannot be located.
+func (s *ServerService) locateClient(client *domain.Client) {
+	if client == nil || client.Located() {
+		return
+	}
+
+	if !geo.Public(net.ParseIP(client.IP)) {
+		return
+	}
+
+	info, err := s.config.Geo.Lookup(context.Background(), client.IP)
+	if err != nil || info.Country == "" {
+		return
+	}
+
+	client.Country = country.Normalize(info.Country)
+	client.Region = info.Region
+	client.Latitude, client.Longitude, _ = info.Coordinates()
+}
+
+// haversine returns the great-circle distance between two points in km.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371.0
+
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return earthRadius * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/internal/geo"
+)
+
+func TestConnectKeepsOtherSessions(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+
+	first, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !env.sessions.Get(first.SessionID).Connected {
+		t.Error("a new connect ended another client's session")
+	}
+	if first.ClientIP == second.ClientIP {
+		t.Errorf("both sessions got %s", first.ClientIP)
+	}
+	if n := len(env.peers(t, "DE")); n != 2 {
+		t.Errorf("DE has %d peers, want 2", n)
+	}
+	if server, _ := env.servers.GetServer("DE"); server.ActivePeers != 2 {
+		t.Errorf("DE reports %d active peers, want 2", server.ActivePeers)
+	}
+}
+
+func TestSelectLeastLoadedSpreadsSessions(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1), testServer("FR", 2), testServer("NL", 3))
+
+	counts := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		session, _, err := env.vpn.Connect(domain.StrategyLeastLoaded, domain.TunnelRequest{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.Selection == nil || session.Selection.Strategy != domain.StrategyLeastLoaded ||
+			!strings.HasPrefix(session.Selection.Reason, "lowest load") {
+			t.Errorf("selection = %+v", session.Selection)
+		}
+		counts[session.ServerCode]++
+	}
+
+	for _, code := range []string{"DE", "FR", "NL"} {
+		if counts[code] != 2 {
+			t.Errorf("least-loaded put %d of 6 sessions on %s, want 2 each: %v", counts[code], code, counts)
+		}
+	}
+}
+
+func TestSelectFastest(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1), testServer("FR", 2))
+
+	server, selection, err := env.servers.Select(domain.StrategyFastest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Code != "DE" || !strings.HasPrefix(selection.Reason, "no latency measurements") {
+		t.Errorf("without measurements got %s: %s", server.Code, selection.Reason)
+	}
+
+	env.servers.SetHealth("DE", domain.HealthHealthy, "", 40*time.Millisecond)
+	env.servers.SetHealth("FR", domain.HealthHealthy, "", 10*time.Millisecond)
+	server, selection, err = env.servers.Select(domain.StrategyFastest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Code != "FR" || selection.Reason != "lowest latency from the API server (10 ms)" {
+		t.Errorf("got %s: %s", server.Code, selection.Reason)
+	}
+}
+
+func TestSelectNearest(t *testing.T) {
+	de := testServer("DE", 1)
+	de.Country, de.Latitude, de.Longitude = "DE", 52.52, 13.40
+	ke := testServer("KE", 2)
+	ke.Country, ke.Latitude, ke.Longitude = "KE", -1.29, 36.82
+	env := newTestEnv(t, de, ke)
+
+	client := &domain.Client{IP: "198.51.100.1", Country: "TZ", Latitude: -6.8, Longitude: 39.28}
+	server, selection, err := env.servers.Select(domain.StrategyNearest, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Code != "KE" || !strings.HasPrefix(selection.Reason, "nearest to client in TZ") {
+		t.Errorf("got %s: %s", server.Code, selection.Reason)
+	}
+
+	// Unlocated clients fall back to the least-loaded server
+	server, selection, err = env.servers.Select(domain.StrategyNearest, &domain.Client{IP: "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Code != "DE" || selection.Reason != "client location unknown, picked least-loaded server" {
+		t.Errorf("unlocated client got %s: %s", server.Code, selection.Reason)
+	}
+}
+
+func TestSelectNearestLocatesClient(t *testing.T) {
+	de := testServer("DE", 1)
+	de.Country, de.Latitude, de.Longitude = "DE", 52.52, 13.40
+	ke := testServer("KE", 2)
+	ke.Country, ke.Latitude, ke.Longitude = "KE", -1.29, 36.82
+	env := newTestEnv(t, de, ke)
+	locator, err := geo.NewStaticProvider(map[string]geo.GeoInfo{
+		"198.51.100.0/24": {Country: "tz", Region: "Dar es Salaam", Loc: "-6.8,39.28"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.cfg.Geo = locator
+
+	client := &domain.Client{IP: "198.51.100.1"}
+	server, _, err := env.servers.Select(domain.StrategyNearest, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Code != "KE" || client.Country != "TZ" || client.Region != "Dar es Salaam" || client.Latitude != -6.8 {
+		t.Errorf("got %s for client %+v", server.Code, client)
+	}
+
+	// Private addresses are not looked up
+	private := &domain.Client{IP: "10.0.0.1"}
+	if _, _, err := env.servers.Select(domain.StrategyNearest, private); err != nil || private.Located() {
+		t.Errorf("private client located: %+v, %v", private, err)
+	}
+}
+
+func TestSelectSkipsUnavailableServers(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1), testServer("FR", 2), testServer("NL", 3))
+	env.servers.SetHealth("DE", domain.HealthDown, "test", 0)
+	env.servers.SetHealth("FR", domain.HealthDegraded, "test", time.Millisecond)
+	env.servers.SetHealth("NL", domain.HealthHealthy, "", time.Millisecond)
+
+	server, _, err := env.servers.Select(domain.StrategyAuto, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Code != "NL" {
+		t.Errorf("auto picked %s, want the only healthy server NL", server.Code)
+	}
+
+	// Degraded servers are the last resort
+	env.servers.SetHealth("NL", domain.HealthDown, "test", 0)
+	if server, _, _ = env.servers.Select(domain.StrategyAuto, nil); server == nil || server.Code != "FR" {
+		t.Errorf("auto picked %v, want the degraded FR", server)
+	}
+}
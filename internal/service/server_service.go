@@ -1,34 +1,185 @@
 package service
 
 import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
 	"p2nova-vpn/internal/config"
 	"p2nova-vpn/internal/domain"
 	"p2nova-vpn/internal/repository"
+	"p2nova-vpn/pkg/country"
 )
 
 type ServerService struct {
-	serverRepo *repository.ServerRepository
-	config     *config.Config
+	serverRepo  *repository.ServerRepository
+	sessionRepo *repository.SessionRepository
+	config      *config.Config
+
+	// mu serialises read-modify-write updates. Servers handed out by the
+	// repository are shared, so every update stores a fresh copy.
+	mu sync.Mutex
 }
 
-func NewServerService(serverRepo *repository.ServerRepository, cfg *config.Config) *ServerService {
-	// Initialize servers from config
-	for _, srv := range cfg.Servers {
-		serverRepo.Store(&domain.Server{
-			Code: srv.Code,
-			Name: srv.Name,
-			IP:   srv.IP,
-		})
+func NewServerService(serverRepo *repository.ServerRepository, sessionRepo *repository.SessionRepository, cfg *config.Config) (*ServerService, error) {
+	// Initialize servers from config. A persisted registry takes precedence,
+	// the config only seeds it the first time.
+	if serverRepo.Count() == 0 {
+		for _, srv := range cfg.Servers {
+			if err := serverRepo.Store(serverFromConfig(srv)); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return &ServerService{
-		serverRepo: serverRepo,
-		config:     cfg,
+		serverRepo:  serverRepo,
+		sessionRepo: sessionRepo,
+		config:      cfg,
+	}, nil
+}
+
+// AddConfigured registers servers from configuration, all or none. It is
+// used when a reload introduces new servers; servers already in the
+// registry are left alone and returned in existing.
+func (s *ServerService) AddConfigured(servers []config.ServerConfig) (added, existing []string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, srv := range servers {
+		if s.serverRepo.Get(srv.Code) != nil {
+			existing = append(existing, srv.Code)
+			continue
+		}
+		if err := s.serverRepo.Store(serverFromConfig(srv)); err != nil {
+			// Take back the servers already stored
+			for _, code := range added {
+				s.serverRepo.Delete(code)
+			}
+			return nil, nil, fmt.Errorf("failed to add server %s: %w", srv.Code, err)
+		}
+		added = append(added, srv.Code)
+	}
+	return added, existing, nil
+}
+
+func serverFromConfig(srv config.ServerConfig) *domain.Server {
+	return &domain.Server{
+		Code:      srv.Code,
+		Name:      srv.Name,
+		IP:        srv.IP,
+		Endpoint:  srv.Endpoint,
+		Port:      srv.Port,
+		PublicKey: srv.PublicKey,
+		Subnet:    srv.Subnet,
+		Interface: srv.Interface,
+		Agent:     srv.Agent,
+		CanaryKey: srv.CanaryKey,
+		Country:   srv.Country,
+		City:      srv.City,
+		Flag:      srv.Flag,
+		Tags:      srv.Tags,
+		Features:  srv.Features,
+		Latitude:  srv.Latitude,
+		Longitude: srv.Longitude,
+		Capacity:  srv.Capacity,
+		Tunnel:    srv.Tunnel,
+		State:     domain.ServerActive,
+		Health:    domain.HealthUnknown,
 	}
 }
 
-func (s *ServerService) ListServers() ([]*domain.Server, error) {
-	return s.serverRepo.List(), nil
+// ListServers returns the servers matching filter, each with its current
+// load filled in.
+func (s *ServerService) ListServers(filter domain.ServerFilter) ([]*domain.Server, error) {
+	servers := []*domain.Server{}
+	for _, server := range s.serverRepo.List() {
+		if filter.Tag != "" && !server.HasTag(filter.Tag) {
+			continue
+		}
+		if filter.Country != "" && server.Country != country.Normalize(filter.Country) {
+			continue
+		}
+		view := s.view(server)
+		if filter.Continent != "" && view.Continent != filter.Continent {
+			continue
+		}
+		servers = append(servers, view)
+	}
+
+	sort.SliceStable(servers, func(i, j int) bool {
+		a, b := servers[i], servers[j]
+		switch filter.Sort {
+		case "load":
+			if a.Load != b.Load {
+				return a.Load < b.Load
+			}
+		case "latency":
+			if a.LatencyMs != b.LatencyMs {
+				// Unmeasured servers go last
+				return b.LatencyMs == 0 || (a.LatencyMs != 0 && a.LatencyMs < b.LatencyMs)
+			}
+		case "name":
+			if a.Name != b.Name {
+				return a.Name < b.Name
+			}
+		}
+		return a.Code < b.Code
+	})
+
+	return servers, nil
+}
+
+// GroupByContinent lists the servers matching filter grouped by continent,
+// in continent name order. Servers without a known country come last.
+func (s *ServerService) GroupByContinent(filter domain.ServerFilter) ([]*domain.ServerGroup, error) {
+	servers, err := s.ListServers(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []*domain.ServerGroup{}
+	byContinent := make(map[string]*domain.ServerGroup)
+	for _, server := range servers {
+		group, ok := byContinent[server.Continent]
+		if !ok {
+			group = &domain.ServerGroup{
+				Continent: server.Continent,
+				Name:      country.Continent(server.Continent).Name(),
+			}
+			if group.Name == "" {
+				group.Name = "Other"
+			}
+			byContinent[server.Continent] = group
+			groups = append(groups, group)
+		}
+		group.Servers = append(group.Servers, server)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if (groups[i].Continent == "") != (groups[j].Continent == "") {
+			return groups[j].Continent == ""
+		}
+		return groups[i].Name < groups[j].Name
+	})
+	return groups, nil
+}
+
+// view returns a copy of server with the derived fields filled in: its
+// active peer count, load and country details.
+func (s *ServerService) view(server *domain.Server) *domain.Server {
+	view := *server
+	view.ActivePeers = s.sessionRepo.CountActive(server.Code)
+	if view.Capacity > 0 {
+		view.Load = float64(view.ActivePeers) / float64(view.Capacity)
+	}
+	if c, ok := country.Lookup(server.Country); ok {
+		view.CountryName = c.Name
+		view.Continent = string(c.Continent)
+	}
+	return &view
 }
 
 func (s *ServerService) GetServer(code string) (*domain.Server, error) {
@@ -36,5 +187,229 @@ func (s *ServerService) GetServer(code string) (*domain.Server, error) {
 	if server == nil {
 		return nil, domain.ErrServerNotFound
 	}
+	return s.view(server), nil
+}
+
+func (s *ServerService) CreateServer(req domain.ServerRequest) (*domain.Server, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.serverRepo.Get(req.Code) != nil {
+		return nil, domain.ErrServerExists
+	}
+
+	server, err := s.buildServer(req)
+	if err != nil {
+		return nil, err
+	}
+	server.Health = domain.HealthUnknown
+	server.State = domain.ServerActive
+
+	if err := s.serverRepo.Store(server); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// UpdateServer replaces a server's registry fields. The subnet, interface
+// and agent cannot change while peers are connected, since their addresses
+// and keys live on the old node.
+func (s *ServerService) UpdateServer(code string, req domain.ServerRequest) (*domain.Server, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := s.serverRepo.Get(code)
+	if current == nil {
+		return nil, domain.ErrServerNotFound
+	}
+
+	req.Code = code
+	server, err := s.buildServer(req)
+	if err != nil {
+		return nil, err
+	}
+
+	moved := server.Subnet != current.Subnet || server.Interface != current.Interface || server.Agent != current.Agent
+	if moved && s.sessionRepo.CountActive(code) > 0 {
+		return nil, domain.ErrServerHasSessions
+	}
+
+	// Runtime state carries over
+	server.Health = current.Health
+	server.HealthDetail = current.HealthDetail
+	server.LastChecked = current.LastChecked
+	server.LatencyMs = current.LatencyMs
+	server.State = current.State
+	server.Maintenance = current.Maintenance
+
+	if err := s.serverRepo.Store(server); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+func (s *ServerService) DeleteServer(code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.serverRepo.Get(code) == nil {
+		return domain.ErrServerNotFound
+	}
+	if s.sessionRepo.CountActive(code) > 0 {
+		return domain.ErrServerHasSessions
+	}
+	return s.serverRepo.Delete(code)
+}
+
+// MarkDraining hides a server from selection and refuses new connections
+// until its last session ends, at which point it is deleted.
+func (s *ServerService) MarkDraining(code string) error {
+	return s.update(code, func(server *domain.Server) {
+		server.State = domain.ServerDraining
+	})
+}
+
+// StartMaintenance takes a server out of rotation. Sessions on it are told
+// about the deadline through their status and are moved or disconnected
+// once it passes.
+func (s *ServerService) StartMaintenance(code string, req domain.MaintenanceRequest) (*domain.Server, error) {
+	if req.Action == "" {
+		req.Action = domain.MaintenanceMigrate
+	}
+	if req.Action != domain.MaintenanceMigrate && req.Action != domain.MaintenanceDisconnect {
+		return nil, fmt.Errorf("%w: action must be %q or %q", domain.ErrInvalidRequest, domain.MaintenanceMigrate, domain.MaintenanceDisconnect)
+	}
+	if req.Minutes < 0 {
+		return nil, fmt.Errorf("%w: minutes must not be negative", domain.ErrInvalidRequest)
+	}
+
+	deadline := req.Deadline
+	if deadline == 0 {
+		if req.Minutes == 0 {
+			req.Minutes = 30
+		}
+		deadline = time.Now().Add(time.Duration(req.Minutes) * time.Minute).Unix()
+	}
+
+	maintenance := &domain.Maintenance{
+		Reason:   req.Reason,
+		Deadline: deadline,
+		Action:   req.Action,
+	}
+
+	err := s.update(code, func(server *domain.Server) {
+		server.State = domain.ServerMaintenance
+		server.Maintenance = maintenance
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetServer(code)
+}
+
+// EndMaintenance puts a server back into rotation. It also cancels a drain.
+func (s *ServerService) EndMaintenance(code string) (*domain.Server, error) {
+	err := s.update(code, func(server *domain.Server) {
+		server.State = domain.ServerActive
+		server.Maintenance = nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetServer(code)
+}
+
+// SetHealth records the outcome of a health probe.
+func (s *ServerService) SetHealth(code string, state domain.HealthState, detail string, latency time.Duration) {
+	s.update(code, func(server *domain.Server) {
+		server.Health = state
+		server.HealthDetail = detail
+		server.LastChecked = time.Now().Unix()
+		server.LatencyMs = int((latency + time.Millisecond - 1) / time.Millisecond) // round up so a measured latency is never 0
+	})
+}
+
+func (s *ServerService) update(code string, apply func(*domain.Server)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	server := s.serverRepo.Get(code)
+	if server == nil {
+		return domain.ErrServerNotFound
+	}
+
+	updated := *server
+	apply(&updated)
+	return s.serverRepo.Store(&updated)
+}
+
+// buildServer validates an admin request and fills in the same defaults as
+// the fleet file.
+func (s *ServerService) buildServer(req domain.ServerRequest) (*domain.Server, error) {
+	if req.Port == 0 {
+		req.Port = 51820
+	}
+	if errs := config.CheckServer(req.Code, req.Endpoint, req.Port, req.Subnet, req.PublicKey, req.CanaryKey); len(errs) > 0 {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidRequest, errs[0])
+	}
+	if req.Agent != "" {
+		u, err := url.Parse(req.Agent)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("%w: agent must be an https URL", domain.ErrInvalidRequest)
+		}
+		if s.config.AgentCertFile == "" {
+			return nil, fmt.Errorf("%w: agent TLS is not configured on this API server", domain.ErrInvalidRequest)
+		}
+	}
+	if req.Capacity < 0 {
+		return nil, fmt.Errorf("%w: capacity must not be negative", domain.ErrInvalidRequest)
+	}
+	if err := req.Tunnel.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: tunnel: %v", domain.ErrInvalidRequest, err)
+	}
+
+	server := &domain.Server{
+		Code:      req.Code,
+		Name:      req.Name,
+		IP:        req.IP,
+		Endpoint:  req.Endpoint,
+		Port:      req.Port,
+		PublicKey: req.PublicKey,
+		Subnet:    req.Subnet,
+		Interface: req.Interface,
+		Agent:     req.Agent,
+		CanaryKey: req.CanaryKey,
+		Country:   country.Normalize(req.Country),
+		City:      req.City,
+		Flag:      req.Flag,
+		Tags:      req.Tags,
+		Features:  req.Features,
+		Latitude:  req.Latitude,
+		Longitude: req.Longitude,
+		Capacity:  req.Capacity,
+		Tunnel:    req.Tunnel,
+	}
+
+	if server.Name == "" {
+		server.Name = server.Code
+	}
+	if server.IP == "" {
+		server.IP = server.Endpoint
+	}
+	if server.Interface == "" && server.Agent == "" {
+		server.Interface = s.config.WGInterface
+	}
+	if server.Capacity == 0 {
+		server.Capacity = config.SubnetCapacity(server.Subnet)
+	}
+	if server.Country != "" {
+		if _, ok := country.Lookup(server.Country); !ok {
+			return nil, fmt.Errorf("%w: unknown country %q", domain.ErrInvalidRequest, req.Country)
+		}
+		if server.Flag == "" {
+			server.Flag = country.Flag(server.Country)
+		}
+	}
+
 	return server, nil
 }
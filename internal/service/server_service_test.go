@@ -0,0 +1,252 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"p2nova-vpn/internal/domain"
+)
+
+func serverRequest(code string) domain.ServerRequest {
+	return domain.ServerRequest{
+		Code:      code,
+		Endpoint:  "fr.example.com",
+		PublicKey: testKey(9),
+		Subnet:    "10.20.0.0/24",
+		Country:   "FR",
+	}
+}
+
+func TestCreateServerValidation(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+
+	tests := []struct {
+		name   string
+		modify func(*domain.ServerRequest)
+		want   string
+	}{
+		{"strategy as code", func(r *domain.ServerRequest) { r.Code = domain.StrategyAuto }, "invalid server code"},
+		{"bad code", func(r *domain.ServerRequest) { r.Code = "a b" }, "invalid server code"},
+		{"bad endpoint", func(r *domain.ServerRequest) { r.Endpoint = "-bad-.example" }, "invalid endpoint"},
+		{"port", func(r *domain.ServerRequest) { r.Port = 70000 }, "port"},
+		{"missing key", func(r *domain.ServerRequest) { r.PublicKey = "" }, "publicKey is required"},
+		{"short key", func(r *domain.ServerRequest) { r.PublicKey = "c2hvcnQ=" }, "publicKey"},
+		{"zero key", func(r *domain.ServerRequest) { r.PublicKey = testKey(0) }, "publicKey"},
+		{"canary key", func(r *domain.ServerRequest) { r.CanaryKey = "nope" }, "canaryKey"},
+		{"bad subnet", func(r *domain.ServerRequest) { r.Subnet = "10.20.0.0" }, "not a CIDR"},
+		{"public subnet", func(r *domain.ServerRequest) { r.Subnet = "8.8.8.0/24" }, "not a private range"},
+		{"agent without TLS", func(r *domain.ServerRequest) { r.Agent = "https://10.0.0.5:7443" }, "agent TLS"},
+		{"unknown country", func(r *domain.ServerRequest) { r.Country = "XX" }, "unknown country"},
+	}
+	for _, tt := range tests {
+		req := serverRequest("FR")
+		tt.modify(&req)
+		_, err := env.servers.CreateServer(req)
+		if !errors.Is(err, domain.ErrInvalidRequest) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want an invalid request about %q", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := env.servers.CreateServer(serverRequest("DE")); err != domain.ErrServerExists {
+		t.Errorf("duplicate code: got %v, want ErrServerExists", err)
+	}
+}
+
+func TestCreateServerDefaults(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+
+	server, err := env.servers.CreateServer(serverRequest("FR"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Port != 51820 || server.Name != "FR" || server.IP != "fr.example.com" ||
+		server.Capacity != 253 || server.Flag != "🇫🇷" || server.State != domain.ServerActive {
+		t.Errorf("defaults not filled in: %+v", server)
+	}
+
+	if _, _, err := env.vpn.Connect("FR", domain.TunnelRequest{}, nil); err != nil {
+		t.Errorf("connect to the new server: %v", err)
+	}
+}
+
+func TestUpdateServerKeepsSubnetWhileConnected(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+	if _, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	req := serverRequest("DE")
+	req.Subnet = "10.30.0.0/24"
+	if _, err := env.servers.UpdateServer("DE", req); err != domain.ErrServerHasSessions {
+		t.Errorf("subnet change with sessions: got %v, want ErrServerHasSessions", err)
+	}
+
+	current, _ := env.servers.GetServer("DE")
+	req.Subnet = current.Subnet
+	req.Interface = current.Interface
+	req.Name = "Frankfurt"
+	updated, err := env.servers.UpdateServer("DE", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != "Frankfurt" || updated.Code != "DE" {
+		t.Errorf("update not applied: %+v", updated)
+	}
+
+	if _, err := env.servers.UpdateServer("XX", req); err != domain.ErrServerNotFound {
+		t.Errorf("unknown server: got %v, want ErrServerNotFound", err)
+	}
+}
+
+func TestRemoveServerWithSessions(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1), testServer("FR", 2))
+	for _, code := range []string{"DE", "FR"} {
+		if _, _, err := env.vpn.Connect(code, domain.TunnelRequest{}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := env.vpn.RemoveServer("DE", false, false); err != domain.ErrServerHasSessions {
+		t.Errorf("plain delete: got %v, want ErrServerHasSessions", err)
+	}
+
+	if err := env.vpn.RemoveServer("DE", true, false); err != nil {
+		t.Fatalf("forced delete: %v", err)
+	}
+	if _, err := env.servers.GetServer("DE"); err != domain.ErrServerNotFound {
+		t.Errorf("DE still exists after a forced delete")
+	}
+	if peers := env.peers(t, "DE"); len(peers) != 0 {
+		t.Errorf("forced delete left %d peers", len(peers))
+	}
+
+	if err := env.vpn.RemoveServer("FR", false, true); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	server, err := env.servers.GetServer("FR")
+	if err != nil || server.State != domain.ServerDraining {
+		t.Fatalf("FR is not draining: %+v, %v", server, err)
+	}
+	if _, _, err := env.vpn.Connect("FR", domain.TunnelRequest{}, nil); err != domain.ErrServerDraining {
+		t.Errorf("connect to a draining server: got %v, want ErrServerDraining", err)
+	}
+
+	session := env.sessions.ListActive("FR")[0]
+	if err := env.vpn.Disconnect(session.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.servers.GetServer("FR"); err != domain.ErrServerNotFound {
+		t.Error("FR was not removed after its last session ended")
+	}
+}
+
+func TestListServersMetadata(t *testing.T) {
+	de := testServer("DE", 1)
+	de.Name, de.Country, de.City = "Frankfurt", "DE", "Frankfurt"
+	de.Tags, de.Features = []string{"p2p", "streaming"}, []string{"ipv6"}
+	de.Capacity = 4
+	env := newTestEnv(t, de)
+	if _, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	servers, err := env.servers.ListServers(domain.ServerFilter{})
+	if err != nil || len(servers) != 1 {
+		t.Fatalf("got %v, %v", servers, err)
+	}
+	got := servers[0]
+	if got.Name != "Frankfurt" || got.City != "Frankfurt" || got.Flag != "🇩🇪" || got.Port != 51820 ||
+		got.PublicKey != de.PublicKey || len(got.Tags) != 2 || len(got.Features) != 1 {
+		t.Errorf("metadata not exposed: %+v", got)
+	}
+	if got.CountryName != "Germany" || got.Continent != "EU" {
+		t.Errorf("country = %q, continent = %q", got.CountryName, got.Continent)
+	}
+	if got.Capacity != 4 || got.ActivePeers != 1 || got.Load != 0.25 {
+		t.Errorf("load = %d/%d (%v), want 1/4", got.ActivePeers, got.Capacity, got.Load)
+	}
+}
+
+func TestListServersFilterAndSort(t *testing.T) {
+	de := testServer("DE", 1)
+	de.Name, de.Country, de.Tags = "Frankfurt", "DE", []string{"p2p"}
+	fr := testServer("FR", 2)
+	fr.Name, fr.Country, fr.Tags = "Paris", "FR", []string{"streaming", "P2P"}
+	ke := testServer("KE", 3)
+	ke.Name, ke.Country = "Nairobi", "KE"
+	env := newTestEnv(t, de, fr, ke)
+	for _, code := range []string{"DE", "DE", "FR"} {
+		if _, _, err := env.vpn.Connect(code, domain.TunnelRequest{}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env.servers.SetHealth("FR", domain.HealthHealthy, "", 5*time.Millisecond)
+	env.servers.SetHealth("KE", domain.HealthHealthy, "", 50*time.Millisecond)
+
+	codes := func(filter domain.ServerFilter) string {
+		servers, err := env.servers.ListServers(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, server := range servers {
+			out = append(out, server.Code)
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		filter domain.ServerFilter
+		want   string
+	}{
+		{domain.ServerFilter{}, "DE,FR,KE"},
+		{domain.ServerFilter{Tag: "p2p"}, "DE,FR"},
+		{domain.ServerFilter{Tag: "streaming"}, "FR"},
+		{domain.ServerFilter{Country: "fr"}, "FR"},
+		{domain.ServerFilter{Country: "UK"}, ""},
+		{domain.ServerFilter{Continent: "AF"}, "KE"},
+		{domain.ServerFilter{Tag: "p2p", Continent: "EU", Sort: "load"}, "FR,DE"},
+		{domain.ServerFilter{Sort: "load"}, "KE,FR,DE"},
+		{domain.ServerFilter{Sort: "latency"}, "FR,KE,DE"},
+		{domain.ServerFilter{Sort: "name"}, "DE,KE,FR"},
+	}
+	for _, tt := range tests {
+		if got := codes(tt.filter); got != tt.want {
+			t.Errorf("%+v: got %s, want %s", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestGroupByContinent(t *testing.T) {
+	de := testServer("DE", 1)
+	de.Country = "DE"
+	ke := testServer("KE", 2)
+	ke.Country = "KE"
+	gb := testServer("GB", 3)
+	gb.Country = "UK"
+	lab := testServer("LAB", 4)
+	lab.Country = "XX"
+	env := newTestEnv(t, de, ke, gb, lab)
+
+	groups, err := env.servers.GroupByContinent(domain.ServerFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, group := range groups {
+		var codes []string
+		for _, server := range group.Servers {
+			codes = append(codes, server.Code)
+		}
+		got = append(got, group.Name+":"+strings.Join(codes, ","))
+	}
+	if want := "Africa:KE Europe:DE,GB Other:LAB"; strings.Join(got, " ") != want {
+		t.Errorf("groups = %s, want %s", strings.Join(got, " "), want)
+	}
+
+	if server, _ := env.servers.GetServer("GB"); server.Country != "GB" || server.CountryName != "United Kingdom" {
+		t.Errorf("alias not resolved: %s %q", server.Country, server.CountryName)
+	}
+}
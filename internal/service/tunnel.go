@@ -0,0 +1,64 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"p2nova-vpn/internal/domain"
+)
+
+// Built-in tunnel settings, used where neither the server nor the plan sets
+// them. DNS defaults to DNS_SERVERS.
+const (
+	defaultMTU       = 1420
+	defaultKeepalive = 25
+)
+
+var defaultAllowedIPs = []string{"0.0.0.0/0", "::/0"} // full tunnel
+
+// resolveTunnel works out the tunnel settings of a client on server: the
+// built-in defaults, overlaid by the server's settings, then the plan's,
+// then the client's own overrides where the plan allows them. It also
+// returns the name of the plan applied, if any.
+func (s *VPNService) resolveTunnel(server *domain.Server, req domain.TunnelRequest) (string, domain.TunnelParams, error) {
+	keepalive := defaultKeepalive
+	params := domain.TunnelParams{
+		DNS:                 splitList(s.config.Live.DNSServers()),
+		MTU:                 defaultMTU,
+		AllowedIPs:          defaultAllowedIPs,
+		PersistentKeepalive: &keepalive,
+	}
+	params = params.Merge(server.Tunnel)
+
+	plan, ok := s.config.Live.Plan(req.Plan)
+	if !ok {
+		return "", params, fmt.Errorf("%w: %q", domain.ErrPlanNotFound, req.Plan)
+	}
+	var name string
+	if plan != nil {
+		name = plan.Name
+		params = params.Merge(plan.Tunnel)
+	}
+
+	for _, param := range req.Overrides.Set() {
+		if plan == nil || !plan.Allows(param) {
+			return "", params, fmt.Errorf("%w: %s", domain.ErrOverrideForbidden, param)
+		}
+	}
+	if err := req.Overrides.Validate(); err != nil {
+		return "", params, fmt.Errorf("%w: %v", domain.ErrInvalidRequest, err)
+	}
+
+	return name, params.Merge(req.Overrides), nil
+}
+
+// splitList splits a comma separated setting such as DNS_SERVERS.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"p2nova-vpn/internal/domain"
+)
+
+func intPtr(n int) *int { return &n }
+
+func TestTunnelParamsLayering(t *testing.T) {
+	de := testServer("DE", 1)
+	de.Tunnel = domain.TunnelParams{MTU: 1380, DNS: []string{"10.8.1.1"}}
+	env := newTestEnv(t, de, testServer("FR", 2))
+	env.cfg.DNSServers = "1.1.1.1, 9.9.9.9"
+	env.cfg.Plans = []domain.Plan{
+		{Name: "free", Tunnel: domain.TunnelParams{PersistentKeepalive: intPtr(0)}},
+		{Name: "pro", Tunnel: domain.TunnelParams{AllowedIPs: []string{"10.0.0.0/8"}}, Overrides: []string{domain.ParamMTU, domain.ParamDNS}},
+	}
+	env.cfg.DefaultPlan = "free"
+	env.cfg.Live.Apply(env.cfg)
+
+	full := []string{"0.0.0.0/0", "::/0"}
+	tests := []struct {
+		name     string
+		server   string
+		req      domain.TunnelRequest
+		wantPlan string
+		want     domain.TunnelParams
+	}{
+		{"defaults and default plan", "FR", domain.TunnelRequest{}, "free",
+			domain.TunnelParams{DNS: []string{"1.1.1.1", "9.9.9.9"}, MTU: 1420, AllowedIPs: full, PersistentKeepalive: intPtr(0)}},
+		{"server settings", "DE", domain.TunnelRequest{}, "free",
+			domain.TunnelParams{DNS: []string{"10.8.1.1"}, MTU: 1380, AllowedIPs: full, PersistentKeepalive: intPtr(0)}},
+		{"plan over server", "DE", domain.TunnelRequest{Plan: "pro"}, "pro",
+			domain.TunnelParams{DNS: []string{"10.8.1.1"}, MTU: 1380, AllowedIPs: []string{"10.0.0.0/8"}, PersistentKeepalive: intPtr(25)}},
+		{"allowed overrides", "DE", domain.TunnelRequest{Plan: "pro", Overrides: domain.TunnelParams{MTU: 1300, DNS: []string{"8.8.8.8"}}}, "pro",
+			domain.TunnelParams{DNS: []string{"8.8.8.8"}, MTU: 1300, AllowedIPs: []string{"10.0.0.0/8"}, PersistentKeepalive: intPtr(25)}},
+	}
+	for _, tt := range tests {
+		session, _, err := env.vpn.Connect(tt.server, tt.req, nil)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		// The session records what went into its config
+		stored := env.sessions.Get(session.SessionID)
+		if stored.Plan != tt.wantPlan || !reflect.DeepEqual(stored.Params, tt.want) || !reflect.DeepEqual(stored.Request, tt.req) {
+			t.Errorf("%s: session has plan %q, params %+v, request %+v", tt.name, stored.Plan, stored.Params, stored.Request)
+		}
+
+		_, secrets, err := env.vpn.SessionConfig(session.SessionID, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tunnel := secrets.Tunnel
+		if tunnel.MTU != tt.want.MTU || !reflect.DeepEqual(tunnel.DNS, tt.want.DNS) ||
+			!reflect.DeepEqual(tunnel.AllowedIPs, tt.want.AllowedIPs) || tunnel.PersistentKeepalive != *tt.want.PersistentKeepalive {
+			t.Errorf("%s: issued tunnel %+v", tt.name, tunnel)
+		}
+		if keepalive := strings.Contains(secrets.PeerConfig, "PersistentKeepalive"); keepalive != (*tt.want.PersistentKeepalive != 0) {
+			t.Errorf("%s: config keepalive line = %v:\n%s", tt.name, keepalive, secrets.PeerConfig)
+		}
+	}
+}
+
+func TestTunnelParamsRejected(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+	env.cfg.Plans = []domain.Plan{
+		{Name: "free"},
+		{Name: "pro", Overrides: []string{domain.ParamMTU}},
+	}
+	env.cfg.Live.Apply(env.cfg)
+
+	tests := []struct {
+		name string
+		req  domain.TunnelRequest
+		want error
+	}{
+		{"unknown plan", domain.TunnelRequest{Plan: "gold"}, domain.ErrPlanNotFound},
+		{"override without a plan", domain.TunnelRequest{Overrides: domain.TunnelParams{MTU: 1300}}, domain.ErrOverrideForbidden},
+		{"override the plan keeps", domain.TunnelRequest{Plan: "free", Overrides: domain.TunnelParams{MTU: 1300}}, domain.ErrOverrideForbidden},
+		{"override outside the list", domain.TunnelRequest{Plan: "pro", Overrides: domain.TunnelParams{PersistentKeepalive: intPtr(5)}}, domain.ErrOverrideForbidden},
+		{"override out of range", domain.TunnelRequest{Plan: "pro", Overrides: domain.TunnelParams{MTU: 9000}}, domain.ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		if _, _, err := env.vpn.Connect("DE", tt.req, nil); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	// Nothing was allocated for the refused requests
+	if n := len(env.peers(t, "DE")); n != 0 {
+		t.Errorf("DE has %d peers after refused connects", n)
+	}
+}
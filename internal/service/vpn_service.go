@@ -1,6 +1,8 @@
 package service
 
 import (
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net"
@@ -9,21 +11,39 @@ import (
 
 	"p2nova-vpn/internal/config"
 	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/internal/logging"
 	"p2nova-vpn/internal/repository"
 )
 
 type VPNService struct {
-	sessionRepo *repository.SessionRepository
-	wgService   *WireguardService
-	config      *config.Config
-	ipPool      *IPPool
+	sessionRepo   *repository.SessionRepository
+	serverService *ServerService
+	wgService     *WireguardService
+	config        *config.Config
+
+	// mu guards the sessions, which the repository hands out as shared
+	// pointers, and closing. It is held only to check and commit session
+	// state: geo lookups and peer changes, which may call a remote agent,
+	// run without it. Readers hold it shared.
+	mu sync.RWMutex
+	// closing marks the sessions whose peer is being removed, so no two
+	// callers release the same peer or address
+	closing map[string]bool
+
+	poolsMu sync.Mutex
+	ipPools map[string]*IPPool
 }
 
+// IPPool hands out the client addresses of a subnet: every address but the
+// network address, the gateway (the first host) and the broadcast address,
+// as many as config.SubnetCapacity counts.
 type IPPool struct {
 	mu        sync.Mutex
 	network   *net.IPNet
+	first     net.IP // the first client address, after the gateway
+	size      int
+	next      int // offset of the address to try first
 	allocated map[string]bool
-	lastIP    net.IP
 }
 
 func NewIPPool(cidr string) (*IPPool, error) {
@@ -32,45 +52,37 @@ func NewIPPool(cidr string) (*IPPool, error) {
 		return nil, err
 	}
 
-	// Start from network address
-	startIP := network.IP.Mask(network.Mask)
-
-	// Skip .0 (network) and .1 (server/gateway)
-	// Start allocation from .2
-	startIP = nextIP(startIP) // .0 -> .1
-	startIP = nextIP(startIP) // .1 -> .2
+	size := config.SubnetCapacity(cidr)
+	if size <= 0 {
+		return nil, fmt.Errorf("subnet %s has no room for clients", network)
+	}
 
 	return &IPPool{
 		network:   network,
+		first:     addIP(network.IP, 2),
+		size:      size,
 		allocated: make(map[string]bool),
-		lastIP:    startIP, // Now starts from .2
 	}, nil
 }
+
+// Allocate takes the next free address after the last one handed out,
+// wrapping around to the start of the pool, so released addresses are
+// reused only after the others.
 func (p *IPPool) Allocate() (string, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	// Start from the next IP after network address
-	ip := make(net.IP, len(p.lastIP))
-	copy(ip, p.lastIP)
-
-	// Try to find an available IP
-	for i := 0; i < 253; i++ { // Avoid broadcast
-		ip = nextIP(ip)
-
-		if !p.network.Contains(ip) {
-			return "", fmt.Errorf("IP pool exhausted")
-		}
-
-		ipStr := ip.String()
-		if !p.allocated[ipStr] {
-			p.allocated[ipStr] = true
-			p.lastIP = ip
-			return ipStr, nil
+	for i := 0; i < p.size; i++ {
+		offset := (p.next + i) % p.size
+		ip := addIP(p.first, offset).String()
+		if !p.allocated[ip] {
+			p.allocated[ip] = true
+			p.next = (offset + 1) % p.size
+			return ip, nil
 		}
 	}
 
-	return "", fmt.Errorf("no available IPs")
+	return "", domain.ErrAddressPoolExhausted
 }
 
 func (p *IPPool) Release(ipStr string) {
@@ -79,100 +91,501 @@ func (p *IPPool) Release(ipStr string) {
 	delete(p.allocated, ipStr)
 }
 
-func nextIP(ip net.IP) net.IP {
+// addIP returns the address n after ip.
+func addIP(ip net.IP, n int) net.IP {
 	next := make(net.IP, len(ip))
 	copy(next, ip)
 
-	for j := len(next) - 1; j >= 0; j-- {
-		next[j]++
-		if next[j] != 0 {
-			break
-		}
+	for j := len(next) - 1; j >= 0 && n > 0; j-- {
+		sum := int(next[j]) + n
+		next[j] = byte(sum)
+		n = sum >> 8
 	}
 
 	return next
 }
 
-func NewVPNService(sessionRepo *repository.SessionRepository, wgService *WireguardService, cfg *config.Config) *VPNService {
-	ipPool, err := NewIPPool(cfg.VPNSubnet) // e.g., "10.8.0.0/24"
+func NewVPNService(sessionRepo *repository.SessionRepository, serverService *ServerService, wgService *WireguardService, cfg *config.Config) *VPNService {
+	return &VPNService{
+		sessionRepo:   sessionRepo,
+		serverService: serverService,
+		wgService:     wgService,
+		config:        cfg,
+		closing:       make(map[string]bool),
+		ipPools:       make(map[string]*IPPool),
+	}
+}
+
+// poolFor returns the IP pool of a server, creating it from the server's
+// subnet on first use. Every server hands out addresses independently.
+func (s *VPNService) poolFor(server *domain.Server) (*IPPool, error) {
+	s.poolsMu.Lock()
+	defer s.poolsMu.Unlock()
+
+	// A subnet can only change while the server has no sessions, so a pool
+	// for an old subnet holds no allocations and is simply replaced.
+	if pool, ok := s.ipPools[server.Code]; ok && pool.network.String() == canonicalCIDR(server.Subnet) {
+		return pool, nil
+	}
+
+	pool, err := NewIPPool(server.Subnet) // e.g., "10.8.0.0/24"
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("invalid subnet for server %s: %w", server.Code, err)
 	}
+	s.ipPools[server.Code] = pool
+	return pool, nil
+}
 
-	return &VPNService{
-		sessionRepo: sessionRepo,
-		wgService:   wgService,
-		config:      cfg,
-		ipPool:      ipPool,
+// dropPool forgets a deleted server's pool.
+func (s *VPNService) dropPool(code string) {
+	s.poolsMu.Lock()
+	defer s.poolsMu.Unlock()
+	delete(s.ipPools, code)
+}
+
+func canonicalCIDR(cidr string) string {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return cidr
 	}
+	return network.String()
 }
 
-func (s *VPNService) Connect(serverCode string) (*domain.Session, error) {
-	// 1. Check for any active session
-	if active := s.sessionRepo.GetActiveSession(); active != nil {
-		// found an existing connection, kill it (Disconnect)
-		// This handles cleanup of WireGuard peers and IP release
-		if err := s.Disconnect(active.SessionID); err != nil {
-			return nil, fmt.Errorf("failed to disconnect existing session: %w", err)
-		}
+// Connect opens a session for a client. The returned owner token lets the
+// client fetch the session's config later; only its hash is kept.
+func (s *VPNService) Connect(serverCode string, tunnel domain.TunnelRequest, client *domain.Client) (*domain.Session, string, error) {
+	server, selection, err := s.resolveServer(serverCode, client)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Every client holds its own session; the load of a server is the
+	// number of sessions on it
+	token, tokenHash := domain.NewSessionToken()
+	session, err := s.openSession(server, selection, tunnel, tokenHash)
+	if err != nil {
+		return nil, "", err
+	}
+	return session, token, nil
+}
+
+// AuthorizeSession checks a bearer token for access to a session: the owner
+// token issued on connect or the admin token. An unknown session reads as
+// a wrong token unless the caller is the admin.
+func (s *VPNService) AuthorizeSession(sessionID, token string) error {
+	if token == "" {
+		return domain.ErrUnauthorized
+	}
+	if admin := s.config.AdminToken; admin != "" && subtle.ConstantTimeCompare([]byte(token), []byte(admin)) == 1 {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if session := s.sessionRepo.Get(sessionID); session == nil || !session.OwnedBy(token) {
+		return domain.ErrUnauthorized
+	}
+	return nil
+}
+
+// openSession allocates an address and a peer on the server and records a
+// new session for them, owned by the holder of the token hashed to
+// tokenHash. The peer is added without s.mu, which callers must not hold;
+// the session is only recorded if the server still exists by then.
+func (s *VPNService) openSession(server *domain.Server, selection *domain.Selection, tunnel domain.TunnelRequest, tokenHash string) (*domain.Session, error) {
+	plan, params, err := s.resolveTunnel(server, tunnel)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := s.poolFor(server)
+	if err != nil {
+		return nil, err
 	}
 
-	// 2. Proceed with new connection logic
 	// Allocate IP for client
-	clientIP, err := s.ipPool.Allocate()
+	clientIP, err := pool.Allocate()
 	if err != nil {
 		return nil, fmt.Errorf("failed to allocate IP: %w", err)
 	}
 
-	// Create WireGuard peer
-	peerConfig, clientKey, err := s.wgService.AddPeer(clientIP)
+	// Create WireGuard peer on the selected server
+	clientConfig, peerConfig, clientKey, err := s.wgService.AddPeer(server, clientIP, params, tunnel.Platform)
 	if err != nil {
-		s.ipPool.Release(clientIP)
-		return nil, fmt.Errorf("failed to add WireGuard peer: %w", err)
+		pool.Release(clientIP)
+		return nil, err
 	}
 
-	// Create session
-	session := domain.NewSession(serverCode, clientIP, peerConfig, clientKey)
-	s.sessionRepo.Store(session)
+	s.mu.Lock()
+	session, err := s.recordSession(server, clientIP, clientKey, &domain.SessionSecrets{Tunnel: clientConfig, PeerConfig: peerConfig}, tokenHash)
+	if err == nil {
+		session.Selection = selection
+		session.Plan = plan
+		session.Request = tunnel
+		session.Params = params
+	}
+	s.mu.Unlock()
+	if err != nil {
+		s.wgService.RemovePeer(server, clientKey)
+		pool.Release(clientIP)
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// recordSession stores a new session for a peer added to server, unless
+// the server was removed meanwhile. The secrets are sealed here, under
+// s.mu which callers hold, so a concurrent Reencrypt cannot miss them.
+func (s *VPNService) recordSession(server *domain.Server, clientIP, clientKey string, secrets *domain.SessionSecrets, tokenHash string) (*domain.Session, error) {
+	if _, err := s.serverService.GetServer(server.Code); err != nil {
+		return nil, err
+	}
+	sealed, err := s.sealSecrets(secrets)
+	if err != nil {
+		return nil, err
+	}
 
+	session := domain.NewSession(server.Code, clientIP, sealed, clientKey, tokenHash)
+	s.sessionRepo.Store(session)
 	return session, nil
 }
 
+// resolveServer turns a requested server code or selection strategy into a
+// server that can take a new connection.
+func (s *VPNService) resolveServer(serverCode string, client *domain.Client) (*domain.Server, *domain.Selection, error) {
+	if serverCode == "" {
+		serverCode = domain.StrategyAuto
+	}
+
+	if domain.IsStrategy(serverCode) {
+		return s.serverService.Select(serverCode, client)
+	}
+
+	server, err := s.serverService.GetServer(serverCode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch server.State {
+	case domain.ServerDraining:
+		return nil, nil, domain.ErrServerDraining
+	case domain.ServerMaintenance:
+		return nil, nil, domain.ErrServerMaintenance
+	}
+	if server.Health == domain.HealthDown {
+		return nil, nil, domain.ErrServerDown
+	}
+
+	return server, &domain.Selection{Strategy: domain.StrategyManual, Reason: "requested by client"}, nil
+}
+
 func (s *VPNService) Disconnect(sessionID string) error {
 	session := s.sessionRepo.Get(sessionID)
 	if session == nil {
 		return domain.ErrSessionNotFound
 	}
+	return s.disconnect(session)
+}
+
+// disconnect ends a connected session and releases its peer and address.
+// Ended sessions are refused, as are sessions another caller is closing:
+// one that failed over still holds its peer until releaseRecovered frees
+// it. Callers must not hold s.mu.
+func (s *VPNService) disconnect(session *domain.Session) error {
+	s.mu.Lock()
+	server, pool, err := s.beginClose(session)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.finishClose(session, server, pool)
+}
+
+// beginClose marks a connected session closing and returns its server and
+// pool. Callers hold s.mu and go on with finishClose.
+func (s *VPNService) beginClose(session *domain.Session) (*domain.Server, *IPPool, error) {
+	if !session.Connected || s.closing[session.SessionID] {
+		return nil, nil, domain.ErrNotConnected
+	}
+
+	server, err := s.serverService.GetServer(session.ServerCode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pool, err := s.poolFor(server)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.closing[session.SessionID] = true
+	return server, pool, nil
+}
+
+// finishClose removes the peer of a session marked by beginClose, then
+// releases its address and ends it. A session whose peer could not be
+// removed is left connected. Callers must not hold s.mu.
+func (s *VPNService) finishClose(session *domain.Session, server *domain.Server, pool *IPPool) error {
+	removeErr := s.wgService.RemovePeer(server, session.ClientKey)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.closing, session.SessionID)
+
+	// A down node cannot be reached, so its peer and address are released
+	// once it comes back.
+	if removeErr != nil {
+		if server.Health != domain.HealthDown {
+			return removeErr
+		}
+		s.deferRelease(session)
+		return nil
+	}
 
-	// Remove WireGuard peer
-	if err := s.wgService.RemovePeer(session.ClientKey); err != nil {
+	pool.Release(session.ClientIP)
+	s.endSession(session)
+
+	// The server may have started draining while the peer was removed
+	if current, err := s.serverService.GetServer(server.Code); err == nil && current.State == domain.ServerDraining && s.sessionRepo.CountActive(server.Code) == 0 {
+		s.finishDrain(server.Code)
+	}
+
+	return nil
+}
+
+// RemoveServer deletes a server from the registry. A server with active
+// sessions is only removed when force is set, which disconnects them, or
+// drain is set, which stops new connections and deletes the server once the
+// last session ends.
+func (s *VPNService) RemoveServer(code string, force, drain bool) error {
+	server, err := s.serverService.GetServer(code)
+	if err != nil {
 		return err
 	}
 
-	s.ipPool.Release(session.ClientIP)
+	s.mu.RLock()
+	active := s.sessionRepo.ListActive(code)
+	s.mu.RUnlock()
+
+	switch {
+	case len(active) == 0:
+	case force:
+		// No new sessions arrive while the peers are removed
+		if err := s.serverService.MarkDraining(server.Code); err != nil {
+			return err
+		}
+		for _, session := range active {
+			if err := s.disconnect(session); err != nil {
+				// The node may be unreachable; end the session anyway so
+				// the server can go.
+				logging.Warnf("Force-removing server %s: failed to disconnect session %s: %v", code, session.SessionID, err)
+				s.mu.Lock()
+				if session.Connected && !s.closing[session.SessionID] {
+					s.endSession(session)
+				}
+				s.mu.Unlock()
+			}
+		}
+	case drain:
+		return s.serverService.MarkDraining(server.Code)
+	default:
+		return domain.ErrServerHasSessions
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
+	// The last disconnect of a forced removal may have finished the drain
+	if err := s.serverService.DeleteServer(code); err != nil && !(force && errors.Is(err, domain.ErrServerNotFound)) {
+		return err
+	}
+	s.dropPool(code)
+	return nil
+}
+
+func (s *VPNService) finishDrain(code string) {
+	if err := s.serverService.DeleteServer(code); err != nil {
+		logging.Errorf("Failed to delete drained server %s: %v", code, err)
+		return
+	}
+	s.dropPool(code)
+	logging.Infof("Server %s drained and removed", code)
+}
+
+// endSession marks a session as ended without touching its peer. Callers
+// hold s.mu.
+func (s *VPNService) endSession(session *domain.Session) {
 	session.Connected = false
 	session.EndTime = time.Now().Unix()
+	session.Secrets = nil
 	s.sessionRepo.Update(session)
-
-	return nil
 }
 
-func (s *VPNService) GetStatus() (*domain.VPNStatus, error) {
-	session := s.sessionRepo.GetActiveSession()
+// GetStatus reports on a session.
+func (s *VPNService) GetStatus(sessionID string) (*domain.VPNStatus, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("%w: sessionId is required", domain.ErrInvalidRequest)
+	}
 
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session := s.sessionRepo.Get(sessionID)
 	if session == nil {
-		return &domain.VPNStatus{Connected: false}, nil
+		return nil, domain.ErrSessionNotFound
+	}
+
+	if !session.Connected {
+		status := &domain.VPNStatus{Connected: false, SessionID: session.SessionID}
+		if session.ReplacedBy != "" {
+			status.Notice = &domain.Notice{
+				Type:      domain.NoticeMigrated,
+				Message:   "session was moved to another server",
+				SessionID: session.ReplacedBy,
+			}
+		}
+		return status, nil
 	}
 
 	duration := time.Now().Unix() - session.StartTime
 
-	return &domain.VPNStatus{
+	status := &domain.VPNStatus{
 		Connected: true,
+		SessionID: session.SessionID,
 		Server:    session.ServerCode,
 		Duration:  duration,
 		IP:        session.ClientIP,
-	}, nil
+	}
+
+	if session.MigratedFrom != "" {
+		secrets, err := s.sessionSecrets(session)
+		if err != nil {
+			return nil, err
+		}
+		status.Config = secrets.PeerConfig
+		status.Notice = &domain.Notice{
+			Type:      domain.NoticeMigrated,
+			Message:   session.Selection.Reason,
+			SessionID: session.MigratedFrom,
+		}
+	}
+
+	if server, err := s.serverService.GetServer(session.ServerCode); err == nil {
+		if notice := serverNotice(server); notice != nil {
+			status.Notice = notice
+		}
+	}
+
+	return status, nil
+}
+
+// GetSession returns a session that is still connected, for handing out its
+// client config again.
+func (s *VPNService) GetSession(sessionID string) (*domain.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.connectedSession(sessionID)
+}
+
+// Traffic returns what WireGuard reports for a connected session's peer:
+// its latest handshake and transfer counters. A peer that has not been seen
+// yet reports zeros.
+func (s *VPNService) Traffic(sessionID string) (*domain.PeerTraffic, error) {
+	s.mu.RLock()
+	session, err := s.connectedSession(sessionID)
+	var code, clientKey string
+	if err == nil {
+		code, clientKey = session.ServerCode, session.ClientKey
+	}
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// The peer API may be a remote agent; it is not asked under the lock
+	server, err := s.serverService.GetServer(code)
+	if err != nil {
+		return nil, err
+	}
+	peers, err := s.wgService.ListPeers(server)
+	if err != nil {
+		return nil, err
+	}
+	traffic := &domain.PeerTraffic{}
+	if peer := findPeer(peers, clientKey); peer != nil {
+		if !peer.LatestHandshake.IsZero() {
+			traffic.LatestHandshake = peer.LatestHandshake.Unix()
+		}
+		traffic.RxBytes, traffic.TxBytes = peer.RxBytes, peer.TxBytes
+	}
+	return traffic, nil
+}
+
+func (s *VPNService) connectedSession(sessionID string) (*domain.Session, error) {
+	session := s.sessionRepo.Get(sessionID)
+	if session == nil {
+		return nil, domain.ErrSessionNotFound
+	}
+	if !session.Connected {
+		return nil, domain.ErrNotConnected
+	}
+	return session, nil
+}
+
+// SessionConfig returns a connected session with its key material and the
+// client config rendered for platform. An empty platform, or the one asked
+// for on connect, gives the config handed out then.
+func (s *VPNService) SessionConfig(sessionID, platform string) (*domain.Session, *domain.SessionSecrets, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, err := s.connectedSession(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	secrets, err := s.sessionSecrets(session)
+	if err != nil {
+		return nil, nil, err
+	}
+	if platform == "" || platform == session.Request.Platform {
+		return session, secrets, nil
+	}
+
+	server, err := s.serverService.GetServer(session.ServerCode)
+	if err != nil {
+		return nil, nil, err
+	}
+	if secrets.PeerConfig, err = s.wgService.RenderConfig(server, secrets.Tunnel, platform); err != nil {
+		return nil, nil, err
+	}
+	return session, secrets, nil
+}
+
+// ExportConfig renders a connected session's tunnel in one of the export
+// formats.
+func (s *VPNService) ExportConfig(sessionID, format string, opts domain.ExportOptions) (*domain.ConfigExport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, err := s.connectedSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Platform == "" {
+		opts.Platform = session.Request.Platform
+	}
+
+	secrets, err := s.sessionSecrets(session)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := s.serverService.GetServer(session.ServerCode)
+	if err != nil {
+		return nil, err
+	}
+	return s.wgService.Export(server, secrets.Tunnel, format, opts)
 }
 
 func (s *VPNService) GetSpeed() *domain.SpeedTest {
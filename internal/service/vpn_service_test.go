@@ -0,0 +1,257 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/pkg/wireguard"
+)
+
+func TestIPPoolWrapsAround(t *testing.T) {
+	pool, err := NewIPPool("10.8.1.0/29")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for {
+		ip, err := pool.Allocate()
+		if err != nil {
+			if !errors.Is(err, domain.ErrAddressPoolExhausted) {
+				t.Fatal(err)
+			}
+			break
+		}
+		got = append(got, ip)
+	}
+	// Not the network address, the gateway or the broadcast address
+	if want := "10.8.1.2 10.8.1.3 10.8.1.4 10.8.1.5 10.8.1.6"; strings.Join(got, " ") != want {
+		t.Errorf("allocated %v, want %s", got, want)
+	}
+
+	pool.Release("10.8.1.3")
+	if ip, err := pool.Allocate(); err != nil || ip != "10.8.1.3" {
+		t.Errorf("after a release: got %s, %v; want 10.8.1.3", ip, err)
+	}
+}
+
+func TestIPPoolReusesReleasedAddresses(t *testing.T) {
+	pool, err := NewIPPool("10.8.1.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	held := make(map[string]bool)
+	for i := 0; i < 3*253; i++ {
+		ip, err := pool.Allocate()
+		if err != nil {
+			t.Fatalf("allocation %d: %v", i, err)
+		}
+		if ip == "10.8.1.0" || ip == "10.8.1.1" || ip == "10.8.1.255" || held[ip] {
+			t.Fatalf("allocation %d: got %s", i, ip)
+		}
+		held[ip] = true
+		// Keep a few addresses for good, release the rest
+		if i%50 != 0 {
+			pool.Release(ip)
+			delete(held, ip)
+		}
+	}
+
+	if _, err := NewIPPool("10.8.1.0/31"); err == nil {
+		t.Error("pool without client addresses created")
+	}
+}
+
+// blockingBackend holds every AddPeer until release is closed.
+type blockingBackend struct {
+	wireguard.Backend
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingBackend) AddPeer(publicKey, allowedIP string) error {
+	b.entered <- struct{}{}
+	<-b.release
+	return b.Backend.AddPeer(publicKey, allowedIP)
+}
+
+func TestSlowPeerChangesDoNotBlockSessions(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1), testServer("FR", 2))
+	slow := &blockingBackend{Backend: wireguard.NewFakeBackend(), entered: make(chan struct{}), release: make(chan struct{})}
+	local := env.wg.local
+	env.wg.local = func(iface string) wireguard.Backend {
+		if iface == "wg-FR" {
+			return slow
+		}
+		return local(iface)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, _, err := env.vpn.Connect("FR", domain.TunnelRequest{}, nil)
+		errc <- err
+	}()
+	<-slow.entered
+
+	done := make(chan error, 1)
+	go func() {
+		session, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+		if err == nil {
+			_, err = env.vpn.GetStatus(session.SessionID)
+		}
+		if err == nil {
+			err = env.vpn.Disconnect(session.SessionID)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sessions on DE waited for the peer on FR")
+	}
+
+	// FR goes away while its peer is added; the connect is rolled back
+	if err := env.vpn.RemoveServer("FR", false, false); err != nil {
+		t.Fatal(err)
+	}
+	close(slow.release)
+	if err := <-errc; !errors.Is(err, domain.ErrServerNotFound) {
+		t.Errorf("connect to a removed server: %v", err)
+	}
+	if peers, _ := slow.ListPeers(); len(peers) != 0 {
+		t.Errorf("peers left on the removed server: %+v", peers)
+	}
+}
+
+func TestAuthorizeSession(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+	env.cfg.AdminToken = "admin-secret"
+
+	session, token, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, other, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token == "" || token == other {
+		t.Fatalf("owner tokens %q and %q", token, other)
+	}
+	if stored := env.sessions.Get(session.SessionID); stored.TokenHash == token || !stored.OwnedBy(token) {
+		t.Error("session does not keep the token hashed")
+	}
+
+	tests := []struct {
+		name    string
+		session string
+		token   string
+		want    error
+	}{
+		{"owner", session.SessionID, token, nil},
+		{"admin", session.SessionID, "admin-secret", nil},
+		{"no token", session.SessionID, "", domain.ErrUnauthorized},
+		{"wrong token", session.SessionID, "nope", domain.ErrUnauthorized},
+		{"another session's token", session.SessionID, other, domain.ErrUnauthorized},
+		{"unknown session", "missing", token, domain.ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		if err := env.vpn.AuthorizeSession(tt.session, tt.token); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// Without an admin token configured nothing else is accepted
+	env.cfg.AdminToken = ""
+	if err := env.vpn.AuthorizeSession(session.SessionID, ""); err != domain.ErrUnauthorized {
+		t.Errorf("empty admin token: got %v", err)
+	}
+}
+
+func TestMigrationKeepsOwnerToken(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1), testServer("FR", 2))
+	session, token, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Now().Add(-time.Second).Unix()
+	if _, err := env.servers.StartMaintenance("DE", domain.MaintenanceRequest{Deadline: past}); err != nil {
+		t.Fatal(err)
+	}
+	env.vpn.enforceMaintenance()
+
+	replacement := env.sessions.Get(env.sessions.Get(session.SessionID).ReplacedBy)
+	if replacement == nil {
+		t.Fatal("session was not migrated")
+	}
+	if err := env.vpn.AuthorizeSession(replacement.SessionID, token); err != nil {
+		t.Errorf("owner token on the replacement: %v", err)
+	}
+}
+
+func TestTraffic(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+	session, _, err := env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	traffic, err := env.vpn.Traffic(session.SessionID)
+	if err != nil || *traffic != (domain.PeerTraffic{}) {
+		t.Fatalf("before a handshake: got %+v, %v; want zeros", traffic, err)
+	}
+
+	handshake := time.Now().Truncate(time.Second)
+	env.backends["DE"].SetTraffic(session.ClientKey, handshake, 1000, 2000)
+	traffic, err = env.vpn.Traffic(session.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (domain.PeerTraffic{LatestHandshake: handshake.Unix(), RxBytes: 1000, TxBytes: 2000}); *traffic != want {
+		t.Errorf("got %+v, want %+v", *traffic, want)
+	}
+
+	if _, err := env.vpn.Traffic("missing"); err != domain.ErrSessionNotFound {
+		t.Errorf("unknown session: got %v, want ErrSessionNotFound", err)
+	}
+	if err := env.vpn.Disconnect(session.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.vpn.Traffic(session.SessionID); err != domain.ErrNotConnected {
+		t.Errorf("ended session: got %v, want ErrNotConnected", err)
+	}
+}
+
+func TestConnectErrorCodes(t *testing.T) {
+	small := testServer("DE", 1)
+	small.Subnet = "10.8.1.0/30"
+	env := newTestEnv(t, small)
+
+	var err error
+	for i := 0; i < 4 && err == nil; i++ {
+		_, _, err = env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	}
+	if !errors.Is(err, domain.ErrAddressPoolExhausted) {
+		t.Errorf("full subnet: got %v, want ErrAddressPoolExhausted", err)
+	}
+
+	env = newTestEnv(t, testServer("DE", 1))
+	env.wg.UseLocalBackends(func(string) wireguard.Backend {
+		return failingBackend{}
+	})
+	_, _, err = env.vpn.Connect("DE", domain.TunnelRequest{}, nil)
+	if !errors.Is(err, domain.ErrWireGuardFailed) || !strings.Contains(err.Error(), "node unreachable") {
+		t.Errorf("failed peer: got %v, want ErrWireGuardFailed with the cause", err)
+	}
+	if env.allocated(t, "DE", "10.8.1.2") {
+		t.Error("address kept after the peer failed")
+	}
+}
@@ -2,25 +2,82 @@ package service
 
 import (
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/base64"
 	"fmt"
-	"os/exec"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
 
+	"p2nova-vpn/internal/agent"
 	"p2nova-vpn/internal/config"
+	"p2nova-vpn/internal/domain"
+	"p2nova-vpn/pkg/wireguard"
 
 	"golang.org/x/crypto/curve25519"
 )
 
 type WireguardService struct {
-	config *config.Config
-	wg     string
+	config   *config.Config
+	agentTLS *tls.Config
+	agentsMu sync.Mutex
+	agents   map[string]*agent.Client
+
+	// local opens the WireGuard interface of a server without an agent
+	local func(iface string) wireguard.Backend
+	// newUUID names the connections and profiles of exports
+	newUUID func() string
 }
 
-func NewWireguardService(cfg *config.Config) *WireguardService {
-	return &WireguardService{
+func NewWireguardService(cfg *config.Config) (*WireguardService, error) {
+	s := &WireguardService{
 		config: cfg,
-		wg:     cfg.WGInterface, // e.g., "wg0"
+		agents: make(map[string]*agent.Client),
+		local: func(iface string) wireguard.Backend {
+			return wireguard.NewInterface(iface)
+		},
+		newUUID: randomUUID,
 	}
+
+	if cfg.AgentCertFile != "" {
+		tlsConfig, err := agent.ClientTLSConfig(cfg.AgentCertFile, cfg.AgentKeyFile, cfg.AgentCAFile)
+		if err != nil {
+			return nil, err
+		}
+		s.agentTLS = tlsConfig
+	}
+
+	return s, nil
+}
+
+// UseLocalBackends makes servers without an agent use the backends open
+// returns instead of WireGuard interfaces on this host, e.g. in-memory ones.
+func (s *WireguardService) UseLocalBackends(open func(iface string) wireguard.Backend) {
+	s.local = open
+}
+
+// backend returns the peer manager for a server: the node's agent when one
+// is configured, otherwise the WireGuard interface on this host.
+func (s *WireguardService) backend(server *domain.Server) (wireguard.Backend, error) {
+	if server.Agent == "" {
+		return s.local(server.Interface), nil
+	}
+
+	if s.agentTLS == nil {
+		return nil, fmt.Errorf("server %s uses an agent but no agent TLS config is loaded", server.Code)
+	}
+
+	s.agentsMu.Lock()
+	defer s.agentsMu.Unlock()
+
+	client, ok := s.agents[server.Agent]
+	if !ok {
+		client = agent.NewClient(server.Agent, s.agentTLS)
+		s.agents[server.Agent] = client
+	}
+	return client, nil
 }
 
 func (s *WireguardService) generateKeys() (privateKey, publicKey string, err error) {
@@ -40,54 +97,111 @@ func (s *WireguardService) generateKeys() (privateKey, publicKey string, err err
 	return privateKey, publicKey, nil
 }
 
-func (s *WireguardService) AddPeer(clientIP string) (peerConfig string, publicKey string, err error) {
+// AddPeer creates a peer for clientIP on the server. It returns the client's
+// tunnel config built from params, the config rendered from it for the
+// client's platform and the client's public key.
+func (s *WireguardService) AddPeer(server *domain.Server, clientIP string, params domain.TunnelParams, platform string) (tunnel *domain.TunnelConfig, peerConfig string, publicKey string, err error) {
+	backend, err := s.backend(server)
+	if err != nil {
+		return nil, "", "", err
+	}
+
 	// Generate client keys
 	privateKey, pubKey, err := s.generateKeys()
 	if err != nil {
-		return "", "", err
+		return nil, "", "", err
 	}
 
-	// Add peer to WireGuard using wg command
-	cmd := exec.Command("wg", "set", s.wg,
-		"peer", pubKey,
-		"allowed-ips", fmt.Sprintf("%s/32", clientIP))
-
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return "", "", fmt.Errorf("failed to add peer: %s - %v", output, err)
+	// Generate client config before touching the server, so a failed
+	// render leaves no peer behind
+	tunnel = s.tunnelConfig(server, params, privateKey, clientIP)
+	peerConfig, err = s.generatePeerConfig(server, tunnel, platform)
+	if err != nil {
+		return nil, "", "", err
 	}
 
-	// Generate client config
-	peerConfig = s.generatePeerConfig(privateKey, clientIP)
+	if err := backend.AddPeer(pubKey, clientIP); err != nil {
+		return nil, "", "", fmt.Errorf("%w: failed to add peer: %w", domain.ErrWireGuardFailed, err)
+	}
 
-	return peerConfig, pubKey, nil
+	return tunnel, peerConfig, pubKey, nil
 }
 
-func (s *WireguardService) RemovePeer(publicKey string) error {
-	cmd := exec.Command("wg", "set", s.wg, "peer", publicKey, "remove")
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to remove peer: %s - %v", output, err)
+func (s *WireguardService) RemovePeer(server *domain.Server, publicKey string) error {
+	backend, err := s.backend(server)
+	if err != nil {
+		return err
+	}
+
+	if err := backend.RemovePeer(publicKey); err != nil {
+		return fmt.Errorf("%w: failed to remove peer: %w", domain.ErrWireGuardFailed, err)
 	}
 	return nil
 }
 
-func (s *WireguardService) generatePeerConfig(privateKey, clientIP string) string {
-	// This is the complete config the client needs
-	return fmt.Sprintf(`[Interface]
-PrivateKey = %s
-Address = %s/32
-DNS = %s
-MTU = 1420
-
-[Peer]
-PublicKey = %s
-Endpoint = %s:%s
-AllowedIPs = 0.0.0.0/0, ::/0
-PersistentKeepalive = 25`,
-		privateKey,
-		clientIP,
-		s.config.DNSServers, // e.g., "1.1.1.1, 8.8.8.8"
-		s.config.ServerPublicKey,
-		s.config.ServerEndpoint, // Your VPN server's public IP
-		s.config.WGPort,         // Usually 51820
-	)
+func (s *WireguardService) ListPeers(server *domain.Server) ([]wireguard.Peer, error) {
+	backend, err := s.backend(server)
+	if err != nil {
+		return nil, err
+	}
+	return backend.ListPeers()
+}
+
+// tunnelConfig collects the settings of a client's tunnel to the server.
+func (s *WireguardService) tunnelConfig(server *domain.Server, params domain.TunnelParams, privateKey, clientIP string) *domain.TunnelConfig {
+	return &domain.TunnelConfig{
+		PrivateKey:          privateKey,
+		Address:             clientIP + "/32",
+		DNS:                 params.DNS,
+		MTU:                 params.MTU,
+		PublicKey:           server.PublicKey,
+		Endpoint:            net.JoinHostPort(server.Endpoint, strconv.Itoa(server.Port)), // The selected node, usually port 51820
+		AllowedIPs:          params.AllowedIPs,
+		PersistentKeepalive: *params.PersistentKeepalive,
+	}
+}
+
+// generatePeerConfig renders a tunnel with the operator's template for the
+// server and platform, or as a plain wg-quick config when there is none.
+func (s *WireguardService) generatePeerConfig(server *domain.Server, t *domain.TunnelConfig, platform string) (string, error) {
+	data := templateData(server, t, platform)
+
+	var config strings.Builder
+	if err := s.config.Live.Template(server.Code, platform).Execute(&config, data); err != nil {
+		return "", fmt.Errorf("failed to render client config: %w", err)
+	}
+	return config.String(), nil
+}
+
+// RenderConfig renders an existing tunnel again, e.g. for another platform.
+func (s *WireguardService) RenderConfig(server *domain.Server, t *domain.TunnelConfig, platform string) (string, error) {
+	return s.generatePeerConfig(server, t, platform)
+}
+
+// templateData is what client configs and exports are built from. Every
+// format is line based, so the free-text server fields are cut to a single
+// line: a line break in a name would start a config line or command of its
+// own.
+func templateData(server *domain.Server, t *domain.TunnelConfig, platform string) *domain.TemplateData {
+	return &domain.TemplateData{
+		TunnelConfig: t,
+		ClientIP:     strings.TrimSuffix(t.Address, "/32"),
+		Server: domain.TemplateServer{
+			Code:    server.Code,
+			Name:    singleLine(server.Name),
+			Country: server.Country,
+			City:    singleLine(server.City),
+		},
+		Platform: platform,
+	}
+}
+
+// singleLine replaces line breaks and other control characters with spaces.
+func singleLine(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '\u2028' || r == '\u2029' {
+			return ' '
+		}
+		return r
+	}, s)
 }
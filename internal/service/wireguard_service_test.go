@@ -0,0 +1,111 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"p2nova-vpn/internal/domain"
+)
+
+func TestConnectUsesSelectedServer(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1), testServer("KE", 2))
+
+	for _, code := range []string{"DE", "KE"} {
+		srv, err := env.servers.GetServer(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		session, _, err := env.vpn.Connect(code, domain.TunnelRequest{}, nil)
+		if err != nil {
+			t.Fatalf("Connect(%s): %v", code, err)
+		}
+		if session.ServerCode != code {
+			t.Errorf("session is on %s, want %s", session.ServerCode, code)
+		}
+
+		_, secrets, err := env.vpn.SessionConfig(session.SessionID, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tunnel := secrets.Tunnel
+		if tunnel.Endpoint != srv.Endpoint+":51820" || tunnel.PublicKey != srv.PublicKey {
+			t.Errorf("%s tunnel points at %s with key %s, want %s:51820 with key %s",
+				code, tunnel.Endpoint, tunnel.PublicKey, srv.Endpoint, srv.PublicKey)
+		}
+		if !strings.Contains(secrets.PeerConfig, "Endpoint = "+srv.Endpoint+":51820") ||
+			!strings.Contains(secrets.PeerConfig, "PublicKey = "+srv.PublicKey) {
+			t.Errorf("%s peer config is for another server:\n%s", code, secrets.PeerConfig)
+		}
+		if !strings.HasPrefix(session.ClientIP, strings.TrimSuffix(srv.Subnet, "0/24")) {
+			t.Errorf("%s client IP %s is outside the server's subnet %s", code, session.ClientIP, srv.Subnet)
+		}
+
+		found := false
+		for _, peer := range env.peers(t, code) {
+			if peer.PublicKey == session.ClientKey {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("client peer was not added to %s", code)
+		}
+	}
+}
+
+func TestConnectUnknownServer(t *testing.T) {
+	env := newTestEnv(t, testServer("DE", 1))
+
+	if _, _, err := env.vpn.Connect("XX", domain.TunnelRequest{}, nil); err != domain.ErrServerNotFound {
+		t.Errorf("got %v, want ErrServerNotFound", err)
+	}
+	if peers := env.peers(t, "DE"); len(peers) != 0 {
+		t.Errorf("a failed connect left %d peers behind", len(peers))
+	}
+}
+
+func TestConnectRendersTemplates(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range map[string]string{
+		"platform-linux.tmpl": "# linux {{.Server.Code}} {{.ClientIP}}\n",
+		"server-KE.tmpl":      "# KE {{.Endpoint}}\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("TEMPLATES_DIR", dir)
+	env := newTestEnv(t, testServer("DE", 1), testServer("KE", 2))
+
+	config := func(session *domain.Session, platform string) string {
+		t.Helper()
+		_, secrets, err := env.vpn.SessionConfig(session.SessionID, platform)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return secrets.PeerConfig
+	}
+
+	session, _, err := env.vpn.Connect("DE", domain.TunnelRequest{Platform: "linux"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := config(session, ""), "# linux DE "+session.ClientIP+"\n"; got != want {
+		t.Errorf("config on connect = %q, want %q", got, want)
+	}
+	// Another platform renders the same tunnel again
+	if got := config(session, "ios"); !strings.HasPrefix(got, "[Interface]") || !strings.Contains(got, "Address = "+session.ClientIP) {
+		t.Errorf("ios config:\n%s", got)
+	}
+
+	// A server template beats a platform one
+	session, _, err = env.vpn.Connect("KE", domain.TunnelRequest{Platform: "linux"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config(session, ""); got != "# KE 192.0.2.2:51820\n" {
+		t.Errorf("KE config = %q", got)
+	}
+}
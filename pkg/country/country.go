@@ -0,0 +1,108 @@
+// Package country provides ISO 3166-1 alpha-2 country data: English names,
+// continents and emoji flags.
+package country
+
+import (
+	"sort"
+	"strings"
+)
+
+type Continent string
+
+const (
+	Africa       Continent = "AF"
+	Antarctica   Continent = "AN"
+	Asia         Continent = "AS"
+	Europe       Continent = "EU"
+	NorthAmerica Continent = "NA"
+	Oceania      Continent = "OC"
+	SouthAmerica Continent = "SA"
+)
+
+var continentNames = map[Continent]string{
+	Africa:       "Africa",
+	Antarctica:   "Antarctica",
+	Asia:         "Asia",
+	Europe:       "Europe",
+	NorthAmerica: "North America",
+	Oceania:      "Oceania",
+	SouthAmerica: "South America",
+}
+
+func (c Continent) Name() string {
+	return continentNames[c]
+}
+
+// ParseContinent accepts a continent code (EU) or English name (Europe).
+func ParseContinent(s string) (Continent, bool) {
+	for code, name := range continentNames {
+		if strings.EqualFold(s, string(code)) || strings.EqualFold(s, name) {
+			return code, true
+		}
+	}
+	return "", false
+}
+
+type Country struct {
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	Continent Continent `json:"continent"`
+}
+
+func (c Country) Flag() string {
+	return Flag(c.Code)
+}
+
+var byCode = func() map[string]Country {
+	m := make(map[string]Country, len(countries))
+	for _, c := range countries {
+		m[c.Code] = c
+	}
+	return m
+}()
+
+// Normalize upper-cases a code and resolves aliases such as UK to GB.
+func Normalize(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if alias, ok := aliases[code]; ok {
+		return alias
+	}
+	return code
+}
+
+func Lookup(code string) (Country, bool) {
+	c, ok := byCode[Normalize(code)]
+	return c, ok
+}
+
+// Name returns the English name of a country, or the code itself when it
+// is unknown.
+func Name(code string) string {
+	if c, ok := Lookup(code); ok {
+		return c.Name
+	}
+	return code
+}
+
+// Flag builds the emoji flag from the two regional indicator symbols of the
+// code. Unknown codes get a globe.
+func Flag(code string) string {
+	c, ok := Lookup(code)
+	if !ok {
+		return "🌍"
+	}
+
+	const regionalIndicatorA = 0x1F1E6
+	return string([]rune{
+		regionalIndicatorA + rune(c.Code[0]-'A'),
+		regionalIndicatorA + rune(c.Code[1]-'A'),
+	})
+}
+
+// All returns every country ordered by code.
+func All() []Country {
+	all := make([]Country, len(countries))
+	copy(all, countries)
+	sort.Slice(all, func(i, j int) bool { return all[i].Code < all[j].Code })
+	return all
+}
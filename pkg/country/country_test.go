@@ -0,0 +1,81 @@
+package country
+
+import "testing"
+
+func TestAllCountries(t *testing.T) {
+	all := All()
+	if len(all) != 249 {
+		t.Errorf("got %d countries, want the 249 ISO 3166-1 codes", len(all))
+	}
+
+	for i, c := range all {
+		if len(c.Code) != 2 || c.Code[0] < 'A' || c.Code[0] > 'Z' || c.Code[1] < 'A' || c.Code[1] > 'Z' {
+			t.Errorf("invalid code %q", c.Code)
+		}
+		if i > 0 && all[i-1].Code >= c.Code {
+			t.Errorf("%s listed after %s", c.Code, all[i-1].Code)
+		}
+		if c.Name == "" || c.Continent.Name() == "" {
+			t.Errorf("%s: name %q, continent %q", c.Code, c.Name, c.Continent)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		code, want, name string
+		continent        Continent
+	}{
+		{"KE", "KE", "Kenya", Africa},
+		{" de ", "DE", "Germany", Europe},
+		{"UK", "GB", "United Kingdom", Europe},
+		{"el", "GR", "Greece", Europe},
+		{"BR", "BR", "Brazil", SouthAmerica},
+		{"AQ", "AQ", "Antarctica", Antarctica},
+	}
+	for _, tt := range tests {
+		c, ok := Lookup(tt.code)
+		if !ok || c.Code != tt.want || c.Name != tt.name || c.Continent != tt.continent {
+			t.Errorf("Lookup(%q) = %+v, %v", tt.code, c, ok)
+		}
+	}
+
+	if _, ok := Lookup("XX"); ok {
+		t.Error("XX was found")
+	}
+	if got := Name("XX"); got != "XX" {
+		t.Errorf("Name(XX) = %q, want the code back", got)
+	}
+}
+
+func TestFlag(t *testing.T) {
+	tests := map[string]string{
+		"KE": "🇰🇪",
+		"us": "🇺🇸",
+		"UK": "🇬🇧",
+		"XX": "🌍",
+		"":   "🌍",
+	}
+	for code, want := range tests {
+		if got := Flag(code); got != want {
+			t.Errorf("Flag(%q) = %s, want %s", code, got, want)
+		}
+	}
+	if c, _ := Lookup("JP"); c.Flag() != "🇯🇵" {
+		t.Errorf("JP flag = %s", c.Flag())
+	}
+}
+
+func TestParseContinent(t *testing.T) {
+	for _, s := range []string{"EU", "eu", "Europe", "EUROPE"} {
+		if c, ok := ParseContinent(s); !ok || c != Europe {
+			t.Errorf("ParseContinent(%q) = %q, %v", s, c, ok)
+		}
+	}
+	if c, ok := ParseContinent("North America"); !ok || c != NorthAmerica {
+		t.Errorf("North America parsed as %q, %v", c, ok)
+	}
+	if _, ok := ParseContinent("Atlantis"); ok {
+		t.Error("Atlantis parsed")
+	}
+}
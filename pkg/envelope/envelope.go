@@ -0,0 +1,204 @@
+// Package envelope seals data with envelope encryption: every value gets its
+// own random data key, which is itself wrapped with a versioned master key.
+// Rotating the master key only rewraps the data keys. Both layers use
+// AES-256-GCM.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// KeyLen is the length of master and data keys.
+const KeyLen = 32
+
+var (
+	ErrUnknownKey = errors.New("envelope: sealed with an unknown master key version")
+	ErrDecrypt    = errors.New("envelope: decryption failed")
+)
+
+// Envelope is a sealed value. WrappedKey is the data key encrypted under
+// master key KeyVersion; Ciphertext is the value encrypted under the data
+// key. Each carries its GCM nonce in front.
+type Envelope struct {
+	KeyVersion int    `json:"keyVersion"`
+	WrappedKey []byte `json:"wrappedKey"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Keyring holds the master keys by version and seals with the current one.
+// A keyring is immutable once built.
+type Keyring struct {
+	keys      map[int]cipher.AEAD
+	current   int
+	ephemeral bool
+}
+
+// NewKeyring builds a keyring from master keys by version. Versions must be
+// positive; current must be one of them.
+func NewKeyring(keys map[int][]byte, current int) (*Keyring, error) {
+	k := &Keyring{keys: make(map[int]cipher.AEAD), current: current}
+	for version, key := range keys {
+		if version < 1 {
+			return nil, fmt.Errorf("envelope: invalid key version %d", version)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("envelope: key version %d: %w", version, err)
+		}
+		k.keys[version] = aead
+	}
+	if _, ok := k.keys[current]; !ok {
+		return nil, fmt.Errorf("envelope: current key version %d is not configured", current)
+	}
+	return k, nil
+}
+
+// NewEphemeralKeyring returns a keyring with a random master key, version
+// 0, that lives as long as the process.
+func NewEphemeralKeyring() (*Keyring, error) {
+	key := make([]byte, KeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Keyring{keys: map[int]cipher.AEAD{0: aead}, ephemeral: true}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeyLen {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeyLen, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Current returns the version new values are sealed with.
+func (k *Keyring) Current() int { return k.current }
+
+// Ephemeral reports whether the keyring only holds a random per-process key.
+func (k *Keyring) Ephemeral() bool { return k.ephemeral }
+
+// Versions returns the master key versions held, in order.
+func (k *Keyring) Versions() []int {
+	versions := make([]int, 0, len(k.keys))
+	for version := range k.keys {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// Including returns a keyring sealing with k's current key that can also
+// open values sealed with older's keys. Where both hold a version, k's key
+// wins.
+func (k *Keyring) Including(older *Keyring) *Keyring {
+	merged := &Keyring{keys: make(map[int]cipher.AEAD), current: k.current, ephemeral: k.ephemeral}
+	if older != nil {
+		for version, aead := range older.keys {
+			merged.keys[version] = aead
+		}
+	}
+	for version, aead := range k.keys {
+		merged.keys[version] = aead
+	}
+	return merged
+}
+
+// Seal encrypts plaintext under a fresh data key wrapped with the current
+// master key.
+func (k *Keyring) Seal(plaintext []byte) (*Envelope, error) {
+	dataKey := make([]byte, KeyLen)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := seal(data, plaintext, nil)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := seal(k.keys[k.current], dataKey, versionData(k.current))
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{KeyVersion: k.current, WrappedKey: wrapped, Ciphertext: ciphertext}, nil
+}
+
+// Open decrypts an envelope.
+func (k *Keyring) Open(e *Envelope) ([]byte, error) {
+	dataKey, err := k.unwrap(e)
+	if err != nil {
+		return nil, err
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return open(data, e.Ciphertext, nil)
+}
+
+// Rewrap returns the envelope with its data key wrapped under the current
+// master key. The ciphertext is unchanged.
+func (k *Keyring) Rewrap(e *Envelope) (*Envelope, error) {
+	if e.KeyVersion == k.current {
+		return e, nil
+	}
+	dataKey, err := k.unwrap(e)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := seal(k.keys[k.current], dataKey, versionData(k.current))
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{KeyVersion: k.current, WrappedKey: wrapped, Ciphertext: e.Ciphertext}, nil
+}
+
+func (k *Keyring) unwrap(e *Envelope) ([]byte, error) {
+	master, ok := k.keys[e.KeyVersion]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownKey, e.KeyVersion)
+	}
+	return open(master, e.WrappedKey, versionData(e.KeyVersion))
+}
+
+// versionData binds a wrapped key to its master key version, so an
+// envelope's version cannot be altered.
+func versionData(version int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(version))
+}
+
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additional)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,203 @@
+package envelope
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeyLen)
+}
+
+func testKeyring(t *testing.T, current int, versions ...int) *Keyring {
+	t.Helper()
+	keys := make(map[int][]byte)
+	for _, version := range versions {
+		keys[version] = testKey(byte(version))
+	}
+	k, err := NewKeyring(keys, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestSealOpen(t *testing.T) {
+	k := testKeyring(t, 2, 1, 2)
+	plaintext := []byte("PrivateKey = secret")
+
+	e, err := k.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.KeyVersion != 2 || bytes.Contains(e.Ciphertext, plaintext) {
+		t.Fatalf("envelope = %+v", e)
+	}
+	got, err := k.Open(e)
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Fatalf("open = %q, %v", got, err)
+	}
+
+	// Every value gets its own data key and nonces
+	again, err := k.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(again.WrappedKey, e.WrappedKey) || bytes.Equal(again.Ciphertext, e.Ciphertext) {
+		t.Error("two seals of the same value are equal")
+	}
+
+	if e, err := k.Seal(nil); err != nil {
+		t.Error(err)
+	} else if got, err := k.Open(e); err != nil || len(got) != 0 {
+		t.Errorf("empty value opened to %q, %v", got, err)
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	k := testKeyring(t, 2, 1, 2)
+	sealed, err := k.Seal([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flip := func(b []byte) []byte {
+		b = bytes.Clone(b)
+		b[len(b)-1] ^= 1
+		return b
+	}
+	tests := []struct {
+		name string
+		e    Envelope
+		want error
+	}{
+		{"ciphertext", Envelope{KeyVersion: 2, WrappedKey: sealed.WrappedKey, Ciphertext: flip(sealed.Ciphertext)}, ErrDecrypt},
+		{"wrapped key", Envelope{KeyVersion: 2, WrappedKey: flip(sealed.WrappedKey), Ciphertext: sealed.Ciphertext}, ErrDecrypt},
+		{"version", Envelope{KeyVersion: 1, WrappedKey: sealed.WrappedKey, Ciphertext: sealed.Ciphertext}, ErrDecrypt},
+		{"unknown version", Envelope{KeyVersion: 3, WrappedKey: sealed.WrappedKey, Ciphertext: sealed.Ciphertext}, ErrUnknownKey},
+		{"truncated", Envelope{KeyVersion: 2, WrappedKey: sealed.WrappedKey[:4], Ciphertext: sealed.Ciphertext}, ErrDecrypt},
+		{"empty ciphertext", Envelope{KeyVersion: 2, WrappedKey: sealed.WrappedKey}, ErrDecrypt},
+	}
+	for _, tt := range tests {
+		if _, err := k.Open(&tt.e); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	other, err := NewKeyring(map[int][]byte{2: testKey(9)}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Open(sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("other key: got %v, want ErrDecrypt", err)
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	old := testKeyring(t, 1, 1)
+	sealed, err := old.Seal([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := testKeyring(t, 2, 1, 2)
+	rewrapped, err := rotated.Rewrap(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewrapped.KeyVersion != 2 || !bytes.Equal(rewrapped.Ciphertext, sealed.Ciphertext) || sealed.KeyVersion != 1 {
+		t.Fatalf("rewrapped = %+v from %+v", rewrapped, sealed)
+	}
+	// Once rewrapped, the old key can go
+	retired := testKeyring(t, 2, 2)
+	if got, err := retired.Open(rewrapped); err != nil || string(got) != "secret" {
+		t.Errorf("open after retiring version 1: %q, %v", got, err)
+	}
+	if _, err := retired.Open(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("open of the old envelope: got %v, want ErrUnknownKey", err)
+	}
+
+	if same, err := rotated.Rewrap(rewrapped); err != nil || same != rewrapped {
+		t.Errorf("rewrap under the current key: %v, %v", same, err)
+	}
+	if _, err := retired.Rewrap(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("rewrap with the key gone: got %v", err)
+	}
+}
+
+func TestNewKeyring(t *testing.T) {
+	k := testKeyring(t, 3, 3, 1, 2)
+	if k.Current() != 3 || k.Ephemeral() {
+		t.Errorf("current %d, ephemeral %v", k.Current(), k.Ephemeral())
+	}
+	if v := k.Versions(); len(v) != 3 || v[0] != 1 || v[2] != 3 {
+		t.Errorf("versions = %v", v)
+	}
+
+	tests := map[string]struct {
+		keys    map[int][]byte
+		current int
+	}{
+		"version zero":    {map[int][]byte{0: testKey(1)}, 0},
+		"short key":       {map[int][]byte{1: testKey(1)[:16]}, 1},
+		"missing current": {map[int][]byte{1: testKey(1)}, 2},
+		"no keys":         {nil, 1},
+	}
+	for name, tt := range tests {
+		if _, err := NewKeyring(tt.keys, tt.current); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+}
+
+func TestEphemeralKeyring(t *testing.T) {
+	a, err := NewEphemeralKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewEphemeralKeyring()
+	if !a.Ephemeral() || a.Current() != 0 {
+		t.Errorf("ephemeral %v, current %d", a.Ephemeral(), a.Current())
+	}
+
+	sealed, err := a.Seal([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Open(sealed); err != nil {
+		t.Error(err)
+	}
+	if _, err := b.Open(sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("another process's key opened it: %v", err)
+	}
+}
+
+func TestIncluding(t *testing.T) {
+	old := testKeyring(t, 1, 1)
+	sealed, err := old.Seal([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The new keyring's own key wins for a version both hold
+	replacement, _ := NewKeyring(map[int][]byte{1: testKey(8), 2: testKey(2)}, 2)
+	merged := replacement.Including(old)
+	if merged.Current() != 2 || len(merged.Versions()) != 2 {
+		t.Fatalf("merged: current %d, versions %v", merged.Current(), merged.Versions())
+	}
+	if _, err := merged.Open(sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("older key kept over the newer one: %v", err)
+	}
+
+	merged = testKeyring(t, 2, 2).Including(old)
+	if got, err := merged.Open(sealed); err != nil || string(got) != "secret" {
+		t.Errorf("open with the older key: %q, %v", got, err)
+	}
+	if e, _ := merged.Seal([]byte("x")); e.KeyVersion != 2 {
+		t.Errorf("merged seals with version %d", e.KeyVersion)
+	}
+	if got := testKeyring(t, 2, 2).Including(nil).Versions(); len(got) != 1 {
+		t.Errorf("including nil: %v", got)
+	}
+}
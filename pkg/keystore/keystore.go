@@ -0,0 +1,123 @@
+// Package keystore reads and writes a passphrase-protected file of named
+// secrets. The passphrase is stretched with scrypt and the secrets are
+// sealed with AES-256-GCM.
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const version = 1
+
+// scrypt cost parameters, as recommended for interactive logins
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var ErrWrongPassphrase = errors.New("keystore: wrong passphrase or corrupted file")
+
+// file is the on-disk form of a keystore.
+type file struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Open decrypts the keystore at path.
+func Open(path, passphrase string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("keystore: failed to parse %s: %w", path, err)
+	}
+	if f.Version != version || f.KDF != "scrypt" {
+		return nil, fmt.Errorf("keystore: unsupported format version %d (%s)", f.Version, f.KDF)
+	}
+
+	aead, err := newAEAD(passphrase, f.Salt, f.N, f.R, f.P)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := aead.Open(nil, f.Nonce, f.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("keystore: malformed contents: %w", err)
+	}
+	return secrets, nil
+}
+
+// Save encrypts secrets into a new keystore at path, replacing any existing
+// file.
+func Save(path, passphrase string, secrets map[string]string) error {
+	if passphrase == "" {
+		return errors.New("keystore: empty passphrase")
+	}
+
+	f := file{Version: version, KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP}
+	f.Salt = make([]byte, 16)
+	if _, err := rand.Read(f.Salt); err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(passphrase, f.Salt, f.N, f.R, f.P)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	f.Ciphertext = aead.Seal(nil, f.Nonce, plain, nil)
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("keystore: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func newAEAD(passphrase string, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, 32)
+	if err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
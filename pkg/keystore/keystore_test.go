@@ -0,0 +1,77 @@
+package keystore
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	secrets := map[string]string{"ADMIN_TOKEN": "s3cret", "LINK_SECRET": "another"}
+	if err := Save(path, "correct horse", secrets); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cret") || strings.Contains(string(data), "ADMIN_TOKEN") {
+		t.Error("keystore file holds plaintext")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("keystore mode %v, want 0600", info.Mode().Perm())
+	}
+
+	opened, err := Open(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opened) != 2 || opened["ADMIN_TOKEN"] != "s3cret" || opened["LINK_SECRET"] != "another" {
+		t.Errorf("opened %v", opened)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keystore.json")
+	if err := Save(path, "correct horse", map[string]string{"ADMIN_TOKEN": "s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(path, "battery staple"); err != ErrWrongPassphrase {
+		t.Errorf("wrong passphrase: got %v", err)
+	}
+
+	// Flipping a ciphertext bit is caught by the authentication tag
+	var f file
+	data, _ := os.ReadFile(path)
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatal(err)
+	}
+	f.Ciphertext[0] ^= 1
+	tampered := filepath.Join(dir, "tampered.json")
+	data, _ = json.Marshal(f)
+	os.WriteFile(tampered, data, 0o600)
+	if _, err := Open(tampered, "correct horse"); err != ErrWrongPassphrase {
+		t.Errorf("tampered file: got %v", err)
+	}
+
+	f.Version = 2
+	future := filepath.Join(dir, "future.json")
+	data, _ = json.Marshal(f)
+	os.WriteFile(future, data, 0o600)
+	if _, err := Open(future, "correct horse"); err == nil || !strings.Contains(err.Error(), "unsupported format") {
+		t.Errorf("unknown version: got %v", err)
+	}
+
+	if _, err := Open(filepath.Join(dir, "missing.json"), "correct horse"); err == nil {
+		t.Error("missing file opened")
+	}
+	if err := Save(path, "", nil); err == nil {
+		t.Error("empty passphrase accepted")
+	}
+}
@@ -0,0 +1,98 @@
+package wireguard
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Backend manages the peers of a single WireGuard interface. Interface talks
+// to the kernel through the wg tool, FakeBackend keeps peers in memory and
+// the agent client forwards calls to a remote node.
+type Backend interface {
+	AddPeer(publicKey, allowedIP string) error
+	RemovePeer(publicKey string) error
+	ListPeers() ([]Peer, error)
+}
+
+type Peer struct {
+	PublicKey       string    `json:"publicKey"`
+	Endpoint        string    `json:"endpoint,omitempty"`
+	AllowedIPs      string    `json:"allowedIps"`
+	LatestHandshake time.Time `json:"latestHandshake"`
+	RxBytes         int64     `json:"rxBytes"`
+	TxBytes         int64     `json:"txBytes"`
+}
+
+type Stats struct {
+	Peers       int   `json:"peers"`
+	ActivePeers int   `json:"activePeers"`
+	RxBytes     int64 `json:"rxBytes"`
+	TxBytes     int64 `json:"txBytes"`
+}
+
+// ActiveHandshakeWindow is how recent a handshake must be for a peer to be
+// considered active. WireGuard re-handshakes every two minutes under traffic.
+const ActiveHandshakeWindow = 3 * time.Minute
+
+func Summarize(peers []Peer) Stats {
+	stats := Stats{Peers: len(peers)}
+	for _, p := range peers {
+		if !p.LatestHandshake.IsZero() && time.Since(p.LatestHandshake) < ActiveHandshakeWindow {
+			stats.ActivePeers++
+		}
+		stats.RxBytes += p.RxBytes
+		stats.TxBytes += p.TxBytes
+	}
+	return stats
+}
+
+type FakeBackend struct {
+	mu    sync.Mutex
+	peers map[string]Peer
+}
+
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{peers: make(map[string]Peer)}
+}
+
+func (f *FakeBackend) AddPeer(publicKey, allowedIP string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.peers[publicKey] = Peer{PublicKey: publicKey, AllowedIPs: allowedIP + "/32"}
+	return nil
+}
+
+func (f *FakeBackend) RemovePeer(publicKey string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.peers, publicKey)
+	return nil
+}
+
+// SetTraffic records a handshake and the transfer counters of a peer, as
+// the kernel would once a client connects.
+func (f *FakeBackend) SetTraffic(publicKey string, handshake time.Time, rxBytes, txBytes int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	peer, ok := f.peers[publicKey]
+	if !ok {
+		peer = Peer{PublicKey: publicKey}
+	}
+	peer.LatestHandshake = handshake
+	peer.RxBytes = rxBytes
+	peer.TxBytes = txBytes
+	f.peers[publicKey] = peer
+}
+
+func (f *FakeBackend) ListPeers() ([]Peer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	peers := make([]Peer, 0, len(f.peers))
+	for _, p := range f.peers {
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].PublicKey < peers[j].PublicKey })
+	return peers, nil
+}
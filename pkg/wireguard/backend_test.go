@@ -0,0 +1,88 @@
+package wireguard
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDump(t *testing.T) {
+	dump := "cHJpdmF0ZQ==\tcHVibGlj\t51820\toff\n" +
+		"cGVlcjE=\t(none)\t198.51.100.7:40000\t10.8.1.2/32\t1700000000\t1024\t2048\t25\n" +
+		"cGVlcjI=\t(none)\t(none)\t10.8.1.3/32\t0\t0\t0\toff\n" +
+		"short\tline\n"
+
+	peers := parseDump(dump)
+	if len(peers) != 2 {
+		t.Fatalf("got %d peers, want 2: %+v", len(peers), peers)
+	}
+	want := Peer{
+		PublicKey:       "cGVlcjE=",
+		Endpoint:        "198.51.100.7:40000",
+		AllowedIPs:      "10.8.1.2/32",
+		LatestHandshake: time.Unix(1700000000, 0),
+		RxBytes:         1024,
+		TxBytes:         2048,
+	}
+	if peers[0] != want {
+		t.Errorf("peer = %+v, want %+v", peers[0], want)
+	}
+	if idle := peers[1]; idle.Endpoint != "" || !idle.LatestHandshake.IsZero() || idle.RxBytes != 0 {
+		t.Errorf("idle peer = %+v", idle)
+	}
+
+	if peers := parseDump("cHJpdmF0ZQ==\tcHVibGlj\t51820\toff\n"); len(peers) != 0 {
+		t.Errorf("interface without peers: %+v", peers)
+	}
+}
+
+func TestFakeBackend(t *testing.T) {
+	backend := NewFakeBackend()
+	for _, key := range []string{"b", "a"} {
+		if err := backend.AddPeer(key, "10.8.1.2"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := backend.RemovePeer("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.AddPeer("c", "10.8.1.3"); err != nil {
+		t.Fatal(err)
+	}
+
+	peers, err := backend.ListPeers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 2 || peers[0].PublicKey != "a" || peers[1].PublicKey != "c" || peers[1].AllowedIPs != "10.8.1.3/32" {
+		t.Errorf("peers = %+v, want a and c in key order", peers)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	now := time.Now()
+	stats := Summarize([]Peer{
+		{PublicKey: "a", LatestHandshake: now.Add(-time.Minute), RxBytes: 10, TxBytes: 20},
+		{PublicKey: "b", LatestHandshake: now.Add(-ActiveHandshakeWindow - time.Second), RxBytes: 1, TxBytes: 2},
+		{PublicKey: "c"},
+	})
+	if want := (Stats{Peers: 3, ActivePeers: 1, RxBytes: 11, TxBytes: 22}); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestFakeBackendSetTraffic(t *testing.T) {
+	backend := NewFakeBackend()
+	backend.AddPeer("a", "10.8.1.2")
+	handshake := time.Unix(1700000000, 0)
+	backend.SetTraffic("a", handshake, 100, 200)
+	// A canary the backend never added shows up too
+	backend.SetTraffic("canary", handshake, 0, 0)
+
+	peers, _ := backend.ListPeers()
+	if len(peers) != 2 {
+		t.Fatalf("peers = %+v", peers)
+	}
+	if a := peers[0]; a.AllowedIPs != "10.8.1.2/32" || !a.LatestHandshake.Equal(handshake) || a.RxBytes != 100 || a.TxBytes != 200 {
+		t.Errorf("a = %+v", a)
+	}
+}
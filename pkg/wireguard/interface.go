@@ -3,7 +3,9 @@ package wireguard
 import (
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Interface struct {
@@ -59,6 +61,43 @@ func (i *Interface) RemovePeer(publicKey string) error {
 	return i.exec("wg", "set", i.name, "peer", publicKey, "remove")
 }
 
+func (i *Interface) ListPeers() ([]Peer, error) {
+	output, err := exec.Command("wg", "show", i.name, "dump").Output()
+	if err != nil {
+		return nil, fmt.Errorf("wg show failed: %w", err)
+	}
+	return parseDump(string(output)), nil
+}
+
+// parseDump parses the output of `wg show <iface> dump`. The first line
+// describes the interface itself, every following line is one peer.
+func parseDump(output string) []Peer {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	peers := make([]Peer, 0, len(lines))
+	for _, line := range lines[1:] {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 8 {
+			continue
+		}
+
+		peer := Peer{
+			PublicKey:  fields[0],
+			AllowedIPs: fields[3],
+		}
+		if fields[2] != "(none)" {
+			peer.Endpoint = fields[2]
+		}
+		if ts, _ := strconv.ParseInt(fields[4], 10, 64); ts > 0 {
+			peer.LatestHandshake = time.Unix(ts, 0)
+		}
+		peer.RxBytes, _ = strconv.ParseInt(fields[5], 10, 64)
+		peer.TxBytes, _ = strconv.ParseInt(fields[6], 10, 64)
+
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
 func (i *Interface) setupNAT() error {
 	// Get default interface
 	output, err := exec.Command("ip", "route", "show", "default").Output()
@@ -0,0 +1,45 @@
+package wireguard
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// KeyLen is the size of a WireGuard Curve25519 key.
+const KeyLen = 32
+
+var ErrInvalidKey = errors.New("invalid WireGuard key")
+
+// ParseKey decodes a base64 WireGuard key.
+func ParseKey(key string) ([KeyLen]byte, error) {
+	var k [KeyLen]byte
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return k, fmt.Errorf("%w: not valid base64", ErrInvalidKey)
+	}
+	if len(raw) != KeyLen {
+		return k, fmt.Errorf("%w: %d bytes, expected %d", ErrInvalidKey, len(raw), KeyLen)
+	}
+	copy(k[:], raw)
+	if k == ([KeyLen]byte{}) {
+		return k, fmt.Errorf("%w: all zero", ErrInvalidKey)
+	}
+	return k, nil
+}
+
+// PublicKey derives the base64 public key of a base64 private key.
+func PublicKey(privateKey string) (string, error) {
+	private, err := ParseKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	public, err := curve25519.X25519(private[:], curve25519.Basepoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return base64.StdEncoding.EncodeToString(public), nil
+}
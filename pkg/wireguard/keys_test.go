@@ -0,0 +1,48 @@
+package wireguard
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestPublicKey(t *testing.T) {
+	// Alice's key pair from RFC 7748, section 6.1
+	private, _ := hex.DecodeString("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")
+	public, _ := hex.DecodeString("8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a")
+
+	got, err := PublicKey(base64.StdEncoding.EncodeToString(private))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := base64.StdEncoding.EncodeToString(public); got != want {
+		t.Errorf("PublicKey = %s, want %s", got, want)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		key string
+		ok  bool
+	}{
+		{base64.StdEncoding.EncodeToString(append([]byte{1}, make([]byte, KeyLen-1)...)), true},
+		{"not base64!", false},
+		{base64.StdEncoding.EncodeToString([]byte{1, 2, 3}), false},
+		{base64.StdEncoding.EncodeToString(make([]byte, KeyLen)), false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		_, err := ParseKey(tt.key)
+		if tt.ok && err != nil {
+			t.Errorf("ParseKey(%q): %v", tt.key, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("ParseKey(%q) = %v, want ErrInvalidKey", tt.key, err)
+		}
+	}
+
+	if _, err := PublicKey("short"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("PublicKey of an invalid key: %v", err)
+	}
+}